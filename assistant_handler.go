@@ -92,9 +92,9 @@ func createNewAssistant(client *openai.Client, options Options) (string, error)
 
 // chatWithAssistant は、指定されたアシスタントに対してユーザーからのメッセージを送信し、アシスタントの応答を表示します。
 // clientはOpenAI APIクライアント、assistantIDは対象のアシスタントのIDを示します。
-// optionsにはユーザーが入力したメッセージやその他の設定が含まれます。
+// optionsにはユーザーが入力したメッセージやその他の設定が含まれ、メッセージは config の redaction に従って機密情報を伏せ字にしてから送信します。
 // アシスタントの応答が表示され, エラーが発生した場合はその内容が返されます。
-func chatWithAssistant(client *openai.Client, assistantID string, options Options) error {
+func chatWithAssistant(client *openai.Client, assistantID string, options Options, config Config) error {
 	logger.Info("chatWithAssistantです。次のアシスタントを使用します:\nassistantID: %s\n", assistantID)
 	ctx := context.Background()
 
@@ -104,13 +104,17 @@ func chatWithAssistant(client *openai.Client, assistantID string, options Option
 		return fmt.Errorf("アシスタント(%s)の取得に失敗しました: %w", assistantID, err)
 	}
 
-	// メッセージの構築
+	// メッセージの構築（送信する前に機密情報を伏せ字にする）
 	messages := []openai.ChatCompletionMessage{
 		{
 			Role:    openai.ChatMessageRoleUser,
 			Content: options.UserMessage,
 		},
 	}
+	messages, err = ApplySecretRedaction(messages, config.Redaction, options.AllowSecrets, os.Stderr)
+	if err != nil {
+		return err
+	}
 
 	// チャットのリクエスト
 	chatRequest := openai.ChatCompletionRequest{
@@ -145,8 +149,9 @@ func chatWithAssistant(client *openai.Client, assistantID string, options Option
 // interactiveChatWithAssistant は、指定されたアシスタントとのインタラクティブな対話を開始します。
 // ユーザーが標準入力からメッセージを入力すると、アシスタントに送信され、その応答が表示されます。
 // パラメータとしてclinetはOpenAI APIクライアント、assistantIDは対象のアシスタントのID、およびoptionsは設定が含まれます。
+// 入力したメッセージは config の redaction に従って機密情報を伏せ字にしてから送信します。
 // ユーザーが“exit”と入力するまで会話は続きます。
-func interactiveChatWithAssistant(client *openai.Client, assistantID string, options Options) error {
+func interactiveChatWithAssistant(client *openai.Client, assistantID string, options Options, config Config) error {
 	logger.Info("interactiveChatWithAssistantです。次のアシスタントを使用します:\nassistantID: %s\n", assistantID)
 	ctx := context.Background()
 
@@ -171,10 +176,17 @@ func interactiveChatWithAssistant(client *openai.Client, assistantID string, opt
 			break
 		}
 
+		// 送信する前に機密情報を伏せ字にする（送信を中止した場合は入力し直す）
+		redacted, err := ApplySecretRedaction([]openai.ChatCompletionMessage{{Role: openai.ChatMessageRoleUser, Content: userInput}}, config.Redaction, options.AllowSecrets, os.Stderr)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			continue
+		}
+
 		// ユーザーメッセージをスレッドに追加
 		_, err = client.CreateMessage(ctx, thread.ID, openai.MessageRequest{
 			Role:    openai.ChatMessageRoleUser,
-			Content: userInput,
+			Content: redacted[0].Content,
 		})
 		if err != nil {
 			return fmt.Errorf("ユーザーメッセージの送信に失敗しました: %w", err)
@@ -318,7 +330,7 @@ func handleCreateAssistant(client *openai.Client, options Options, config Config
 // この関数では、ユーザーが送信したメッセージの有無に応じて、アシスタントとの単発チャットまたはインタラクティブなあるいは対話モードを開始します。
 // clientはOpenAI APIクライアント、optionsにはユーザーの入力や設定が含まれます。
 // いずれかの操作の実行中にエラーが発生した場合は、その内容が返されます。
-func handleAssistantInteraction(client *openai.Client, options Options) error {
+func handleAssistantInteraction(client *openai.Client, options Options, config Config) error {
 	ctx := context.Background()
 	var assistantID string
 
@@ -351,7 +363,7 @@ func handleAssistantInteraction(client *openai.Client, options Options) error {
 
 	if options.Message != "" {
 		// 単一のメッセージを送信
-		err := chatWithAssistant(client, assistantID, options)
+		err := chatWithAssistant(client, assistantID, options, config)
 		if err != nil {
 			return fmt.Errorf("アシスタントとのチャットに失敗しました: %v", err)
 		}
@@ -359,7 +371,7 @@ func handleAssistantInteraction(client *openai.Client, options Options) error {
 	}
 
 	// 対話モードを開始
-	err := interactiveChatWithAssistant(client, assistantID, options)
+	err := interactiveChatWithAssistant(client, assistantID, options, config)
 	if err != nil {
 		return fmt.Errorf("アシスタントとのチャットに失敗しました: %v", err)
 	}
@@ -0,0 +1,273 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+)
+
+// CodeBlock は応答から取り出したコードブロックです
+// - Lang: フェンスの情報文字列に書かれた言語名
+// - Filename: 情報文字列または直前の行から推測したファイル名（推測できない場合は空）
+// - Content: コードの内容
+type CodeBlock struct {
+	Lang     string
+	Filename string
+	Content  string
+}
+
+var (
+	fenceOpenPattern = regexp.MustCompile("^\\s*(`{3,}|~{3,})\\s*(.*)$")
+	filePathPattern  = regexp.MustCompile(`^(?:[\w.-]+/)*[\w-][\w.-]*\.[A-Za-z0-9]+$`)
+	filenameAttr     = regexp.MustCompile(`(?:title|file|filename|name)=["']?([^"'\s]+)["']?`)
+	hintPrefix       = regexp.MustCompile(`^(?i:file|filename|path|ファイル名?|パス)\s*[:：]\s*`)
+	backtickPattern  = regexp.MustCompile("`([^`]+)`")
+)
+
+// ExtractCodeBlocks は、Markdownのテキストからフェンスで囲まれたコードブロックを順番に取り出します。
+// ファイル名は、情報文字列（"go main.go"、"go:main.go"、"go title=main.go" など）、
+// またはコードブロックの直前の行（"`main.go`:" や "**cmd/main.go**" など）から推測します。
+func ExtractCodeBlocks(markdown string) []CodeBlock {
+	var blocks []CodeBlock
+	lines := strings.Split(strings.ReplaceAll(markdown, "\r\n", "\n"), "\n")
+	previous := ""
+
+	for i := 0; i < len(lines); i++ {
+		m := fenceOpenPattern.FindStringSubmatch(lines[i])
+		if m == nil {
+			if strings.TrimSpace(lines[i]) != "" {
+				previous = lines[i]
+			}
+			continue
+		}
+
+		fence := m[1]
+		block := parseFenceInfo(m[2])
+		if block.Filename == "" {
+			block.Filename = filenameFromLine(previous)
+		}
+
+		var content []string
+		for i++; i < len(lines); i++ {
+			trimmed := strings.TrimSpace(lines[i])
+			if strings.HasPrefix(trimmed, fence) && strings.Trim(trimmed, fence[:1]) == "" {
+				break
+			}
+			content = append(content, lines[i])
+		}
+		block.Content = strings.Join(content, "\n")
+		if len(content) > 0 {
+			block.Content += "\n"
+		}
+		blocks = append(blocks, block)
+		previous = ""
+	}
+	return blocks
+}
+
+// parseFenceInfo はフェンスの情報文字列から言語名とファイル名を取り出します
+func parseFenceInfo(info string) CodeBlock {
+	var block CodeBlock
+	info = strings.TrimSpace(info)
+	if info == "" {
+		return block
+	}
+	if m := filenameAttr.FindStringSubmatch(info); m != nil {
+		block.Filename = m[1]
+		info = strings.TrimSpace(strings.Replace(info, m[0], "", 1))
+	}
+
+	fields := strings.Fields(info)
+	if len(fields) == 0 {
+		return block
+	}
+	first := fields[0]
+	if lang, name, ok := strings.Cut(first, ":"); ok && filePathPattern.MatchString(name) {
+		block.Lang, block.Filename = lang, name
+		return block
+	}
+	if filePathPattern.MatchString(first) && block.Filename == "" && len(fields) == 1 {
+		// "main.go" のようにファイル名だけが書かれている場合
+		block.Filename = first
+		block.Lang = DetectLanguage(first)
+		return block
+	}
+	block.Lang = first
+	if block.Filename == "" && len(fields) > 1 && filePathPattern.MatchString(fields[1]) {
+		block.Filename = fields[1]
+	}
+	return block
+}
+
+// filenameFromLine は、コードブロックの直前の行がファイル名を示している場合にそのファイル名を返します
+func filenameFromLine(line string) string {
+	line = strings.TrimSpace(line)
+	line = strings.TrimLeft(line, "#>-*+ ")
+	line = hintPrefix.ReplaceAllString(line, "")
+	line = strings.TrimRight(line, ":： ")
+	if name := strings.Trim(line, "*_`'\" "); filePathPattern.MatchString(name) {
+		return name
+	}
+
+	// "`main.go` を次のように変更します:" のように、バッククォートで囲まれたパスが1つだけある場合
+	if m := backtickPattern.FindAllStringSubmatch(line, -1); len(m) == 1 && filePathPattern.MatchString(m[0][1]) {
+		return m[0][1]
+	}
+	return ""
+}
+
+// SelectCodeBlocks は、index が 0 の場合はすべてのコードブロックを、1 以上の場合は index 番目のコードブロックを返します
+func SelectCodeBlocks(blocks []CodeBlock, index int) ([]CodeBlock, error) {
+	if len(blocks) == 0 {
+		return nil, fmt.Errorf("応答にコードブロックがありません")
+	}
+	if index == 0 {
+		return blocks, nil
+	}
+	if index < 0 || index > len(blocks) {
+		return nil, fmt.Errorf("コードブロック %d はありません（コードブロックの数: %d）", index, len(blocks))
+	}
+	return blocks[index-1 : index], nil
+}
+
+// languageExtensions は、複数の拡張子がある言語で優先する拡張子です
+var languageExtensions = map[string]string{
+	"javascript": ".js",
+	"js":         ".js",
+	"typescript": ".ts",
+	"ts":         ".ts",
+	"yaml":       ".yaml",
+	"c":          ".c",
+	"cpp":        ".cpp",
+	"bash":       ".sh",
+	"sh":         ".sh",
+	"shell":      ".sh",
+	"diff":       ".diff",
+	"golang":     ".go",
+	"py":         ".py",
+}
+
+// extensionForLanguage は言語名に対応するファイルの拡張子を返します（不明な場合は .txt）
+func extensionForLanguage(lang string) string {
+	lang = strings.ToLower(lang)
+	if ext, ok := languageExtensions[lang]; ok {
+		return ext
+	}
+	exts := make([]string, 0, len(languageByExtension))
+	for ext := range languageByExtension {
+		exts = append(exts, ext)
+	}
+	sort.Strings(exts)
+	for _, ext := range exts {
+		if languageByExtension[ext] == lang {
+			return ext
+		}
+	}
+	return ".txt"
+}
+
+// WriteCodeBlocks は、コードブロックを dir 以下のファイルに書き込み、書き込んだパスを返します。
+// ファイル名が推測できないコードブロックは snippet-N.<拡張子> に書き込みます。
+// 既存のファイルは force が true の場合のみ上書きします。上書きできないファイルがある場合は何も書き込みません。
+func WriteCodeBlocks(blocks []CodeBlock, dir string, force bool) ([]string, error) {
+	paths := make([]string, len(blocks))
+	seen := make(map[string]bool)
+	for i, block := range blocks {
+		name := block.Filename
+		if name == "" {
+			name = fmt.Sprintf("snippet-%d%s", i+1, extensionForLanguage(block.Lang))
+		}
+		if !filepath.IsLocal(name) {
+			return nil, fmt.Errorf("書き込み先のディレクトリの外を指すファイル名は使用できません: %s", name)
+		}
+
+		path := filepath.Join(dir, name)
+		if seen[path] {
+			return nil, fmt.Errorf("複数のコードブロックが同じファイル %s を指しています（-code-block で選択してください）", path)
+		}
+		seen[path] = true
+		if _, err := os.Stat(path); err == nil && !force {
+			return nil, fmt.Errorf("%s は既に存在します（上書きする場合は -force を指定してください）", path)
+		} else if err != nil && !errors.Is(err, os.ErrNotExist) {
+			return nil, err
+		}
+		paths[i] = path
+	}
+
+	var written []string
+	for i, block := range blocks {
+		if err := os.MkdirAll(filepath.Dir(paths[i]), 0755); err != nil {
+			return written, fmt.Errorf("ディレクトリの作成に失敗しました: %w", err)
+		}
+		if err := os.WriteFile(paths[i], []byte(block.Content), 0644); err != nil {
+			return written, fmt.Errorf("ファイルの書き込みに失敗しました (%s): %w", paths[i], err)
+		}
+		written = append(written, paths[i])
+	}
+	return written, nil
+}
+
+// clipboardCommands はクリップボードにコピーするコマンドの候補です（見つかった最初のコマンドを使用します）
+var clipboardCommands = [][]string{
+	{"pbcopy"},
+	{"wl-copy"},
+	{"xclip", "-selection", "clipboard"},
+	{"xsel", "--clipboard", "--input"},
+	{"clip.exe"},
+}
+
+// CopyToClipboard はテキストをクリップボードにコピーします
+func CopyToClipboard(text string) error {
+	for _, command := range clipboardCommands {
+		if _, err := exec.LookPath(command[0]); err != nil {
+			continue
+		}
+		cmd := exec.Command(command[0], command[1:]...)
+		cmd.Stdin = strings.NewReader(text)
+		if err := cmd.Run(); err != nil {
+			return fmt.Errorf("クリップボードへのコピーに失敗しました (%s): %w", command[0], err)
+		}
+		return nil
+	}
+	return fmt.Errorf("クリップボードにコピーするコマンド（pbcopy, wl-copy, xclip, xsel）が見つかりません")
+}
+
+// handleCodeOutput は、-extract-code、-code-block、-write-code、-copy-code の指定に従って
+// 応答のコードブロックを表示、書き込み、またはコピーします
+func handleCodeOutput(content string, options Options) error {
+	blocks, err := SelectCodeBlocks(ExtractCodeBlocks(content), options.CodeBlock)
+	if err != nil {
+		return err
+	}
+
+	codes := make([]string, len(blocks))
+	for i, block := range blocks {
+		codes[i] = block.Content
+	}
+	joined := strings.Join(codes, "\n")
+
+	if options.WriteCode != "" {
+		written, err := WriteCodeBlocks(blocks, options.WriteCode, options.Force)
+		for _, path := range written {
+			fmt.Fprintf(os.Stderr, "書き込みました: %s\n", path)
+		}
+		if err != nil {
+			return err
+		}
+	}
+	if options.CopyCode {
+		if err := CopyToClipboard(joined); err != nil {
+			return err
+		}
+		fmt.Fprintf(os.Stderr, "%d 個のコードブロックをクリップボードにコピーしました。\n", len(blocks))
+	}
+	if options.ExtractCode || options.CodeBlock > 0 {
+		fmt.Print(joined)
+	}
+	return nil
+}
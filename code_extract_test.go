@@ -0,0 +1,76 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestExtractCodeBlocks(t *testing.T) {
+	response := "説明です。\n\n" +
+		"```go main.go\npackage main\n```\n\n" +
+		"**internal/util.go**:\n\n" +
+		"```go\npackage internal\n```\n\n" +
+		"`scripts/run.sh` を追加します:\n" +
+		"~~~bash\necho ok\n```\nまだコード\n~~~\n\n" +
+		"```python:tools/gen.py\nprint(1)\n```\n\n" +
+		"```yaml title=\"config.yaml\"\nkey: value\n```\n\n" +
+		"```\nplain text\n```\n"
+
+	blocks := ExtractCodeBlocks(response)
+	want := []CodeBlock{
+		{Lang: "go", Filename: "main.go", Content: "package main\n"},
+		{Lang: "go", Filename: "internal/util.go", Content: "package internal\n"},
+		{Lang: "bash", Filename: "scripts/run.sh", Content: "echo ok\n```\nまだコード\n"},
+		{Lang: "python", Filename: "tools/gen.py", Content: "print(1)\n"},
+		{Lang: "yaml", Filename: "config.yaml", Content: "key: value\n"},
+		{Content: "plain text\n"},
+	}
+	if len(blocks) != len(want) {
+		t.Fatalf("コードブロックの数 = %d, 期待値 %d: %+v", len(blocks), len(want), blocks)
+	}
+	for i := range want {
+		if blocks[i] != want[i] {
+			t.Errorf("blocks[%d] = %+v, 期待値 %+v", i, blocks[i], want[i])
+		}
+	}
+
+	selected, err := SelectCodeBlocks(blocks, 2)
+	if err != nil || len(selected) != 1 || selected[0].Filename != "internal/util.go" {
+		t.Errorf("SelectCodeBlocks(2) = %+v, %v", selected, err)
+	}
+	if _, err := SelectCodeBlocks(blocks, 7); err == nil {
+		t.Errorf("存在しない番号がエラーになりませんでした")
+	}
+}
+
+func TestWriteCodeBlocks(t *testing.T) {
+	dir := t.TempDir()
+	blocks := []CodeBlock{
+		{Lang: "go", Filename: "cmd/main.go", Content: "package main\n"},
+		{Lang: "javascript", Content: "console.log(1)\n"},
+	}
+
+	written, err := WriteCodeBlocks(blocks, dir, false)
+	if err != nil {
+		t.Fatalf("WriteCodeBlocks() エラー: %v", err)
+	}
+	if len(written) != 2 || written[1] != filepath.Join(dir, "snippet-2.js") {
+		t.Errorf("書き込んだファイルが正しくありません: %v", written)
+	}
+	if data, _ := os.ReadFile(filepath.Join(dir, "cmd", "main.go")); string(data) != "package main\n" {
+		t.Errorf("ファイルの内容が正しくありません: %q", data)
+	}
+
+	blocks[0].Content = "package changed\n"
+	if _, err := WriteCodeBlocks(blocks, dir, false); err == nil || !strings.Contains(err.Error(), "-force") {
+		t.Errorf("既存のファイルの上書きがエラーになりませんでした: %v", err)
+	}
+	if _, err := WriteCodeBlocks(blocks, dir, true); err != nil {
+		t.Errorf("-force で上書きできませんでした: %v", err)
+	}
+	if _, err := WriteCodeBlocks([]CodeBlock{{Filename: "../escape.go"}}, dir, true); err == nil {
+		t.Errorf("ディレクトリの外への書き込みがエラーになりませんでした")
+	}
+}
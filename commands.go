@@ -0,0 +1,101 @@
+package main
+
+import (
+	"bufio"
+	"flag"
+	"fmt"
+	"os"
+	"strings"
+)
+
+// subcommandFunc はサブコマンドの処理を表す関数です。
+// args にはサブコマンド名より後ろの引数が渡されます。
+type subcommandFunc func(options Options, config Config, args []string) error
+
+// subcommands は、フラグ以外の最初の引数で選択できるサブコマンドの一覧です。
+// グローバルなオプション（-c, -d など）はサブコマンド名より前に指定します。
+var subcommands = map[string]subcommandFunc{
+	"commit-msg": runCommitMsgCommand,
+	"prompts":    runPromptsCommand,
+	"config":     runConfigCommand,
+	"history":    runHistoryCommand,
+}
+
+// findSubcommand は、引数の先頭がサブコマンド名であればその処理を返します
+func findSubcommand(args []string) (subcommandFunc, []string, bool) {
+	if len(args) == 0 {
+		return nil, nil, false
+	}
+	command, ok := subcommands[args[0]]
+	if !ok {
+		return nil, nil, false
+	}
+	return command, args[1:], true
+}
+
+// newSubcommandFlagSet は、サブコマンド用のフラグセットを作成します。
+// 解析エラーは呼び出し元に返し、プログラムは終了しません。
+func newSubcommandFlagSet(name string) *flag.FlagSet {
+	fs := flag.NewFlagSet(name, flag.ContinueOnError)
+	fs.SetOutput(os.Stderr)
+	return fs
+}
+
+// parseSubcommandFlags は、フラグと位置引数が混在した引数を解析し、位置引数を返します。
+// 標準の flag パッケージは最初の位置引数で解析を止めるため、残りの引数を繰り返し解析します。
+func parseSubcommandFlags(fs *flag.FlagSet, args []string) ([]string, error) {
+	var positional []string
+	for {
+		if err := fs.Parse(args); err != nil {
+			return nil, err
+		}
+		rest := fs.Args()
+		// "--" 以降はすべて位置引数として扱う
+		if consumed := len(args) - len(rest); consumed > 0 && args[consumed-1] == "--" {
+			return append(positional, rest...), nil
+		}
+		if len(rest) == 0 {
+			return positional, nil
+		}
+		positional = append(positional, rest[0])
+		args = rest[1:]
+	}
+}
+
+// promptLine は、メッセージを標準エラー出力に表示し、ユーザーの入力を1行読み込みます
+func promptLine(reader *bufio.Reader, message string) string {
+	fmt.Fprint(os.Stderr, message)
+	line, _ := reader.ReadString('\n')
+	return strings.TrimSpace(line)
+}
+
+// confirm はユーザーに y/N で確認を求めます
+func confirm(reader *bufio.Reader, message string) bool {
+	answer := strings.ToLower(promptLine(reader, message+" [y/N]: "))
+	return answer == "y" || answer == "yes"
+}
+
+// terminalReader は対話的な入力を読み込むリーダーを返します。
+// 標準入力がパイプなどで使われている場合は、端末（/dev/tty）から読み込みます。
+func terminalReader() (*bufio.Reader, func()) {
+	if inputAvailable() {
+		if tty, err := os.Open("/dev/tty"); err == nil {
+			return bufio.NewReader(tty), func() { tty.Close() }
+		}
+	}
+	return bufio.NewReader(os.Stdin), func() {}
+}
+
+// isTerminal はファイルが端末かどうかを返します
+func isTerminal(file *os.File) bool {
+	stat, err := file.Stat()
+	if err != nil {
+		return false
+	}
+	return (stat.Mode() & os.ModeCharDevice) != 0
+}
+
+// useColor は、出力先が端末で環境変数 NO_COLOR が設定されていない場合に色付きで表示するかを返します
+func useColor(file *os.File) bool {
+	return os.Getenv("NO_COLOR") == "" && isTerminal(file)
+}
@@ -0,0 +1,254 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+)
+
+// commitMsgHookMarker は gpt-cli がインストールしたフックであることを示す目印です
+const commitMsgHookMarker = "# installed by gpt-cli commit-msg"
+
+// defaultCommitMsgPrompt は commit-msg で使用するプロンプトのデフォルト名です
+const defaultCommitMsgPrompt = "commit-msg"
+
+// runCommitMsgCommand は commit-msg サブコマンドを実行します。
+// ステージ済みの差分からコミットメッセージを生成し、対話的に採用・編集・再生成できます。
+// -hook を指定すると prepare-commit-msg フックとして動作し、メッセージをファイルに書き込みます。
+func runCommitMsgCommand(options Options, config Config, args []string) error {
+	fs := newSubcommandFlagSet("commit-msg")
+	promptName := fs.String("prompt", defaultCommitMsgPrompt, "使用するプロンプト名（config.yamlのprompts）")
+	hookFile := fs.String("hook", "", "prepare-commit-msg フックとして動作し、生成したメッセージを指定ファイルに書き込む")
+	hookSource := fs.String("source", "", "prepare-commit-msg フックに渡されたコミットメッセージの種類")
+	installHook := fs.Bool("install-hook", false, "prepare-commit-msg フックをインストールする")
+	force := fs.Bool("force", false, "既存のフックを上書きする")
+	yes := fs.Bool("y", false, "確認せずに生成したメッセージでコミットする")
+	printOnly := fs.Bool("print", false, "生成したメッセージを表示するだけでコミットしない")
+	if _, err := parseSubcommandFlags(fs, args); err != nil {
+		return err
+	}
+
+	if *installHook {
+		return installCommitMsgHook(options, *force)
+	}
+
+	if *hookFile != "" {
+		// -m や merge など、メッセージが既に与えられている場合は何もしない
+		switch *hookSource {
+		case "message", "merge", "squash", "commit":
+			return nil
+		}
+		if err := writeCommitMsgHook(options, config, *promptName, *hookFile); err != nil {
+			// フックの失敗でコミットを止めないよう、警告のみ表示する
+			logger.Error("コミットメッセージの生成に失敗しました: %v", err)
+		}
+		return nil
+	}
+
+	message, err := GenerateCommitMessage(options, config, *promptName)
+	if err != nil {
+		return err
+	}
+
+	if *printOnly {
+		fmt.Println(message)
+		return nil
+	}
+	if *yes {
+		return gitCommitWithMessage(message)
+	}
+
+	reader := bufio.NewReader(os.Stdin)
+	for {
+		fmt.Printf("\n%s\n\n", message)
+		switch promptLine(reader, "[a]採用してコミット / [e]編集 / [r]再生成 / [q]中止: ") {
+		case "a", "A":
+			return gitCommitWithMessage(message)
+		case "e", "E":
+			edited, err := editInEditor(message, "COMMIT_EDITMSG")
+			if err != nil {
+				return err
+			}
+			if strings.TrimSpace(edited) == "" {
+				fmt.Println("メッセージが空のため中止します。")
+				return nil
+			}
+			message = edited
+		case "r", "R":
+			message, err = GenerateCommitMessage(options, config, *promptName)
+			if err != nil {
+				return err
+			}
+		case "q", "Q", "":
+			fmt.Println("中止しました。")
+			return nil
+		}
+	}
+}
+
+// GenerateCommitMessage は、ステージ済みの差分とプロンプト設定からコミットメッセージを生成します
+func GenerateCommitMessage(options Options, config Config, promptName string) (string, error) {
+	options.PromptOption = promptName
+	options.UserMessage = ""
+	options.GitStaged = true
+	options.GitDiff = false
+	options.GitRange = ""
+
+	promptConfig, err := GetPromptConfig(config, options)
+	if err != nil {
+		return "", err
+	}
+
+	messages, err := CreateMessages(promptConfig)
+	if err != nil {
+		return "", fmt.Errorf("メッセージの作成に失敗しました: %w", err)
+	}
+	messages, err = ApplySecretRedaction(messages, config.Redaction, options.AllowSecrets, os.Stderr)
+	if err != nil {
+		return "", err
+	}
+
+	client, err := NewOpenAIClientWithConfig(config, promptConfig.Provider, promptConfig.Timeout)
+	if err != nil {
+		return "", err
+	}
+
+	assistantMessage, err := ExecuteChatCompletion(client, promptConfig, messages)
+	if err != nil {
+		return "", err
+	}
+
+	return cleanCommitMessage(assistantMessage.Content), nil
+}
+
+// cleanCommitMessage は、モデルの応答からコードブロックの囲みや前後の空白を取り除きます
+func cleanCommitMessage(content string) string {
+	content = strings.TrimSpace(content)
+	if strings.HasPrefix(content, "```") {
+		lines := strings.Split(content, "\n")
+		lines = lines[1:]
+		if len(lines) > 0 && strings.HasPrefix(strings.TrimSpace(lines[len(lines)-1]), "```") {
+			lines = lines[:len(lines)-1]
+		}
+		content = strings.TrimSpace(strings.Join(lines, "\n"))
+	}
+	return content
+}
+
+// writeCommitMsgHook は、生成したメッセージを既存のメッセージファイルの先頭に書き込みます
+func writeCommitMsgHook(options Options, config Config, promptName, hookFile string) error {
+	existing, err := os.ReadFile(hookFile)
+	if err != nil && !os.IsNotExist(err) {
+		return err
+	}
+
+	message, err := GenerateCommitMessage(options, config, promptName)
+	if err != nil {
+		return err
+	}
+
+	return os.WriteFile(hookFile, []byte(message+"\n"+string(existing)), 0644)
+}
+
+// gitCommitWithMessage は、指定されたメッセージで git commit を実行します
+func gitCommitWithMessage(message string) error {
+	tmp, err := os.CreateTemp("", "gpt-cli-commit-*.txt")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+	if _, err := tmp.WriteString(message + "\n"); err != nil {
+		tmp.Close()
+		return err
+	}
+	tmp.Close()
+
+	cmd := exec.Command("git", "commit", "-F", tmp.Name())
+	cmd.Stdin = os.Stdin
+	cmd.Stdout = os.Stdout
+	cmd.Stderr = os.Stderr
+	if err := cmd.Run(); err != nil {
+		return fmt.Errorf("git commit に失敗しました: %w", err)
+	}
+	return nil
+}
+
+// editInEditor は、テキストを一時ファイルに書き出して $EDITOR で開き、編集後の内容を返します。
+// $EDITOR が未設定の場合は vi を使用します。
+func editInEditor(text, name string) (string, error) {
+	tmp, err := os.CreateTemp("", "gpt-cli-*-"+name)
+	if err != nil {
+		return "", err
+	}
+	defer os.Remove(tmp.Name())
+	if _, err := tmp.WriteString(text); err != nil {
+		tmp.Close()
+		return "", err
+	}
+	tmp.Close()
+
+	editor := os.Getenv("EDITOR")
+	if editor == "" {
+		editor = "vi"
+	}
+	// EDITOR に引数が含まれる場合（例: "code --wait"）にも対応するためシェル経由で実行する
+	cmd := exec.Command("sh", "-c", editor+` "$1"`, "sh", tmp.Name())
+	cmd.Stdin = os.Stdin
+	cmd.Stdout = os.Stdout
+	cmd.Stderr = os.Stderr
+	if err := cmd.Run(); err != nil {
+		return "", fmt.Errorf("エディタの実行に失敗しました (%s): %w", editor, err)
+	}
+
+	edited, err := os.ReadFile(tmp.Name())
+	if err != nil {
+		return "", err
+	}
+	return strings.TrimRight(string(edited), "\n"), nil
+}
+
+// installCommitMsgHook は、gpt-cli を呼び出す prepare-commit-msg フックをインストールします
+func installCommitMsgHook(options Options, force bool) error {
+	hookPath, err := runGit("rev-parse", "--git-path", "hooks/prepare-commit-msg")
+	if err != nil {
+		return err
+	}
+	hookPath = strings.TrimSpace(hookPath)
+
+	if existing, err := os.ReadFile(hookPath); err == nil && !force && !strings.Contains(string(existing), commitMsgHookMarker) {
+		return fmt.Errorf("フックが既に存在します (%s)。上書きする場合は -force を指定してください", hookPath)
+	}
+
+	executable, err := os.Executable()
+	if err != nil {
+		return fmt.Errorf("実行ファイルのパスの取得に失敗しました: %w", err)
+	}
+
+	command := shellQuote(executable)
+	if options.ConfigPath != "" {
+		configPath, err := filepath.Abs(options.ConfigPath)
+		if err != nil {
+			return err
+		}
+		command += " -c " + shellQuote(configPath)
+	}
+
+	script := fmt.Sprintf("#!/bin/sh\n%s\n%s commit-msg -hook \"$1\" -source \"$2\" || true\n", commitMsgHookMarker, command)
+
+	if err := EnsureDirectory(filepath.Dir(hookPath)); err != nil {
+		return err
+	}
+	if err := os.WriteFile(hookPath, []byte(script), 0755); err != nil {
+		return fmt.Errorf("フックの書き込みに失敗しました: %w", err)
+	}
+	fmt.Printf("prepare-commit-msg フックをインストールしました: %s\n", hookPath)
+	return nil
+}
+
+// shellQuote は文字列をシェルのシングルクォートで囲みます
+func shellQuote(s string) string {
+	return "'" + strings.ReplaceAll(s, "'", `'\''`) + "'"
+}
@@ -0,0 +1,60 @@
+package main
+
+import (
+	"os"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestCleanCommitMessage(t *testing.T) {
+	got := cleanCommitMessage("```text\nfeat: add commit-msg command\n\n- detail\n```\n")
+	want := "feat: add commit-msg command\n\n- detail"
+	if got != want {
+		t.Errorf("cleanCommitMessage() = %q, 期待値 %q", got, want)
+	}
+}
+
+func TestParseSubcommandFlags(t *testing.T) {
+	fs := newSubcommandFlagSet("test")
+	force := fs.Bool("force", false, "")
+	args, err := parseSubcommandFlags(fs, []string{"a", "-force", "b", "--", "-c"})
+	if err != nil {
+		t.Fatalf("parseSubcommandFlags() エラー: %v", err)
+	}
+	if !*force {
+		t.Errorf("位置引数の後ろのフラグが解析されていません")
+	}
+	if want := []string{"a", "b", "-c"}; !reflect.DeepEqual(args, want) {
+		t.Errorf("parseSubcommandFlags() = %v, 期待値 %v", args, want)
+	}
+}
+
+func TestInstallCommitMsgHook(t *testing.T) {
+	setupGitRepo(t)
+
+	hookPath := ".git/hooks/prepare-commit-msg"
+	if err := os.WriteFile(hookPath, []byte("#!/bin/sh\necho custom\n"), 0755); err != nil {
+		t.Fatalf("フック作成エラー: %v", err)
+	}
+
+	if err := installCommitMsgHook(Options{}, false); err == nil {
+		t.Errorf("既存のフックがある場合にエラーになりませんでした")
+	}
+	if err := installCommitMsgHook(Options{}, true); err != nil {
+		t.Fatalf("installCommitMsgHook() エラー: %v", err)
+	}
+
+	script, err := os.ReadFile(hookPath)
+	if err != nil {
+		t.Fatalf("フック読み込みエラー: %v", err)
+	}
+	if !strings.Contains(string(script), commitMsgHookMarker) || !strings.Contains(string(script), `commit-msg -hook "$1" -source "$2"`) {
+		t.Errorf("フックの内容が想定と異なります: %s", script)
+	}
+
+	// gpt-cli がインストールしたフックは -force なしで更新できる
+	if err := installCommitMsgHook(Options{}, false); err != nil {
+		t.Errorf("installCommitMsgHook() エラー: %v", err)
+	}
+}
@@ -0,0 +1,273 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	openai "github.com/sashabaranov/go-openai"
+	"golang.org/x/term"
+)
+
+// 比較結果の表示形式
+const (
+	CompareViewSections   = "sections"
+	CompareViewSideBySide = "side-by-side"
+	CompareViewDiff       = "diff"
+)
+
+// CompareResult は比較モードでの1つのモデル（またはサンプル）の結果です
+type CompareResult struct {
+	Label   string
+	Model   string
+	Message openai.ChatCompletionMessage
+	Latency time.Duration
+	Usage   openai.Usage
+	Err     error
+}
+
+// CompareTargets は、比較するモデルの一覧からリクエストごとのラベルとモデルを返します。
+// モデルが1つの場合は n 個のサンプルを比較します。
+func CompareTargets(models []string, n int) ([]string, []string, error) {
+	if len(models) == 1 {
+		if n < 2 {
+			return nil, nil, fmt.Errorf("比較するには2つ以上のモデルを指定するか、-n で2以上のサンプル数を指定してください")
+		}
+		var labels, targets []string
+		for i := 1; i <= n; i++ {
+			labels = append(labels, fmt.Sprintf("%s #%d", models[0], i))
+			targets = append(targets, models[0])
+		}
+		return labels, targets, nil
+	}
+	return models, models, nil
+}
+
+// RunComparison は、同じ会話履歴を複数のモデルに並行して送信し、結果を指定した順序で返します
+func RunComparison(client ChatCompletionClient, promptConfig Prompt, conversationHistory []openai.ChatCompletionMessage, labels, models []string) []CompareResult {
+	results := make([]CompareResult, len(models))
+	var wg sync.WaitGroup
+	for i := range models {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			config := promptConfig
+			config.Model = models[i]
+			config.N = 0
+
+			start := time.Now()
+			resp, err := RequestChatCompletion(client, config, conversationHistory)
+			result := CompareResult{Label: labels[i], Model: models[i], Latency: time.Since(start), Err: err}
+			if err == nil {
+				result.Message = resp.Choices[0].Message
+				result.Usage = resp.Usage
+			}
+			results[i] = result
+		}(i)
+	}
+	wg.Wait()
+	return results
+}
+
+// handleCompare は -compare で指定したモデルの回答を比較して表示し、-pick の場合は選択した回答を履歴に追加します
+func handleCompare(client ChatCompletionClient, promptConfig Prompt, conversationHistory []openai.ChatCompletionMessage, options Options) error {
+	models := SplitPatternList(options.CompareModels)
+	labels, targets, err := CompareTargets(models, promptConfig.N)
+	if err != nil {
+		return err
+	}
+
+	results := RunComparison(client, promptConfig, conversationHistory, labels, targets)
+	if err := PrintComparison(os.Stdout, results, options.CompareView, useColor(os.Stdout)); err != nil {
+		return err
+	}
+
+	if !options.Pick {
+		return nil
+	}
+
+	reader, closeReader := terminalReader()
+	defer closeReader()
+	answer := promptLine(reader, fmt.Sprintf("履歴に追加する回答の番号を入力してください [1-%d, Enter でスキップ]: ", len(results)))
+	if answer == "" {
+		return nil
+	}
+	index, err := strconv.Atoi(answer)
+	if err != nil || index < 1 || index > len(results) {
+		return fmt.Errorf("不正な番号が入力されました: %s", answer)
+	}
+	picked := results[index-1]
+	if picked.Err != nil {
+		return fmt.Errorf("エラーになった回答は選択できません: %s", picked.Label)
+	}
+	if options.HistoryFile == "" {
+		return fmt.Errorf("回答を保存するには -history を指定してください")
+	}
+
+	conversationHistory = append(conversationHistory, picked.Message)
+	if err := RecordConversation(options.HistoryFile, conversationHistory, picked.Model, options, picked.Usage); err != nil {
+		return fmt.Errorf("会話履歴の保存に失敗しました: %w", err)
+	}
+	autoPruneHistory(options)
+	fmt.Fprintf(os.Stderr, "%s の回答を履歴に追加しました。\n", picked.Label)
+	return nil
+}
+
+// PrintComparison は比較結果を指定した形式で表示し、最後にレイテンシとトークン使用量の一覧を表示します
+func PrintComparison(w io.Writer, results []CompareResult, view string, color bool) error {
+	switch view {
+	case "", CompareViewSections:
+		for i, result := range results {
+			header := fmt.Sprintf("=== [%d] %s ===", i+1, result.Label)
+			if color {
+				header = ansiBold + ansiCyan + header + ansiReset
+			}
+			fmt.Fprintln(w, header)
+			fmt.Fprintln(w, result.content())
+			fmt.Fprintln(w)
+		}
+	case CompareViewSideBySide:
+		fmt.Fprint(w, renderSideBySide(results, terminalWidth()))
+		fmt.Fprintln(w)
+	case CompareViewDiff:
+		base := results[0]
+		for i, result := range results[1:] {
+			fmt.Fprintf(w, "--- [1] %s\n+++ [%d] %s\n", base.Label, i+2, result.Label)
+			fmt.Fprint(w, FormatDiff(DiffLines(splitLines(base.content()), splitLines(result.content())), color))
+			fmt.Fprintln(w)
+		}
+	default:
+		return fmt.Errorf("不正な比較の表示形式が指定されました: %s (sections, side-by-side, diff)", view)
+	}
+
+	fmt.Fprintln(w, "モデル別の結果:")
+	for i, result := range results {
+		if result.Err != nil {
+			fmt.Fprintf(w, "  [%d] %-24s %6.2fs  エラー\n", i+1, result.Label, result.Latency.Seconds())
+			continue
+		}
+		fmt.Fprintf(w, "  [%d] %-24s %6.2fs  tokens: prompt %d / completion %d / total %d\n",
+			i+1, result.Label, result.Latency.Seconds(),
+			result.Usage.PromptTokens, result.Usage.CompletionTokens, result.Usage.TotalTokens)
+	}
+	return nil
+}
+
+// content は表示する回答の内容（エラーの場合はエラーメッセージ）を返します
+func (r CompareResult) content() string {
+	if r.Err != nil {
+		return fmt.Sprintf("エラー: %v", r.Err)
+	}
+	return strings.TrimRight(r.Message.Content, "\n")
+}
+
+// renderSideBySide は回答を横に並べた列として表示します
+func renderSideBySide(results []CompareResult, width int) string {
+	const separator = " │ "
+	columnWidth := (width - len([]rune(separator))*(len(results)-1)) / len(results)
+	if columnWidth < 10 {
+		columnWidth = 10
+	}
+
+	columns := make([][]string, len(results))
+	rows := 0
+	for i, result := range results {
+		columns[i] = append([]string{fmt.Sprintf("[%d] %s", i+1, result.Label), strings.Repeat("─", columnWidth)},
+			wrapText(result.content(), columnWidth)...)
+		if len(columns[i]) > rows {
+			rows = len(columns[i])
+		}
+	}
+
+	var sb strings.Builder
+	for row := 0; row < rows; row++ {
+		for i, column := range columns {
+			cell := ""
+			if row < len(column) {
+				cell = column[row]
+			}
+			if i < len(columns)-1 {
+				sb.WriteString(padRight(cell, columnWidth))
+				sb.WriteString(separator)
+			} else {
+				sb.WriteString(cell)
+			}
+		}
+		sb.WriteString("\n")
+	}
+	return sb.String()
+}
+
+// wrapText は、表示幅が width を超えないように各行を折り返します
+func wrapText(text string, width int) []string {
+	var lines []string
+	for _, line := range strings.Split(text, "\n") {
+		line = strings.ReplaceAll(line, "\t", "    ")
+		current, currentWidth := []rune{}, 0
+		for _, r := range line {
+			w := runeWidth(r)
+			if currentWidth+w > width {
+				lines = append(lines, string(current))
+				current, currentWidth = nil, 0
+			}
+			current = append(current, r)
+			currentWidth += w
+		}
+		lines = append(lines, string(current))
+	}
+	return lines
+}
+
+// padRight は表示幅が width になるまで空白を追加します
+func padRight(s string, width int) string {
+	w := displayWidth(s)
+	if w >= width {
+		return s
+	}
+	return s + strings.Repeat(" ", width-w)
+}
+
+// displayWidth は文字列の端末上の表示幅を返します
+func displayWidth(s string) int {
+	width := 0
+	for _, r := range s {
+		width += runeWidth(r)
+	}
+	return width
+}
+
+// runeWidth は文字の端末上の表示幅（全角文字は2）を返します
+func runeWidth(r rune) int {
+	switch {
+	case r < 0x1100:
+		return 1
+	case r <= 0x115f, // ハングル字母
+		r >= 0x2e80 && r <= 0xa4cf && r != 0x303f, // CJK、ひらがな、カタカナなど
+		r >= 0xac00 && r <= 0xd7a3,                // ハングル音節
+		r >= 0xf900 && r <= 0xfaff,                // CJK互換漢字
+		r >= 0xfe30 && r <= 0xfe4f,                // CJK互換形
+		r >= 0xff00 && r <= 0xff60,                // 全角英数・記号
+		r >= 0xffe0 && r <= 0xffe6,
+		r >= 0x1f300 && r <= 0x1f64f, // 絵文字
+		r >= 0x1f900 && r <= 0x1f9ff,
+		r >= 0x20000 && r <= 0x3fffd:
+		return 2
+	}
+	return 1
+}
+
+// terminalWidth は端末の幅を返します。
+// 環境変数 COLUMNS、標準出力の端末の幅の順に参照し、取得できない場合は80を返します。
+func terminalWidth() int {
+	if columns, err := strconv.Atoi(os.Getenv("COLUMNS")); err == nil && columns > 0 {
+		return columns
+	}
+	if width, _, err := term.GetSize(int(os.Stdout.Fd())); err == nil && width > 0 {
+		return width
+	}
+	return 80
+}
@@ -0,0 +1,92 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"strings"
+	"sync/atomic"
+	"testing"
+
+	openai "github.com/sashabaranov/go-openai"
+)
+
+// fakeChatClient はモデル名を含む回答を返すテスト用のクライアントです
+type fakeChatClient struct {
+	calls int32
+}
+
+func (c *fakeChatClient) CreateChatCompletion(ctx context.Context, req openai.ChatCompletionRequest) (openai.ChatCompletionResponse, error) {
+	atomic.AddInt32(&c.calls, 1)
+	if req.Model == "broken" {
+		return openai.ChatCompletionResponse{}, fmt.Errorf("モデルが見つかりません")
+	}
+	return openai.ChatCompletionResponse{
+		Choices: []openai.ChatCompletionChoice{{Message: openai.ChatCompletionMessage{
+			Role:    openai.ChatMessageRoleAssistant,
+			Content: "共通の行\n" + req.Model + " の回答",
+		}}},
+		Usage: openai.Usage{PromptTokens: 10, CompletionTokens: 5, TotalTokens: 15},
+	}, nil
+}
+
+func TestRunComparison(t *testing.T) {
+	logger = NewConsoleLogger(false)
+	client := &fakeChatClient{}
+
+	labels, models, err := CompareTargets([]string{"gpt-4o-mini", "gpt-4o", "broken"}, 0)
+	if err != nil {
+		t.Fatalf("CompareTargets() エラー: %v", err)
+	}
+	results := RunComparison(client, Prompt{N: 3}, nil, labels, models)
+	if client.calls != 3 {
+		t.Errorf("リクエスト数 = %d, 期待値 3", client.calls)
+	}
+	if results[1].Message.Content != "共通の行\ngpt-4o の回答" || results[1].Usage.TotalTokens != 15 {
+		t.Errorf("結果の順序または内容が正しくありません: %+v", results[1])
+	}
+	if results[2].Err == nil {
+		t.Errorf("エラーになったモデルの結果にエラーが設定されていません")
+	}
+
+	for _, view := range []string{CompareViewSections, CompareViewSideBySide, CompareViewDiff} {
+		var buf bytes.Buffer
+		if err := PrintComparison(&buf, results, view, false); err != nil {
+			t.Fatalf("PrintComparison(%s) エラー: %v", view, err)
+		}
+		if !strings.Contains(buf.String(), "total 15") {
+			t.Errorf("%s: トークン使用量が表示されていません:\n%s", view, buf.String())
+		}
+	}
+	if err := PrintComparison(&bytes.Buffer{}, results, "table", false); err == nil {
+		t.Errorf("不正な表示形式がエラーになりませんでした")
+	}
+
+	labels, models, err = CompareTargets([]string{"gpt-4o"}, 2)
+	if err != nil || len(models) != 2 || labels[1] != "gpt-4o #2" {
+		t.Errorf("1つのモデルのサンプル比較が正しくありません: %v %v %v", labels, models, err)
+	}
+	if _, _, err := CompareTargets([]string{"gpt-4o"}, 1); err == nil {
+		t.Errorf("比較対象が1つの場合にエラーになりませんでした")
+	}
+}
+
+func TestDiffLines(t *testing.T) {
+	diff := DiffLines([]string{"a", "b", "c"}, []string{"a", "c", "d"})
+	got := FormatDiff(diff, false)
+	want := "  a\n- b\n  c\n+ d\n"
+	if got != want {
+		t.Errorf("FormatDiff() = %q, 期待値 %q", got, want)
+	}
+}
+
+func TestWrapText(t *testing.T) {
+	lines := wrapText("あいうえおabc", 6)
+	want := []string{"あいう", "えおab", "c"}
+	if strings.Join(lines, "|") != strings.Join(want, "|") {
+		t.Errorf("wrapText() = %q, 期待値 %q", lines, want)
+	}
+	if w := displayWidth(padRight("あ", 5)); w != 5 {
+		t.Errorf("padRight() の表示幅 = %d, 期待値 5", w)
+	}
+}
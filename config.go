@@ -16,13 +16,54 @@ import (
 // - MaxTokens: 最大トークン数
 // - Attachments: 添付ファイル名のリスト
 // - Tools: 使用するツール名のリスト
+// - FileContext: -f や -collect で添付するファイル内容の表示形式
+// - AllowShell: テンプレートで shell 関数の使用を許可するかどうか（信頼していないプロジェクトの設定ファイルで定義・継承したプロンプトでは無視します）
+// - Extends: 設定を継承する元のプロンプト名
+// - SystemParts: System の前に連結するスニペット名のリスト
+// - Profile: 基本設定として使用するプロファイル名
+// - Provider: providers に定義した接続先の名前
+// - Temperature, TopP: サンプリングのパラメータ
+// - Timeout: タイムアウト時間（秒）
+// - PresencePenalty, FrequencyPenalty, Stop, Seed, LogitBias: その他のサンプリングのパラメータ
+// - N: 生成する候補の数
+// - ReasoningEffort: 推論モデルの推論の度合い（low, medium, high など）
+// - JSON: JSONモードで応答を要求するかどうか
+// - Schema: 構造化出力に使用するJSONスキーマ（ファイルのパスまたはインラインのJSON）
 type Prompt struct {
-	Model       string   `yaml:"model"`
-	System      string   `yaml:"system"`
-	User        string   `yaml:"user"`
-	MaxTokens   *int     `yaml:"maxTokens"`
-	Attachments []string `yaml:"attachments"`
-	Tools       []string `yaml:"tools"`
+	Model            string            `yaml:"model,omitempty"`
+	System           string            `yaml:"system,omitempty"`
+	User             string            `yaml:"user,omitempty"`
+	MaxTokens        *int              `yaml:"maxTokens,omitempty"`
+	Attachments      []string          `yaml:"attachments,omitempty"`
+	Tools            []string          `yaml:"tools,omitempty"`
+	FileContext      FileContextConfig `yaml:"fileContext,omitempty"`
+	AllowShell       *bool             `yaml:"allowShell,omitempty"`
+	Extends          string            `yaml:"extends,omitempty"`
+	SystemParts      []string          `yaml:"systemParts,omitempty"`
+	Profile          string            `yaml:"profile,omitempty"`
+	Provider         string            `yaml:"provider,omitempty"`
+	Temperature      *float32          `yaml:"temperature,omitempty"`
+	TopP             *float32          `yaml:"topP,omitempty"`
+	Timeout          int               `yaml:"timeout,omitempty"`
+	PresencePenalty  *float32          `yaml:"presencePenalty,omitempty"`
+	FrequencyPenalty *float32          `yaml:"frequencyPenalty,omitempty"`
+	Stop             []string          `yaml:"stop,omitempty"`
+	Seed             *int              `yaml:"seed,omitempty"`
+	LogitBias        map[string]int    `yaml:"logitBias,omitempty"`
+	N                int               `yaml:"n,omitempty"`
+	ReasoningEffort  string            `yaml:"reasoningEffort,omitempty"`
+	JSON             bool              `yaml:"json,omitempty"`
+	Schema           string            `yaml:"schema,omitempty"`
+
+	// responseSchema は GetPromptConfig で Schema から読み込んだスキーマです
+	responseSchema *JSONSchema
+	// untrusted は、信頼していないプロジェクトの設定ファイルのプロンプト、プロファイル、スニペットを含むかどうかです
+	untrusted bool
+}
+
+// shellAllowed は、プロンプトの allowShell でテンプレートの shell 関数が許可されているかを返します
+func (p Prompt) shellAllowed() bool {
+	return p.AllowShell != nil && *p.AllowShell && !p.untrusted
 }
 
 type VectorStoreConfig struct {
@@ -43,17 +84,39 @@ type AssistantConfig struct {
 // - LogDir: ログファイルを保存するディレクトリ
 // - AutoSaveLogs: ログの自動保存を有効にするかどうか
 // - Prompts: プロンプト名とその内容のマッピング
+// - Snippets: プロンプトの systemParts から参照する再利用可能な文章
+// - Include: 追加で読み込む設定ファイルのグロブパターン（このファイルからの相対パス）
+// - API: OpenAI API への接続設定（APIキー、ベースURL、組織ID）
+// - Secrets: ${secret:name} で参照するシークレットの取得方法
+// - Providers: プロファイルやプロンプトの provider で選択する接続先
+// - Profiles: モデルやパラメータの組み合わせに名前を付けたプロファイル
+// - History: 会話履歴のタイトルの自動生成などの設定
+// - Redaction: 送信する前にメッセージから機密情報を取り除く設定
+// - TrustedProjects: すべての設定を使用するプロジェクトのディレクトリ（ユーザーの設定ファイルでのみ指定できます）
 type Config struct {
-	LogDir       string                       `yaml:"logDir"`
-	AutoSaveLogs bool                         `yaml:"autoSaveLogs"`
-	Prompts      map[string]Prompt            `yaml:"prompts"`
-	VectorStores map[string]VectorStoreConfig `yaml:"vectorStores"`
-	Assistants   map[string]AssistantConfig   `yaml:"assistants"`
+	Include         []string                     `yaml:"include"`
+	TrustedProjects []string                     `yaml:"trustedProjects,omitempty"`
+	LogDir          string                       `yaml:"logDir"`
+	AutoSaveLogs    bool                         `yaml:"autoSaveLogs"`
+	History         HistoryConfig                `yaml:"history,omitempty"`
+	Redaction       RedactionConfig              `yaml:"redaction,omitempty"`
+	API             APIConfig                    `yaml:"api,omitempty"`
+	Secrets         map[string]SecretConfig      `yaml:"secrets"`
+	Providers       map[string]APIConfig         `yaml:"providers"`
+	Profiles        map[string]Profile           `yaml:"profiles"`
+	Prompts         map[string]Prompt            `yaml:"prompts"`
+	Snippets        map[string]string            `yaml:"snippets"`
+	VectorStores    map[string]VectorStoreConfig `yaml:"vectorStores"`
+	Assistants      map[string]AssistantConfig   `yaml:"assistants"`
+
+	// untrustedSnippets は、信頼していないプロジェクトの設定ファイルで定義されたスニペットの名前です
+	untrustedSnippets map[string]bool
 }
 
 // LoadConfig は、指定されたファイルパスから設定を読み込む関数です。
 // 設定ファイルがYAML形式であり、内容がConfig構造体にマッピングされます。
 // 引数filePathは設定ファイルの場所を指します。
+// logDir、api、providers、secrets、history.encryption の文字列の値に含まれる ${ENV_VAR} と ${ENV_VAR:-default} は環境変数の値に展開されます。
 // 成功すると、読み込まれたConfigが返され、読み込みに失敗した場合はエラーメッセージが返されます。
 func LoadConfig(filePath string) (Config, error) {
 	var config Config
@@ -81,5 +144,16 @@ func LoadConfig(filePath string) (Config, error) {
 		return config, fmt.Errorf("設定ファイルの解析に失敗しました (%s): %w", cleanPath, err)
 	}
 
+	// 環境変数の参照を展開して再度読み込む
+	var root yaml.Node
+	if err := yaml.Unmarshal(yamlFile, &root); err != nil {
+		return config, fmt.Errorf("設定ファイルの解析に失敗しました (%s): %w", cleanPath, err)
+	}
+	expandEnvInConfig(&root)
+	config = Config{}
+	if err := root.Decode(&config); err != nil {
+		return config, fmt.Errorf("設定ファイルの解析に失敗しました (%s): %w", cleanPath, err)
+	}
+
 	return config, nil
 }
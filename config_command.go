@@ -0,0 +1,133 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// runConfigCommand は config サブコマンドを実行します。
+//   - config show [--origin]: マージ後の設定を表示（--origin で各値の読み込み元のファイルを表示）
+//   - config files: 値の読み込み元になった設定ファイルの一覧を表示
+//   - config validate: 設定ファイルの形式と参照関係を検証（エラーがあれば終了コードが0以外になります）
+func runConfigCommand(options Options, config Config, args []string) error {
+	fs := newSubcommandFlagSet("config")
+	showOrigin := fs.Bool("origin", false, "各値の読み込み元のファイルをコメントとして表示")
+	positional, err := parseSubcommandFlags(fs, args)
+	if err != nil {
+		return err
+	}
+	if len(positional) == 0 {
+		return fmt.Errorf("config のアクションを指定してください (show, files, validate)")
+	}
+
+	switch positional[0] {
+	case "show":
+		mergedConfig, origins, err := LoadConfigurationWithOrigins(options.ConfigPath, options.StrictConfig)
+		if err != nil {
+			return err
+		}
+		return printConfig(mergedConfig, origins, *showOrigin)
+	case "files":
+		_, origins, err := LoadConfigurationWithOrigins(options.ConfigPath, options.StrictConfig)
+		if err != nil {
+			return err
+		}
+		for _, file := range origins.Files() {
+			fmt.Println(file)
+		}
+		return nil
+	case "validate":
+		return validateConfigFiles(options)
+	default:
+		return fmt.Errorf("不正な config のアクションが指定されました: %s", positional[0])
+	}
+}
+
+// isConfigValidateCommand は、引数が config validate サブコマンドかどうかを返します
+func isConfigValidateCommand(args []string) bool {
+	if len(args) == 0 || args[0] != "config" {
+		return false
+	}
+	for _, arg := range args[1:] {
+		if !strings.HasPrefix(arg, "-") {
+			return arg == "validate"
+		}
+	}
+	return false
+}
+
+// Files は、値の読み込み元になったファイルを重複なく返します
+func (o ConfigOrigins) Files() []string {
+	var files []string
+	seen := make(map[string]bool)
+	for _, file := range o {
+		if !seen[file] {
+			seen[file] = true
+			files = append(files, file)
+		}
+	}
+	sort.Strings(files)
+	return files
+}
+
+// maskedConfig は、api と providers のAPIキー、会話履歴の暗号化のパスフレーズ、シークレットのコマンドを伏せ字にしたコピーを返します。
+// シークレットのコマンドには値が直接書かれている場合があるため、コマンド全体を伏せ字にします。
+func maskedConfig(config Config) Config {
+	config.API = config.API.Masked()
+	if config.Providers != nil {
+		providers := make(map[string]APIConfig, len(config.Providers))
+		for name, provider := range config.Providers {
+			providers[name] = provider.Masked()
+		}
+		config.Providers = providers
+	}
+	if config.Secrets != nil {
+		secrets := make(map[string]SecretConfig, len(config.Secrets))
+		for name, secret := range config.Secrets {
+			secret.Command = maskSecret(secret.Command)
+			secrets[name] = secret
+		}
+		config.Secrets = secrets
+	}
+	config.History.Encryption.Passphrase = maskSecret(config.History.Encryption.Passphrase)
+	return config
+}
+
+// printConfig は設定をYAML形式で表示します。
+// showOrigin が true の場合、トップレベルの値とマップの各エントリに読み込み元のファイルをコメントとして付けます。
+// APIキーなどの秘密の値は maskedConfig で伏せ字にして表示します。
+func printConfig(config Config, origins ConfigOrigins, showOrigin bool) error {
+	config = maskedConfig(config)
+
+	var root yaml.Node
+	if err := root.Encode(config); err != nil {
+		return fmt.Errorf("設定の変換に失敗しました: %w", err)
+	}
+
+	if showOrigin && root.Kind == yaml.MappingNode {
+		for i := 0; i+1 < len(root.Content); i += 2 {
+			key, value := root.Content[i], root.Content[i+1]
+			if origin, ok := origins[key.Value]; ok {
+				key.LineComment = origin
+			}
+			if value.Kind != yaml.MappingNode {
+				continue
+			}
+			for j := 0; j+1 < len(value.Content); j += 2 {
+				entry := value.Content[j]
+				if origin, ok := origins[key.Value+"."+entry.Value]; ok {
+					entry.LineComment = origin
+				}
+			}
+		}
+	}
+
+	encoder := yaml.NewEncoder(os.Stdout)
+	encoder.SetIndent(2)
+	defer encoder.Close()
+	return encoder.Encode(&root)
+}
@@ -1,38 +1,339 @@
 package main
 
 import (
+	"bytes"
+	"errors"
 	"fmt"
 	"log"
 	"os"
 	"path/filepath"
+	"reflect"
+	"strings"
+
+	"gopkg.in/yaml.v3"
 )
 
+// ProjectConfigFileName は、カレントディレクトリから親方向に探索するプロジェクトごとの設定ファイル名です
+const ProjectConfigFileName = ".gpt-cli.yaml"
+
+// ConfigOrigins は、設定の各値がどのファイルから読み込まれたかを保持します。
+// キーは "logDir" や "prompts.review" のような、ドット区切りの設定のパスです。
+type ConfigOrigins map[string]string
+
 // LoadConfiguration は、指定されたパスから設定ファイルを読み込み、内容をConfig構造体に格納します。
 // 設定ファイルが存在しない場合や読み込みに失敗した場合は、デフォルト設定を返します。
+// strict が true の場合は、読み込みや解析に失敗した時点でエラーを返します。
 // 引数configPathは設定ファイルのパスを指します。
-func LoadConfiguration(configPath string) (Config, error) {
+func LoadConfiguration(configPath string, strict bool) (Config, error) {
+	config, _, err := LoadConfigurationWithOrigins(configPath, strict)
+	return config, err
+}
+
+// LoadConfigurationWithOrigins は、ユーザーの設定ファイルとプロジェクトの設定ファイル（.gpt-cli.yaml）を
+// 読み込んでマージし、各値の読み込み元とともに返します。
+// マージは、ユーザーの設定、ルートに近いディレクトリの .gpt-cli.yaml、カレントディレクトリに近い .gpt-cli.yaml の順に行い、
+// 後から読み込んだ値が優先されます。各ファイルの include で指定したファイルは、そのファイルの直後に読み込みます。
+// strict が false の場合、読み込めなかったファイルはログに出力して無視します。
+func LoadConfigurationWithOrigins(configPath string, strict bool) (Config, ConfigOrigins, error) {
+	config, origins, errs := loadConfigFiles(configPath)
+	if len(errs) > 0 {
+		if strict {
+			return config, origins, fmt.Errorf("設定ファイルが読み込めません: %w", errs[0])
+		}
+		for _, err := range errs {
+			log.Printf("設定ファイルが読み込めません (%v)。デフォルト設定を使用します。", err)
+		}
+	}
+	return config, origins, nil
+}
+
+// loadConfigFiles は、すべての設定ファイルを読み込んでマージし、読み込めなかったファイルのエラーを返します。
+// -c や GPT_CLI_CONFIG_PATH で明示されていないデフォルトの設定ファイルが存在しない場合はエラーにしません。
+func loadConfigFiles(configPath string) (Config, ConfigOrigins, []error) {
 	// デフォルト設定の定義
-	defaultConfig := Config{
+	config := Config{
 		LogDir:       "",
 		AutoSaveLogs: false,
 		Prompts:      make(map[string]Prompt),
 	}
+	origins := make(ConfigOrigins)
+	visited := make(map[string]bool)
+	var errs []error
 
 	// 設定ファイルのパスを取得
+	explicit := configPath != "" || os.Getenv("GPT_CLI_CONFIG_PATH") != ""
 	configFilePath, err := GetConfigFilePath(configPath)
 	if err != nil {
-		log.Printf("設定ファイルのパスを取得できませんでした (%v)。デフォルト設定を使用します。", err)
-		return defaultConfig, nil
+		errs = append(errs, err)
+	} else if err := mergeConfigFile(&config, origins, configFilePath, visited, true); err != nil {
+		if explicit || !errors.Is(err, os.ErrNotExist) {
+			errs = append(errs, err)
+		} else {
+			logger.Debug("設定ファイルが見つからないため、デフォルト設定を使用します: %v", err)
+		}
+	}
+
+	// プロジェクトの設定ファイルをマージ
+	projectFiles, err := FindProjectConfigFiles()
+	if err != nil {
+		errs = append(errs, fmt.Errorf("プロジェクトの設定ファイルの探索に失敗しました: %w", err))
+	}
+	// trustedProjects はユーザーの設定ファイルの値だけを使用する
+	trusted, trustedOrigin := config.TrustedProjects, origins["trustedProjects"]
+	for _, projectFile := range projectFiles {
+		if err := mergeConfigFile(&config, origins, projectFile, visited, isTrustedProject(trusted, projectFile)); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	config.TrustedProjects = trusted
+	if trustedOrigin != "" {
+		origins["trustedProjects"] = trustedOrigin
+	} else {
+		delete(origins, "trustedProjects")
+	}
+
+	return config, origins, errs
+}
+
+// FindProjectConfigFiles は、カレントディレクトリから親ディレクトリへ .gpt-cli.yaml を探索し、
+// ルートに近いものから順に返します。
+func FindProjectConfigFiles() ([]string, error) {
+	dir, err := os.Getwd()
+	if err != nil {
+		return nil, err
+	}
+
+	var files []string
+	for {
+		candidate := filepath.Join(dir, ProjectConfigFileName)
+		if info, err := os.Stat(candidate); err == nil && !info.IsDir() {
+			files = append([]string{candidate}, files...)
+		}
+		parent := filepath.Dir(dir)
+		if parent == dir {
+			break
+		}
+		dir = parent
+	}
+	return files, nil
+}
+
+// isTrustedProject は、プロジェクトの設定ファイルが trustedProjects のディレクトリ（またはその下）にあるかを返します
+func isTrustedProject(trustedProjects []string, projectFile string) bool {
+	dir, err := filepath.Abs(filepath.Dir(projectFile))
+	if err != nil {
+		return false
+	}
+	for _, trusted := range trustedProjects {
+		if strings.HasPrefix(trusted, "~/") {
+			home, err := os.UserHomeDir()
+			if err != nil {
+				continue
+			}
+			trusted = filepath.Join(home, trusted[2:])
+		}
+		trusted, err := filepath.Abs(trusted)
+		if err != nil {
+			continue
+		}
+		if dir == trusted || strings.HasPrefix(dir, trusted+string(filepath.Separator)) {
+			return true
+		}
+	}
+	return false
+}
+
+// restrictUntrustedConfig は、信頼していないプロジェクトの設定ファイルから、
+// APIキーの送信先やコマンドの実行、機密情報の保護、会話履歴の保存先と削除に関わる設定を取り除き、取り除いた設定の名前を返します。
+func restrictUntrustedConfig(config *Config, keys map[string]bool) []string {
+	var ignored []string
+	for _, key := range []string{"api", "logDir", "redaction", "trustedProjects"} {
+		if keys[key] {
+			ignored = append(ignored, key)
+			delete(keys, key)
+		}
+	}
+	if config.History.Encryption != (HistoryEncryptionConfig{}) {
+		ignored = append(ignored, "history.encryption")
+		config.History.Encryption = HistoryEncryptionConfig{}
+	}
+	if config.History.Retention != (HistoryRetentionConfig{}) {
+		ignored = append(ignored, "history.retention")
+		config.History.Retention = HistoryRetentionConfig{}
+	}
+	for _, name := range sortedKeys(config.Providers) {
+		if provider := config.Providers[name]; provider.BaseURL != "" {
+			ignored = append(ignored, "providers."+name+".baseURL")
+			provider.BaseURL = ""
+			config.Providers[name] = provider
+		}
+	}
+	for _, name := range sortedKeys(config.Secrets) {
+		if secret := config.Secrets[name]; secret.Command != "" {
+			ignored = append(ignored, "secrets."+name+".command")
+			secret.Command = ""
+			config.Secrets[name] = secret
+		}
+	}
+	for _, name := range sortedKeys(config.Prompts) {
+		prompt := config.Prompts[name]
+		if prompt.AllowShell != nil && *prompt.AllowShell {
+			ignored = append(ignored, "prompts."+name+".allowShell")
+		}
+		prompt.AllowShell = nil
+		prompt.untrusted = true
+		config.Prompts[name] = prompt
+	}
+	for name, profile := range config.Profiles {
+		profile.untrusted = true
+		config.Profiles[name] = profile
+	}
+	return ignored
+}
+
+// mergeConfigFile は、設定ファイルを読み込み、ファイルに書かれている値だけを config に上書きします。
+// マップ型の設定（prompts など）はエントリ単位で、構造体の設定（api、history など）はフィールド単位でマージします。
+// include で指定されたファイルは、このファイルの値をマージした後に読み込みます。
+// trusted が false の場合は、restrictUntrustedConfig で取り除いた設定を無視し、警告を出力します。
+func mergeConfigFile(config *Config, origins ConfigOrigins, path string, visited map[string]bool, trusted bool) error {
+	absPath, err := filepath.Abs(path)
+	if err != nil {
+		return err
 	}
+	if visited[absPath] {
+		return nil
+	}
+	visited[absPath] = true
 
-	// 設定ファイルの読み込み
-	config, err := LoadConfig(configFilePath)
+	fileConfig, keys, err := loadConfigDocument(path)
 	if err != nil {
-		log.Printf("設定ファイルが読み込めません (%v)。デフォルト設定を使用します。", err)
-		return defaultConfig, nil
+		return err
+	}
+	if !trusted {
+		if ignored := restrictUntrustedConfig(&fileConfig, keys); len(ignored) > 0 {
+			log.Printf("信頼していないプロジェクトの設定ファイル %s の %s は無視します（使用する場合はユーザーの設定ファイルの trustedProjects にディレクトリを追加してください）", absPath, strings.Join(ignored, ", "))
+		}
 	}
 
-	return config, nil
+	dst := reflect.ValueOf(config).Elem()
+	src := reflect.ValueOf(fileConfig)
+	for i := 0; i < dst.NumField(); i++ {
+		key := yamlFieldName(dst.Type().Field(i))
+		if key == "" || key == "include" || !keys[key] {
+			continue
+		}
+
+		dstField, srcField := dst.Field(i), src.Field(i)
+		switch dstField.Kind() {
+		case reflect.Map:
+			mergeMapEntries(dstField, srcField, origins, key, absPath)
+		case reflect.Struct:
+			mergeStructFields(dstField, srcField)
+			origins[key] = absPath
+		default:
+			dstField.Set(srcField)
+			origins[key] = absPath
+		}
+	}
+
+	// 信頼していないファイルのスニペットを使うプロンプトでは allowShell を無視するため、スニペットの読み込み元を記録する
+	for name := range fileConfig.Snippets {
+		if config.untrustedSnippets == nil {
+			config.untrustedSnippets = make(map[string]bool)
+		}
+		if trusted {
+			delete(config.untrustedSnippets, name)
+		} else {
+			config.untrustedSnippets[name] = true
+		}
+	}
+
+	// include されたファイルをマージ
+	for _, pattern := range fileConfig.Include {
+		if !filepath.IsAbs(pattern) {
+			pattern = filepath.Join(filepath.Dir(absPath), pattern)
+		}
+		matches, err := Glob(pattern)
+		if err != nil {
+			return fmt.Errorf("include のパターンの展開に失敗しました (%s): %w", pattern, err)
+		}
+		for _, match := range matches {
+			if err := mergeConfigFile(config, origins, match, visited, trusted); err != nil {
+				return err
+			}
+		}
+	}
+
+	return nil
+}
+
+// mergeMapEntries は、マップの設定をエントリ単位でマージします
+func mergeMapEntries(dst, src reflect.Value, origins ConfigOrigins, key, absPath string) {
+	if dst.IsNil() {
+		dst.Set(reflect.MakeMap(dst.Type()))
+	}
+	iter := src.MapRange()
+	for iter.Next() {
+		dst.SetMapIndex(iter.Key(), iter.Value())
+		if origins != nil {
+			origins[fmt.Sprintf("%s.%v", key, iter.Key())] = absPath
+		}
+	}
+}
+
+// mergeStructFields は、構造体の設定のうちゼロ値でないフィールドだけを上書きします。
+// 入れ子の構造体はフィールド単位で、マップはエントリ単位でマージします。
+func mergeStructFields(dst, src reflect.Value) {
+	for i := 0; i < dst.NumField(); i++ {
+		if !dst.Type().Field(i).IsExported() {
+			continue
+		}
+		dstField, srcField := dst.Field(i), src.Field(i)
+		switch {
+		case dstField.Kind() == reflect.Struct:
+			mergeStructFields(dstField, srcField)
+		case srcField.IsZero():
+		case dstField.Kind() == reflect.Map:
+			mergeMapEntries(dstField, srcField, nil, "", "")
+		default:
+			dstField.Set(srcField)
+		}
+	}
+}
+
+// loadConfigDocument は、設定ファイルを読み込み、内容とファイルに書かれているトップレベルのキーを返します
+func loadConfigDocument(path string) (Config, map[string]bool, error) {
+	config, err := LoadConfig(path)
+	if err != nil {
+		return config, nil, err
+	}
+
+	keys := make(map[string]bool)
+	data, err := os.ReadFile(filepath.Clean(path))
+	if err != nil {
+		return config, nil, err
+	}
+	var root yaml.Node
+	if err := yaml.NewDecoder(bytes.NewReader(data)).Decode(&root); err != nil {
+		// 空のファイルはキーなしとして扱う
+		return config, keys, nil
+	}
+	if len(root.Content) > 0 && root.Content[0].Kind == yaml.MappingNode {
+		mapping := root.Content[0]
+		for i := 0; i+1 < len(mapping.Content); i += 2 {
+			keys[mapping.Content[i].Value] = true
+		}
+	}
+	return config, keys, nil
+}
+
+// yamlFieldName は構造体のフィールドの yaml タグからキー名を返します
+func yamlFieldName(field reflect.StructField) string {
+	name, _, _ := strings.Cut(field.Tag.Get("yaml"), ",")
+	if name == "-" {
+		return ""
+	}
+	return name
 }
 
 // GetConfigFilePath は、設定ファイルのパスを取得するための関数です。
@@ -0,0 +1,197 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"regexp"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// APIConfig は OpenAI API への接続設定です。
+// 各値には ${ENV_VAR} や ${secret:name} の形式で環境変数やシークレットを参照できます。
+type APIConfig struct {
+	APIKey  string `yaml:"apiKey,omitempty"`
+	BaseURL string `yaml:"baseURL,omitempty"`
+	OrgID   string `yaml:"orgID,omitempty"`
+}
+
+// SecretConfig はシークレットの取得方法です。env、file、command のいずれか1つを指定します。
+//   - Env: 環境変数名
+//   - File: 内容をシークレットとして読み込むファイルのパス（前後の空白は取り除きます）
+//   - Command: 標準出力をシークレットとして使用するシェルコマンド（例: pass show openai）
+//     信頼していないプロジェクトの設定ファイルに書かれたコマンドは、読み込み時に取り除きます（restrictUntrustedConfig）
+type SecretConfig struct {
+	Env     string `yaml:"env,omitempty"`
+	File    string `yaml:"file,omitempty"`
+	Command string `yaml:"command,omitempty"`
+}
+
+// envReferencePattern は ${VAR} と ${VAR:-default} に一致する正規表現です
+var envReferencePattern = regexp.MustCompile(`\$\{([A-Za-z_][A-Za-z0-9_]*)(?::-([^}]*))?\}`)
+
+// secretReferencePattern は ${secret:name} に一致する正規表現です
+var secretReferencePattern = regexp.MustCompile(`\$\{secret:([A-Za-z0-9_.-]+)\}`)
+
+// resolvedSecrets は取得済みのシークレットのキャッシュです（コマンドを何度も実行しないため）
+var resolvedSecrets = make(map[string]string)
+
+// ExpandEnvReferences は、文字列中の ${VAR} を環境変数の値に置き換えます。
+// ${VAR:-default} は環境変数が未設定または空の場合に default を使用します。
+// 未設定でデフォルト値もない参照は、そのまま残します。
+func ExpandEnvReferences(s string) string {
+	if !strings.Contains(s, "${") {
+		return s
+	}
+	return envReferencePattern.ReplaceAllStringFunc(s, func(ref string) string {
+		m := envReferencePattern.FindStringSubmatch(ref)
+		if value := os.Getenv(m[1]); value != "" {
+			return value
+		}
+		if strings.Contains(ref, ":-") {
+			return m[2]
+		}
+		return ref
+	})
+}
+
+// envExpandedKeys は、環境変数の参照を展開する設定のパスです。
+// プロンプトの本文などに環境変数の値が入って送信されたり、コード例の ${VAR} が書き換わったりしないよう、
+// 接続先やシークレット、パスの設定に限ります。
+var envExpandedKeys = [][]string{
+	{"logDir"},
+	{"api"},
+	{"providers"},
+	{"secrets"},
+	{"history", "encryption"},
+}
+
+// expandEnvInConfig は、設定ファイルの envExpandedKeys の値に含まれる環境変数の参照を展開します
+func expandEnvInConfig(root *yaml.Node) {
+	if root.Kind != yaml.DocumentNode || len(root.Content) == 0 {
+		return
+	}
+	for _, path := range envExpandedKeys {
+		node := root.Content[0]
+		for _, key := range path {
+			if node = mappingValue(node, key); node == nil {
+				break
+			}
+		}
+		if node != nil {
+			expandEnvInNode(node)
+		}
+	}
+}
+
+// mappingValue は、YAMLのマッピングからキーに対応する値を返します。見つからない場合は nil を返します。
+func mappingValue(node *yaml.Node, key string) *yaml.Node {
+	if node.Kind != yaml.MappingNode {
+		return nil
+	}
+	for i := 0; i+1 < len(node.Content); i += 2 {
+		if node.Content[i].Value == key {
+			return node.Content[i+1]
+		}
+	}
+	return nil
+}
+
+// expandEnvInNode は、YAMLの文字列の値に含まれる環境変数の参照を展開します（キーは展開しません）
+func expandEnvInNode(node *yaml.Node) {
+	switch node.Kind {
+	case yaml.DocumentNode, yaml.SequenceNode:
+		for _, child := range node.Content {
+			expandEnvInNode(child)
+		}
+	case yaml.MappingNode:
+		for i := 1; i < len(node.Content); i += 2 {
+			expandEnvInNode(node.Content[i])
+		}
+	case yaml.ScalarNode:
+		if node.Tag == "!!str" {
+			node.Value = ExpandEnvReferences(node.Value)
+		}
+	}
+}
+
+// ResolveSecret は secrets に定義されたシークレットを取得します
+func ResolveSecret(config Config, name string) (string, error) {
+	if value, ok := resolvedSecrets[name]; ok {
+		return value, nil
+	}
+
+	secret, ok := config.Secrets[name]
+	if !ok {
+		return "", fmt.Errorf("シークレット %s は secrets に定義されていません", name)
+	}
+
+	var value string
+	switch {
+	case secret.Env != "":
+		value = os.Getenv(secret.Env)
+		if value == "" {
+			return "", fmt.Errorf("シークレット %s の環境変数 %s が設定されていません", name, secret.Env)
+		}
+	case secret.File != "":
+		path := secret.File
+		if strings.HasPrefix(path, "~/") {
+			home, err := os.UserHomeDir()
+			if err != nil {
+				return "", fmt.Errorf("ホームディレクトリの取得に失敗しました: %w", err)
+			}
+			path = filepath.Join(home, path[2:])
+		}
+		data, err := os.ReadFile(filepath.Clean(path))
+		if err != nil {
+			return "", fmt.Errorf("シークレット %s のファイルの読み込みに失敗しました: %w", name, err)
+		}
+		value = strings.TrimSpace(string(data))
+	case secret.Command != "":
+		cmd := exec.Command("sh", "-c", secret.Command)
+		cmd.Stderr = os.Stderr
+		out, err := cmd.Output()
+		if err != nil {
+			// コマンドの出力にシークレットが含まれる可能性があるため、エラーには含めない
+			return "", fmt.Errorf("シークレット %s のコマンドの実行に失敗しました: %w", name, err)
+		}
+		value = strings.TrimSpace(string(out))
+	default:
+		return "", fmt.Errorf("シークレット %s に env、file、command のいずれも指定されていません", name)
+	}
+
+	resolvedSecrets[name] = value
+	return value, nil
+}
+
+// ResolveSecretReferences は、文字列中の ${secret:name} をシークレットの値に置き換えます
+func ResolveSecretReferences(config Config, s string) (string, error) {
+	var resolveErr error
+	resolved := secretReferencePattern.ReplaceAllStringFunc(s, func(ref string) string {
+		name := secretReferencePattern.FindStringSubmatch(ref)[1]
+		value, err := ResolveSecret(config, name)
+		if err != nil && resolveErr == nil {
+			resolveErr = err
+		}
+		return value
+	})
+	return resolved, resolveErr
+}
+
+// maskSecret は、ログや表示に出力するためにシークレットを伏せ字にします。
+// ${secret:name} のような未解決の参照はそのまま返します。
+func maskSecret(s string) string {
+	if s == "" || secretReferencePattern.MatchString(s) && secretReferencePattern.ReplaceAllString(s, "") == "" {
+		return s
+	}
+	return "********"
+}
+
+// Masked は APIキーを伏せ字にしたコピーを返します
+func (a APIConfig) Masked() APIConfig {
+	a.APIKey = maskSecret(a.APIKey)
+	return a
+}
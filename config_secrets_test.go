@@ -0,0 +1,113 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestLoadConfigExpandsEnv(t *testing.T) {
+	t.Setenv("GPT_CLI_TEST_LOG_DIR", "/tmp/from-env")
+	t.Setenv("GPT_CLI_TEST_EMPTY", "")
+	path := filepath.Join(t.TempDir(), "config.yaml")
+	content := `
+logDir: ${GPT_CLI_TEST_LOG_DIR}/logs
+api:
+  apiKey: ${secret:openai}
+  baseURL: ${GPT_CLI_TEST_EMPTY:-https://example.com/v1}
+  orgID: ${GPT_CLI_TEST_UNDEFINED}
+secrets:
+  openai:
+    command: echo sk-test
+prompts:
+  shell:
+    system: 'echo "${GPT_CLI_TEST_LOG_DIR}"'
+`
+	if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+		t.Fatalf("ファイル作成エラー: %v", err)
+	}
+
+	config, err := LoadConfig(path)
+	if err != nil {
+		t.Fatalf("LoadConfig() エラー: %v", err)
+	}
+	if config.LogDir != "/tmp/from-env/logs" {
+		t.Errorf("LogDir = %s", config.LogDir)
+	}
+	if config.API.BaseURL != "https://example.com/v1" {
+		t.Errorf("デフォルト値が使われていません: %s", config.API.BaseURL)
+	}
+	if config.API.OrgID != "${GPT_CLI_TEST_UNDEFINED}" {
+		t.Errorf("未設定の環境変数の参照はそのまま残すはずです: %s", config.API.OrgID)
+	}
+	if got := config.Prompts["shell"].System; got != `echo "${GPT_CLI_TEST_LOG_DIR}"` {
+		t.Errorf("プロンプトの環境変数の参照は展開しないはずです: %s", got)
+	}
+	if config.API.APIKey != "${secret:openai}" {
+		t.Errorf("シークレットの参照は読み込み時に解決しないはずです: %s", config.API.APIKey)
+	}
+
+	api, err := resolveAPIConfig(config, config.API)
+	if err != nil {
+		t.Fatalf("resolveAPIConfig() エラー: %v", err)
+	}
+	if api.APIKey != "sk-test" {
+		t.Errorf("シークレットが解決されていません: %s", api.APIKey)
+	}
+	if masked := api.Masked().APIKey; masked == "sk-test" {
+		t.Errorf("APIキーが伏せ字になっていません: %s", masked)
+	}
+}
+
+func TestResolveSecret(t *testing.T) {
+	secretFile := filepath.Join(t.TempDir(), "key")
+	if err := os.WriteFile(secretFile, []byte("from-file\n"), 0600); err != nil {
+		t.Fatalf("ファイル作成エラー: %v", err)
+	}
+	t.Setenv("GPT_CLI_TEST_SECRET", "from-env")
+
+	config := Config{Secrets: map[string]SecretConfig{
+		"file":    {File: secretFile},
+		"env":     {Env: "GPT_CLI_TEST_SECRET"},
+		"missing": {Env: "GPT_CLI_TEST_SECRET_UNDEFINED"},
+	}}
+	tests := map[string]string{"file": "from-file", "env": "from-env"}
+	for name, want := range tests {
+		got, err := ResolveSecret(config, name)
+		if err != nil || got != want {
+			t.Errorf("ResolveSecret(%s) = %q, %v; 期待値 %q", name, got, err, want)
+		}
+	}
+	if _, err := ResolveSecret(config, "missing"); err == nil {
+		t.Errorf("未設定の環境変数がエラーになりませんでした")
+	}
+	if _, err := ResolveSecret(config, "undefined"); err == nil {
+		t.Errorf("未定義のシークレットがエラーになりませんでした")
+	}
+}
+
+func TestMaskedConfig(t *testing.T) {
+	config := Config{
+		API:       APIConfig{APIKey: "sk-secret", BaseURL: "https://example.com/v1"},
+		Providers: map[string]APIConfig{"groq": {APIKey: "gsk-secret"}, "local": {APIKey: "${secret:local}"}},
+		Secrets:   map[string]SecretConfig{"token": {Command: "echo sk-inline"}, "env": {Env: "MY_TOKEN"}},
+		History:   HistoryConfig{Encryption: HistoryEncryptionConfig{Passphrase: "correct horse"}},
+	}
+
+	masked := maskedConfig(config)
+	if masked.API.APIKey == "sk-secret" || masked.API.BaseURL != "https://example.com/v1" {
+		t.Errorf("api が正しく伏せ字になっていません: %+v", masked.API)
+	}
+	if masked.Providers["groq"].APIKey == "gsk-secret" || masked.Providers["local"].APIKey != "${secret:local}" {
+		t.Errorf("providers が正しく伏せ字になっていません: %+v", masked.Providers)
+	}
+	if masked.Secrets["token"].Command == "echo sk-inline" || masked.Secrets["env"].Env != "MY_TOKEN" {
+		t.Errorf("secrets が正しく伏せ字になっていません: %+v", masked.Secrets)
+	}
+	if masked.History.Encryption.Passphrase == "correct horse" {
+		t.Errorf("history.encryption.passphrase が伏せ字になっていません")
+	}
+	if config.Providers["groq"].APIKey != "gsk-secret" || config.Secrets["token"].Command != "echo sk-inline" {
+		t.Errorf("元の設定が変更されました: %+v %+v", config.Providers, config.Secrets)
+	}
+}
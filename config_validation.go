@@ -0,0 +1,267 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+)
+
+// 検証結果の重要度
+const (
+	ValidationError   = "ERROR"
+	ValidationWarning = "WARN"
+)
+
+// ValidationIssue は設定の検証で見つかった問題です
+type ValidationIssue struct {
+	Level   string
+	Path    string
+	Message string
+}
+
+func (i ValidationIssue) String() string {
+	return fmt.Sprintf("%-5s %s: %s", i.Level, i.Path, i.Message)
+}
+
+// ValidateConfig は、マージ後の設定の参照関係を検証します。
+// toolConfig が nil の場合、プロンプトのツールの存在確認は行わず警告を返します。
+func ValidateConfig(config Config, toolConfig *ToolConfig) []ValidationIssue {
+	var issues []ValidationIssue
+	add := func(level, path, format string, args ...interface{}) {
+		issues = append(issues, ValidationIssue{Level: level, Path: path, Message: fmt.Sprintf(format, args...)})
+	}
+
+	// アシスタントのベクトルストア名
+	for _, name := range sortedKeys(config.Assistants) {
+		assistant := config.Assistants[name]
+		if assistant.VectorStoreName == "" {
+			continue
+		}
+		if !vectorStoreDefined(config, assistant.VectorStoreName) {
+			add(ValidationError, "assistants."+name+".vectorStoreName", "ベクトルストア %s は vectorStores に定義されていません", assistant.VectorStoreName)
+		}
+	}
+
+	// シークレット
+	for _, name := range sortedKeys(config.Secrets) {
+		secret := config.Secrets[name]
+		sources := 0
+		for _, source := range []string{secret.Env, secret.File, secret.Command} {
+			if source != "" {
+				sources++
+			}
+		}
+		if sources != 1 {
+			add(ValidationError, "secrets."+name, "env、file、command のいずれか1つを指定してください")
+		}
+	}
+	apiFields := []struct{ name, value string }{
+		{"apiKey", config.API.APIKey},
+		{"baseURL", config.API.BaseURL},
+		{"orgID", config.API.OrgID},
+	}
+	for _, field := range apiFields {
+		for _, m := range secretReferencePattern.FindAllStringSubmatch(field.value, -1) {
+			if _, ok := config.Secrets[m[1]]; !ok {
+				add(ValidationError, "api."+field.name, "シークレット %s は secrets に定義されていません", m[1])
+			}
+		}
+	}
+
+	// 会話履歴の暗号化
+	encryption := config.History.Encryption
+	for _, m := range secretReferencePattern.FindAllStringSubmatch(encryption.Passphrase, -1) {
+		if _, ok := config.Secrets[m[1]]; !ok {
+			add(ValidationError, "history.encryption.passphrase", "シークレット %s は secrets に定義されていません", m[1])
+		}
+	}
+	switch {
+	case encryption.Enabled && encryption.IdentityFile == "" && encryption.Passphrase == "":
+		add(ValidationError, "history.encryption", "暗号化するには identityFile または passphrase を指定してください")
+	case encryption.IdentityFile != "" && encryption.Passphrase != "":
+		add(ValidationWarning, "history.encryption", "identityFile と passphrase の両方が指定されています（identityFile を使用します）")
+	}
+
+	// 機密情報の伏せ字
+	switch config.Redaction.ModeName() {
+	case RedactionModeMask, RedactionModeBlock, RedactionModeOff:
+	default:
+		add(ValidationError, "redaction.mode", "mask、block、off のいずれかを指定してください: %s", config.Redaction.Mode)
+	}
+	for i, pattern := range config.Redaction.Patterns {
+		if pattern.Name == "" {
+			add(ValidationError, fmt.Sprintf("redaction.patterns[%d].name", i), "名前を指定してください")
+		}
+		if _, err := regexp.Compile(pattern.Pattern); err != nil {
+			add(ValidationError, fmt.Sprintf("redaction.patterns[%d].pattern", i), "正規表現が不正です: %v", err)
+		}
+	}
+	for i, allow := range config.Redaction.Allow {
+		if _, err := regexp.Compile(allow); err != nil {
+			add(ValidationError, fmt.Sprintf("redaction.allow[%d]", i), "正規表現が不正です: %v", err)
+		}
+	}
+
+	// プロファイル
+	for _, name := range sortedKeys(config.Profiles) {
+		if provider := config.Profiles[name].Provider; provider != "" {
+			if _, ok := config.Providers[provider]; !ok {
+				add(ValidationError, "profiles."+name+".provider", "プロバイダー %s は providers に定義されていません", provider)
+			}
+		}
+	}
+
+	// プロンプト
+	toolsWarned := false
+	for _, name := range sortedKeys(config.Prompts) {
+		prompt := config.Prompts[name]
+		path := "prompts." + name
+
+		resolved, err := ResolvePrompt(config, name)
+		if err != nil {
+			add(ValidationError, path, "%v", err)
+			resolved = prompt
+		}
+
+		if resolved.Profile != "" {
+			if _, ok := config.Profiles[resolved.Profile]; !ok {
+				add(ValidationError, path+".profile", "プロファイル %s は profiles に定義されていません", resolved.Profile)
+			}
+		}
+		if resolved.Provider != "" {
+			if _, ok := config.Providers[resolved.Provider]; !ok {
+				add(ValidationError, path+".provider", "プロバイダー %s は providers に定義されていません", resolved.Provider)
+			}
+		}
+
+		if resolved.Schema != "" {
+			if _, err := LoadJSONSchema(resolved.Schema); err != nil {
+				add(ValidationError, path+".schema", "%v", err)
+			}
+		}
+
+		switch resolved.FileContext.Format {
+		case "", FileFormatPlain, FileFormatMarkdown, FileFormatXML:
+		default:
+			add(ValidationError, path+".fileContext.format", "サポートされていない形式です: %s (plain, markdown, xml)", resolved.FileContext.Format)
+		}
+
+		for _, tool := range resolved.Tools {
+			if toolConfig == nil {
+				if !toolsWarned {
+					add(ValidationWarning, path+".tools", "-tool-config が指定されていないため、ツールの存在を確認できません")
+					toolsWarned = true
+				}
+				break
+			}
+			if _, ok := toolConfig.Tools[tool]; !ok {
+				add(ValidationError, path+".tools", "ツール %s はツール設定ファイルに定義されていません", tool)
+			}
+		}
+
+		for _, attachment := range resolved.Attachments {
+			matches, err := ExpandPatterns([]string{attachment})
+			if err != nil {
+				add(ValidationError, path+".attachments", "%v", err)
+				continue
+			}
+			if len(matches) == 0 {
+				add(ValidationError, path+".attachments", "添付ファイル %s に一致するファイルがありません", attachment)
+			}
+			for _, match := range matches {
+				if _, err := os.Stat(match); err != nil {
+					add(ValidationError, path+".attachments", "添付ファイル %s が見つかりません", match)
+				} else if getMimeType(filepath.Ext(match)) == "" {
+					add(ValidationWarning, path+".attachments", "添付ファイル %s はサポートされていない画像形式です", match)
+				}
+			}
+		}
+	}
+
+	return issues
+}
+
+// vectorStoreDefined は、名前が vectorStores のキーまたは name に一致するかを返します
+func vectorStoreDefined(config Config, name string) bool {
+	if _, ok := config.VectorStores[name]; ok {
+		return true
+	}
+	for _, vs := range config.VectorStores {
+		if vs.Name == name {
+			return true
+		}
+	}
+	return false
+}
+
+// sortedKeys はマップのキーを昇順に並べて返します
+func sortedKeys[V any](m map[string]V) []string {
+	keys := make([]string, 0, len(m))
+	for key := range m {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// validateConfigFiles は、すべての設定ファイルの読み込み・解析（未知のフィールドや型の誤り）と
+// 参照関係を検証し、見つかった問題を表示します。エラーがある場合はエラーを返します。
+func validateConfigFiles(options Options) error {
+	config, origins, loadErrors := loadConfigFiles(options.ConfigPath)
+
+	var issues []ValidationIssue
+	for _, err := range loadErrors {
+		issues = append(issues, ValidationIssue{Level: ValidationError, Path: "schema", Message: err.Error()})
+	}
+
+	var toolConfig *ToolConfig
+	if options.ToolConfigPath != "" {
+		tc, err := LoadToolConfig(options.ToolConfigPath)
+		if err != nil {
+			issues = append(issues, ValidationIssue{Level: ValidationError, Path: "tool-config", Message: err.Error()})
+		} else {
+			toolConfig = &tc
+		}
+	}
+
+	for _, issue := range ValidateConfig(config, toolConfig) {
+		if origin, ok := origins[issue.originKey()]; ok {
+			issue.Message += fmt.Sprintf(" (%s)", origin)
+		}
+		issues = append(issues, issue)
+	}
+
+	for _, file := range origins.Files() {
+		fmt.Printf("OK    %s\n", file)
+	}
+
+	errorCount := 0
+	for _, issue := range issues {
+		fmt.Println(issue)
+		if issue.Level == ValidationError {
+			errorCount++
+		}
+	}
+
+	if errorCount > 0 {
+		return fmt.Errorf("設定に %d 件のエラーがあります", errorCount)
+	}
+	fmt.Println("設定に問題はありません。")
+	return nil
+}
+
+// originKey は、問題のパスから読み込み元を調べるためのキー（"prompts.name" など）を返します
+func (i ValidationIssue) originKey() string {
+	depth := 0
+	for j, r := range i.Path {
+		if r == '.' {
+			depth++
+			if depth == 2 {
+				return i.Path[:j]
+			}
+		}
+	}
+	return i.Path
+}
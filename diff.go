@@ -0,0 +1,146 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+)
+
+// 差分の行の種類
+const (
+	DiffEqual  = ' '
+	DiffDelete = '-'
+	DiffInsert = '+'
+)
+
+// DiffLine は行単位の差分の1行です
+type DiffLine struct {
+	Kind byte
+	Text string
+}
+
+// DiffLines は、最長共通部分列（LCS）を使って a から b への行単位の差分を返します
+func DiffLines(a, b []string) []DiffLine {
+	// lcs[i][j] は a[i:] と b[j:] の最長共通部分列の長さ
+	lcs := make([][]int, len(a)+1)
+	for i := range lcs {
+		lcs[i] = make([]int, len(b)+1)
+	}
+	for i := len(a) - 1; i >= 0; i-- {
+		for j := len(b) - 1; j >= 0; j-- {
+			if a[i] == b[j] {
+				lcs[i][j] = lcs[i+1][j+1] + 1
+			} else if lcs[i+1][j] >= lcs[i][j+1] {
+				lcs[i][j] = lcs[i+1][j]
+			} else {
+				lcs[i][j] = lcs[i][j+1]
+			}
+		}
+	}
+
+	var diff []DiffLine
+	i, j := 0, 0
+	for i < len(a) && j < len(b) {
+		switch {
+		case a[i] == b[j]:
+			diff = append(diff, DiffLine{DiffEqual, a[i]})
+			i++
+			j++
+		case lcs[i+1][j] >= lcs[i][j+1]:
+			diff = append(diff, DiffLine{DiffDelete, a[i]})
+			i++
+		default:
+			diff = append(diff, DiffLine{DiffInsert, b[j]})
+			j++
+		}
+	}
+	for ; i < len(a); i++ {
+		diff = append(diff, DiffLine{DiffDelete, a[i]})
+	}
+	for ; j < len(b); j++ {
+		diff = append(diff, DiffLine{DiffInsert, b[j]})
+	}
+	return diff
+}
+
+// splitLines は文字列を行に分割します（末尾の改行は無視します）
+func splitLines(s string) []string {
+	s = strings.TrimSuffix(s, "\n")
+	if s == "" {
+		return nil
+	}
+	return strings.Split(s, "\n")
+}
+
+// FormatDiff は差分を "-"、"+"、" " を先頭に付けた行として整形します。
+// color が true の場合、削除行を赤、追加行を緑で表示します。
+func FormatDiff(diff []DiffLine, color bool) string {
+	var sb strings.Builder
+	for _, line := range diff {
+		text := fmt.Sprintf("%c %s", line.Kind, line.Text)
+		if color {
+			switch line.Kind {
+			case DiffDelete:
+				text = ansiRed + text + ansiReset
+			case DiffInsert:
+				text = ansiGreen + text + ansiReset
+			}
+		}
+		sb.WriteString(text)
+		sb.WriteString("\n")
+	}
+	return sb.String()
+}
+
+// DiffHunk は差分のうち、変更のある行とその前後の行のまとまりです
+// - OldStart, NewStart: まとまりの先頭の行の、変更前と変更後の行番号（1から数える）
+type DiffHunk struct {
+	OldStart int
+	NewStart int
+	Lines    []DiffLine
+}
+
+// DiffHunks は、差分を変更のある行とその前後 context 行ずつからなるまとまりに分割します
+func DiffHunks(diff []DiffLine, context int) []DiffHunk {
+	var hunks []DiffHunk
+	start, end := -1, -1
+	flush := func() {
+		hunk := DiffHunk{OldStart: 1, NewStart: 1, Lines: diff[start:end]}
+		for _, line := range diff[:start] {
+			if line.Kind != DiffInsert {
+				hunk.OldStart++
+			}
+			if line.Kind != DiffDelete {
+				hunk.NewStart++
+			}
+		}
+		hunks = append(hunks, hunk)
+	}
+
+	for i, line := range diff {
+		if line.Kind == DiffEqual {
+			continue
+		}
+		from := max(i-context, 0)
+		if start >= 0 && from > end {
+			flush()
+			start = -1
+		}
+		if start < 0 {
+			start = from
+		}
+		end = min(i+context+1, len(diff))
+	}
+	if start >= 0 {
+		flush()
+	}
+	return hunks
+}
+
+// ANSIエスケープシーケンス
+const (
+	ansiReset = "\033[0m"
+	ansiBold  = "\033[1m"
+	ansiRed   = "\033[31m"
+	ansiGreen = "\033[32m"
+	ansiCyan  = "\033[36m"
+)
@@ -0,0 +1,508 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// editInstructions は -edit の場合にシステムメッセージに追加する、変更の回答形式の指示です
+const editInstructions = `ファイルを変更する場合は、変更ごとに次の SEARCH/REPLACE ブロックの形式で回答してください。
+
+path/to/file.go
+<<<<<<< SEARCH
+変更前のコード（空白やインデントも含めてファイルの内容と完全に一致する連続した行）
+=======
+変更後のコード
+>>>>>>> REPLACE
+
+- ファイルのパスはブロックの直前の行に、与えられたファイルと同じパスで書いてください。
+- SEARCH には変更箇所を一意に特定できるだけの行を含め、行番号は含めないでください。
+- 1つのファイルに複数の変更がある場合は、ブロックを複数書いてください。
+- 新しいファイルを作成する場合は、SEARCH を空にしてください。
+- unified diff 形式（--- a/path、+++ b/path、@@ で始まる差分）で回答しても構いません。`
+
+// EditHunk はファイルに対する1つの変更です。Search に一致する行を Replace に置き換えます。
+// - Search: 変更前の行。空の場合は新規ファイルの作成（Line が 1 以上の場合は Line 行目の後への挿入）
+// - Replace: 変更後の行
+// - Line: unified diff の @@ に書かれた変更前の開始行。Search が複数の箇所に一致する場合に最も近い箇所を選びます（不明な場合は0）
+type EditHunk struct {
+	Search  string
+	Replace string
+	Line    int
+}
+
+// FileEdit は1つのファイルに対する変更の一覧です
+type FileEdit struct {
+	Path  string
+	Hunks []EditHunk
+}
+
+// RejectedHunk は適用できなかった変更とその理由です
+type RejectedHunk struct {
+	Hunk   EditHunk
+	Reason string
+}
+
+// EditResult はファイルに変更を適用した結果です
+type EditResult struct {
+	Path     string
+	Exists   bool
+	Original string
+	Updated  string
+	Applied  int
+	Rejected []RejectedHunk
+}
+
+// Changed はファイルの内容が変わるかどうかを返します
+func (r EditResult) Changed() bool {
+	return r.Updated != r.Original
+}
+
+var (
+	searchMarkerPattern  = regexp.MustCompile(`^<{5,9} ?SEARCH\s*$`)
+	dividerMarkerPattern = regexp.MustCompile(`^={5,9}\s*$`)
+	replaceMarkerPattern = regexp.MustCompile(`^>{5,9} ?REPLACE\s*$`)
+	hunkHeaderPattern    = regexp.MustCompile(`^@@ -(\d+)(?:,(\d+))? \+\d+(?:,\d+)? @@`)
+)
+
+// ParseEdits は、応答から SEARCH/REPLACE ブロックと unified diff の変更を取り出し、ファイルごとにまとめて返します
+func ParseEdits(response string) ([]FileEdit, error) {
+	lines := splitLines(strings.ReplaceAll(response, "\r\n", "\n"))
+	var edits []FileEdit
+	add := func(path string, hunks ...EditHunk) {
+		for i := range edits {
+			if edits[i].Path == path {
+				edits[i].Hunks = append(edits[i].Hunks, hunks...)
+				return
+			}
+		}
+		edits = append(edits, FileEdit{Path: path, Hunks: hunks})
+	}
+
+	previous := ""
+	for i := 0; i < len(lines); i++ {
+		line := lines[i]
+		trimmed := strings.TrimSpace(line)
+		switch {
+		case searchMarkerPattern.MatchString(trimmed):
+			path := editPathFromLine(previous)
+			if path == "" {
+				return nil, fmt.Errorf("%d 行目の SEARCH/REPLACE ブロックの前にファイルのパスがありません", i+1)
+			}
+			hunk, next, err := parseSearchReplace(lines, i)
+			if err != nil {
+				return nil, err
+			}
+			add(path, hunk)
+			i = next
+			previous = ""
+		case strings.HasPrefix(line, "--- ") && i+1 < len(lines) && strings.HasPrefix(lines[i+1], "+++ "):
+			edit, next, err := parseUnifiedDiff(lines, i)
+			if err != nil {
+				return nil, err
+			}
+			add(edit.Path, edit.Hunks...)
+			i = next - 1
+			previous = ""
+		case fenceOpenPattern.MatchString(line):
+			// "```go main.go" のようにフェンスにファイル名が書かれている場合はそれを使う
+			if block := parseFenceInfo(fenceOpenPattern.FindStringSubmatch(line)[2]); block.Filename != "" {
+				previous = block.Filename
+			}
+		case trimmed != "":
+			previous = line
+		}
+	}
+
+	if len(edits) == 0 {
+		return nil, fmt.Errorf("応答に変更（SEARCH/REPLACE ブロックまたは unified diff）が見つかりません")
+	}
+	return edits, nil
+}
+
+// editPathFromLine は、SEARCH/REPLACE ブロックの直前の行からファイルのパスを取り出します
+func editPathFromLine(line string) string {
+	if name := filenameFromLine(line); name != "" {
+		return name
+	}
+	// Makefile のように拡張子のないファイル名だけが書かれている場合
+	name := strings.Trim(strings.TrimSpace(line), "#>*_`'\":： ")
+	if name != "" && !strings.ContainsAny(name, " \t") {
+		return name
+	}
+	return ""
+}
+
+// parseSearchReplace は lines[start] の SEARCH から始まるブロックを解析し、REPLACE の行の位置を返します
+func parseSearchReplace(lines []string, start int) (EditHunk, int, error) {
+	var search, replace []string
+	inReplace := false
+	for i := start + 1; i < len(lines); i++ {
+		trimmed := strings.TrimSpace(lines[i])
+		switch {
+		case !inReplace && dividerMarkerPattern.MatchString(trimmed):
+			inReplace = true
+		case inReplace && replaceMarkerPattern.MatchString(trimmed):
+			return EditHunk{Search: joinLines(search), Replace: joinLines(replace)}, i, nil
+		case inReplace:
+			replace = append(replace, lines[i])
+		default:
+			search = append(search, lines[i])
+		}
+	}
+	return EditHunk{}, 0, fmt.Errorf("%d 行目の SEARCH/REPLACE ブロックが閉じられていません", start+1)
+}
+
+// parseUnifiedDiff は lines[start] の "--- " から始まる1ファイル分の unified diff を解析し、次に解析する行の位置を返します
+func parseUnifiedDiff(lines []string, start int) (FileEdit, int, error) {
+	oldPath := diffPath(lines[start][4:])
+	newPath := diffPath(lines[start+1][4:])
+	if newPath == "/dev/null" {
+		return FileEdit{}, 0, fmt.Errorf("ファイルの削除には対応していません: %s", oldPath)
+	}
+
+	edit := FileEdit{Path: newPath}
+	i := start + 2
+	for i < len(lines) {
+		m := hunkHeaderPattern.FindStringSubmatch(lines[i])
+		if m == nil {
+			break
+		}
+		hunk := EditHunk{}
+		if oldPath != "/dev/null" {
+			hunk.Line, _ = strconv.Atoi(m[1])
+			// "@@ -10,0 +11,2 @@" は10行目の後への挿入
+			if m[2] == "0" {
+				hunk.Line++
+			}
+		}
+
+		var search, replace []string
+	hunkLines:
+		for i++; i < len(lines); i++ {
+			line := lines[i]
+			if line == "" {
+				// 行末の空白が削られた空のコンテキスト行
+				search = append(search, "")
+				replace = append(replace, "")
+				continue
+			}
+			switch line[0] {
+			case ' ':
+				search = append(search, line[1:])
+				replace = append(replace, line[1:])
+			case '-':
+				if strings.HasPrefix(line, "--- ") && i+1 < len(lines) && strings.HasPrefix(lines[i+1], "+++ ") {
+					break hunkLines
+				}
+				search = append(search, line[1:])
+			case '+':
+				replace = append(replace, line[1:])
+			case '\\':
+				// "\ No newline at end of file"
+			default:
+				break hunkLines
+			}
+		}
+
+		// ハンクの後の区切りの空行はコンテキストとして扱わない
+		for len(search) > 0 && len(replace) > 0 && search[len(search)-1] == "" && replace[len(replace)-1] == "" {
+			search, replace = search[:len(search)-1], replace[:len(replace)-1]
+		}
+		hunk.Search, hunk.Replace = joinLines(search), joinLines(replace)
+		edit.Hunks = append(edit.Hunks, hunk)
+	}
+
+	if len(edit.Hunks) == 0 {
+		return edit, 0, fmt.Errorf("%s の unified diff に @@ で始まるハンクがありません", newPath)
+	}
+	return edit, i, nil
+}
+
+// diffPath は unified diff の "--- " や "+++ " の後のパスから、タイムスタンプと a/、b/ の接頭辞を取り除きます
+func diffPath(s string) string {
+	path, _, _ := strings.Cut(s, "\t")
+	path = strings.TrimSpace(path)
+	if path == "/dev/null" {
+		return path
+	}
+	if strings.HasPrefix(path, "a/") || strings.HasPrefix(path, "b/") {
+		path = path[2:]
+	}
+	return path
+}
+
+// joinLines は行を改行で連結し、行がある場合は末尾に改行を付けます
+func joinLines(lines []string) string {
+	if len(lines) == 0 {
+		return ""
+	}
+	return strings.Join(lines, "\n") + "\n"
+}
+
+// ApplyEdits は変更をファイルの内容に適用した結果を返します。ファイルには書き込みません。
+// 適用できない変更は、その変更だけを Rejected に記録して残りの変更を適用します。
+func ApplyEdits(edits []FileEdit) []EditResult {
+	results := make([]EditResult, 0, len(edits))
+	for _, edit := range edits {
+		result := EditResult{Path: edit.Path}
+		path, err := localEditPath(edit.Path)
+		if err == nil {
+			result.Path = path
+			var data []byte
+			data, err = os.ReadFile(path)
+			if err == nil {
+				result.Exists = true
+				result.Original = string(data)
+			} else if errors.Is(err, os.ErrNotExist) {
+				err = nil
+			}
+		}
+		if err != nil {
+			for _, hunk := range edit.Hunks {
+				result.Rejected = append(result.Rejected, RejectedHunk{Hunk: hunk, Reason: err.Error()})
+			}
+			results = append(results, result)
+			continue
+		}
+
+		content := result.Original
+		for _, hunk := range edit.Hunks {
+			updated, err := applyHunk(content, hunk)
+			if err != nil {
+				result.Rejected = append(result.Rejected, RejectedHunk{Hunk: hunk, Reason: err.Error()})
+				continue
+			}
+			content = updated
+			result.Applied++
+		}
+		result.Updated = content
+		results = append(results, result)
+	}
+	return results
+}
+
+// localEditPath は、変更するファイルのパスを作業ディレクトリからの相対パスにします。
+// 作業ディレクトリの外を指すパスはエラーになります。
+func localEditPath(path string) (string, error) {
+	if filepath.IsAbs(path) {
+		wd, err := os.Getwd()
+		if err != nil {
+			return "", err
+		}
+		if rel, err := filepath.Rel(wd, path); err == nil {
+			path = rel
+		}
+	}
+	path = filepath.Clean(path)
+	if !filepath.IsLocal(path) {
+		return "", fmt.Errorf("作業ディレクトリの外のファイルは変更できません: %s", path)
+	}
+	return path, nil
+}
+
+// applyHunk は content の Search に一致する行を Replace に置き換えます。
+// 完全に一致する箇所がない場合は、行末の空白の違いを無視して一致する箇所を探します。
+func applyHunk(content string, hunk EditHunk) (string, error) {
+	contentLines := strings.SplitAfter(content, "\n")
+	if contentLines[len(contentLines)-1] == "" {
+		contentLines = contentLines[:len(contentLines)-1]
+	}
+	newline := "\n"
+	if strings.Contains(content, "\r\n") {
+		newline = "\r\n"
+	}
+	replace := strings.ReplaceAll(hunk.Replace, "\n", newline)
+
+	if hunk.Search == "" {
+		switch {
+		case content == "":
+			return replace, nil
+		case hunk.Line > 0 && hunk.Line-1 <= len(contentLines):
+			before := strings.Join(contentLines[:hunk.Line-1], "")
+			if before != "" && !strings.HasSuffix(before, "\n") {
+				before += newline
+			}
+			return before + replace + strings.Join(contentLines[hunk.Line-1:], ""), nil
+		}
+		return "", fmt.Errorf("ファイルが既に存在するため、SEARCH が空の変更は適用できません")
+	}
+
+	searchLines := splitLines(hunk.Search)
+	if len(searchLines) == 0 {
+		// SEARCH が改行だけの場合は行として扱えないため、一致する箇所を探さない
+		return "", fmt.Errorf("変更前の行が空行1行だけのため、変更する箇所を特定できません")
+	}
+	positions := findLines(contentLines, searchLines, func(s string) string { return strings.TrimSuffix(strings.TrimSuffix(s, "\n"), "\r") })
+	if len(positions) == 0 {
+		positions = findLines(contentLines, searchLines, func(s string) string { return strings.TrimRight(s, " \t\r\n") })
+	}
+
+	var position int
+	switch {
+	case len(positions) == 0:
+		return "", fmt.Errorf("変更前の行がファイルの内容と一致しません")
+	case len(positions) == 1:
+		position = positions[0]
+	case hunk.Line > 0:
+		position = positions[0]
+		for _, p := range positions[1:] {
+			if abs(p+1-hunk.Line) < abs(position+1-hunk.Line) {
+				position = p
+			}
+		}
+	default:
+		return "", fmt.Errorf("変更前の行がファイルの %d 箇所に一致するため、変更する箇所を特定できません", len(positions))
+	}
+
+	end := position + len(searchLines)
+	if !strings.HasSuffix(contentLines[end-1], "\n") {
+		// ファイル末尾の改行がない場合はそのままにする
+		replace = strings.TrimSuffix(replace, newline)
+	}
+	return strings.Join(contentLines[:position], "") + replace + strings.Join(contentLines[end:], ""), nil
+}
+
+// findLines は、normalize した行が search と一致する contentLines の位置をすべて返します
+func findLines(contentLines, search []string, normalize func(string) string) []int {
+	var positions []int
+	for p := 0; p+len(search) <= len(contentLines); p++ {
+		matched := true
+		for k, line := range search {
+			if normalize(contentLines[p+k]) != normalize(line) {
+				matched = false
+				break
+			}
+		}
+		if matched {
+			positions = append(positions, p)
+		}
+	}
+	return positions
+}
+
+// abs は整数の絶対値を返します
+func abs(n int) int {
+	if n < 0 {
+		return -n
+	}
+	return n
+}
+
+// FormatEditPreview は、変更を適用した結果をファイルごとの差分として整形します。
+// color が true の場合、ファイル名と @@ の行も色付きで表示します。
+func FormatEditPreview(results []EditResult, color bool) string {
+	var sb strings.Builder
+	for _, result := range results {
+		if !result.Changed() {
+			continue
+		}
+		header := fmt.Sprintf("--- a/%s\n+++ b/%s", result.Path, result.Path)
+		if !result.Exists {
+			header = fmt.Sprintf("--- /dev/null\n+++ b/%s (新規ファイル)", result.Path)
+		}
+		if color {
+			header = ansiBold + header + ansiReset
+		}
+		sb.WriteString(header + "\n")
+
+		for _, hunk := range DiffHunks(DiffLines(splitLines(result.Original), splitLines(result.Updated)), 3) {
+			marker := fmt.Sprintf("@@ -%d +%d @@", hunk.OldStart, hunk.NewStart)
+			if color {
+				marker = ansiCyan + marker + ansiReset
+			}
+			sb.WriteString(marker + "\n")
+			sb.WriteString(FormatDiff(hunk.Lines, color))
+		}
+		sb.WriteString("\n")
+	}
+	return sb.String()
+}
+
+// PrintRejectedHunks は、適用できなかった変更とその理由を表示し、その数を返します
+func PrintRejectedHunks(w io.Writer, results []EditResult) int {
+	count := 0
+	for _, result := range results {
+		for _, rejected := range result.Rejected {
+			count++
+			fmt.Fprintf(w, "適用できなかった変更 (%s): %s\n", result.Path, rejected.Reason)
+			for _, line := range splitLines(rejected.Hunk.Search) {
+				fmt.Fprintf(w, "  | %s\n", line)
+			}
+		}
+	}
+	return count
+}
+
+// WriteEditResults は、内容が変わるファイルに変更を書き込み、書き込んだパスを返します。
+// 既存のファイルのパーミッションはそのまま残します。
+func WriteEditResults(results []EditResult) ([]string, error) {
+	var written []string
+	for _, result := range results {
+		if !result.Changed() {
+			continue
+		}
+		mode := os.FileMode(0644)
+		if info, err := os.Stat(result.Path); err == nil {
+			mode = info.Mode().Perm()
+		} else if err := os.MkdirAll(filepath.Dir(result.Path), 0755); err != nil {
+			return written, fmt.Errorf("ディレクトリの作成に失敗しました: %w", err)
+		}
+		if err := os.WriteFile(result.Path, []byte(result.Updated), mode); err != nil {
+			return written, fmt.Errorf("ファイルの書き込みに失敗しました (%s): %w", result.Path, err)
+		}
+		written = append(written, result.Path)
+	}
+	return written, nil
+}
+
+// handleEdit は -edit の場合に応答の変更を解析して差分を表示し、確認後にファイルに適用します。
+// -y が指定された場合は確認しません。適用できなかった変更がある場合はその内容を表示してエラーを返します。
+func handleEdit(content string, options Options) error {
+	edits, err := ParseEdits(content)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, content)
+		return err
+	}
+
+	results := ApplyEdits(edits)
+	fmt.Print(FormatEditPreview(results, useColor(os.Stdout)))
+	rejected := PrintRejectedHunks(os.Stderr, results)
+
+	changed := 0
+	for _, result := range results {
+		if result.Changed() {
+			changed++
+		}
+	}
+	if changed == 0 {
+		return fmt.Errorf("適用できる変更がありません")
+	}
+
+	if !options.Yes {
+		reader, closeReader := terminalReader()
+		defer closeReader()
+		if !confirm(reader, fmt.Sprintf("%d 個のファイルに変更を適用しますか？", changed)) {
+			fmt.Fprintln(os.Stderr, "変更を適用しませんでした。")
+			return nil
+		}
+	}
+
+	written, err := WriteEditResults(results)
+	for _, path := range written {
+		fmt.Fprintf(os.Stderr, "変更しました: %s\n", path)
+	}
+	if err != nil {
+		return err
+	}
+	if rejected > 0 {
+		return fmt.Errorf("%d 個の変更を適用できませんでした", rejected)
+	}
+	return nil
+}
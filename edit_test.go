@@ -0,0 +1,139 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestParseEdits(t *testing.T) {
+	response := "次のように変更します。\n\n" +
+		"`main.go`:\n" +
+		"```go\n" +
+		"<<<<<<< SEARCH\n" +
+		"func hello() {\n" +
+		"\tfmt.Println(\"hello\")\n" +
+		"=======\n" +
+		"func hello() {\n" +
+		"\tfmt.Println(\"こんにちは\")\n" +
+		">>>>>>> REPLACE\n" +
+		"```\n\n" +
+		"```diff\n" +
+		"--- a/util.go\n" +
+		"+++ b/util.go\n" +
+		"@@ -3,3 +3,3 @@ package main\n" +
+		" func add(a, b int) int {\n" +
+		"-\treturn a - b\n" +
+		"+\treturn a + b\n" +
+		" }\n" +
+		"--- /dev/null\n" +
+		"+++ b/docs/NOTE.md\n" +
+		"@@ -0,0 +1,1 @@\n" +
+		"+# メモ\n" +
+		"```\n"
+
+	edits, err := ParseEdits(response)
+	if err != nil {
+		t.Fatalf("ParseEdits() エラー: %v", err)
+	}
+	want := []FileEdit{
+		{Path: "main.go", Hunks: []EditHunk{{
+			Search:  "func hello() {\n\tfmt.Println(\"hello\")\n",
+			Replace: "func hello() {\n\tfmt.Println(\"こんにちは\")\n",
+		}}},
+		{Path: "util.go", Hunks: []EditHunk{{
+			Search:  "func add(a, b int) int {\n\treturn a - b\n}\n",
+			Replace: "func add(a, b int) int {\n\treturn a + b\n}\n",
+			Line:    3,
+		}}},
+		{Path: "docs/NOTE.md", Hunks: []EditHunk{{Replace: "# メモ\n"}}},
+	}
+	if len(edits) != len(want) {
+		t.Fatalf("変更の数 = %d, 期待値 %d: %+v", len(edits), len(want), edits)
+	}
+	for i := range want {
+		if edits[i].Path != want[i].Path || len(edits[i].Hunks) != 1 || edits[i].Hunks[0] != want[i].Hunks[0] {
+			t.Errorf("edits[%d] = %+v, 期待値 %+v", i, edits[i], want[i])
+		}
+	}
+
+	if _, err := ParseEdits("変更はありません。"); err == nil {
+		t.Errorf("変更のない応答がエラーになりませんでした")
+	}
+	if _, err := ParseEdits("<<<<<<< SEARCH\na\n=======\nb\n>>>>>>> REPLACE\n"); err == nil {
+		t.Errorf("ファイルのパスがないブロックがエラーになりませんでした")
+	}
+}
+
+func TestApplyEdits(t *testing.T) {
+	oldDir, _ := os.Getwd()
+	if err := os.Chdir(t.TempDir()); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { os.Chdir(oldDir) })
+
+	original := "package main\n\nfunc a() {\n\treturn\n}\n\nfunc b() {\n\treturn\n}\n"
+	if err := os.WriteFile("main.go", []byte(original), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	results := ApplyEdits([]FileEdit{
+		{Path: "main.go", Hunks: []EditHunk{
+			{Search: "func a() {  \n", Replace: "func first() {\n"},
+			{Search: "\treturn\n", Replace: "\treturn // b\n", Line: 8},
+			{Search: "func missing() {\n", Replace: "func x() {\n"},
+			{Search: "}\n", Replace: "}\n\n// end\n"},
+		}},
+		{Path: "sub/new.txt", Hunks: []EditHunk{{Replace: "新しいファイル\n"}}},
+		{Path: "../outside.txt", Hunks: []EditHunk{{Replace: "x\n"}}},
+	})
+
+	want := "package main\n\nfunc first() {\n\treturn\n}\n\nfunc b() {\n\treturn // b\n}\n"
+	if results[0].Updated != want {
+		t.Errorf("変更後の内容 = %q, 期待値 %q", results[0].Updated, want)
+	}
+	if results[0].Applied != 2 || len(results[0].Rejected) != 2 {
+		t.Errorf("適用 %d, 却下 %d, 期待値 2, 2: %+v", results[0].Applied, len(results[0].Rejected), results[0].Rejected)
+	} else if !strings.Contains(results[0].Rejected[1].Reason, "2 箇所") {
+		t.Errorf("複数の箇所に一致する変更の理由が正しくありません: %s", results[0].Rejected[1].Reason)
+	}
+	if results[1].Exists || results[1].Updated != "新しいファイル\n" {
+		t.Errorf("新規ファイルの結果が正しくありません: %+v", results[1])
+	}
+	if len(results[2].Rejected) != 1 || results[2].Changed() {
+		t.Errorf("作業ディレクトリの外のファイルが却下されませんでした: %+v", results[2])
+	}
+
+	preview := FormatEditPreview(results, false)
+	for _, expected := range []string{"--- a/main.go", "@@ -1 +1 @@", "- func a() {", "+ func first() {", "+++ b/sub/new.txt (新規ファイル)"} {
+		if !strings.Contains(preview, expected) {
+			t.Errorf("差分の表示に %q が含まれていません:\n%s", expected, preview)
+		}
+	}
+
+	written, err := WriteEditResults(results)
+	if err != nil || len(written) != 2 {
+		t.Fatalf("WriteEditResults() = %v, %v", written, err)
+	}
+	if info, _ := os.Stat("main.go"); info.Mode().Perm() != 0600 {
+		t.Errorf("パーミッションが変わりました: %v", info.Mode().Perm())
+	}
+	if data, _ := os.ReadFile(filepath.Join("sub", "new.txt")); string(data) != "新しいファイル\n" {
+		t.Errorf("新規ファイルの内容が正しくありません: %q", data)
+	}
+}
+
+func TestApplyHunkBlankSearch(t *testing.T) {
+	for _, hunk := range []EditHunk{
+		{Search: "\n", Replace: "\nfoo\n", Line: 1},
+		{Search: "\n", Replace: "foo\n"},
+	} {
+		if _, err := applyHunk("x\n", hunk); err == nil {
+			t.Errorf("空行1行だけの SEARCH がエラーになりませんでした: %+v", hunk)
+		}
+	}
+	if got, err := applyHunk("a\n\n\nb\n", EditHunk{Search: "\n\n", Replace: "\n"}); err != nil || got != "a\n\nb\n" {
+		t.Errorf("空行2行の SEARCH の結果 = %q, %v", got, err)
+	}
+}
@@ -0,0 +1,265 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// ファイル内容の表示形式
+const (
+	FileFormatPlain    = "plain"
+	FileFormatMarkdown = "markdown"
+	FileFormatXML      = "xml"
+)
+
+// FileContextConfig は、プロンプトに埋め込むファイル内容の表示形式の設定で、以下のフィールドを含みます:
+// - Format: 表示形式（plain, markdown, xml）。未指定の場合は plain
+// - LineNumbers: 各行に行番号を付けるかどうか
+// - Tree: ファイル一覧をディレクトリツリーとして先頭に表示するかどうか
+type FileContextConfig struct {
+	Format      string `yaml:"format,omitempty"`
+	LineNumbers bool   `yaml:"lineNumbers,omitempty"`
+	Tree        bool   `yaml:"tree,omitempty"`
+}
+
+// languageByExtension は拡張子とコードブロックの言語名の対応表です
+var languageByExtension = map[string]string{
+	".go":    "go",
+	".py":    "python",
+	".js":    "javascript",
+	".mjs":   "javascript",
+	".jsx":   "jsx",
+	".ts":    "typescript",
+	".tsx":   "tsx",
+	".rb":    "ruby",
+	".rs":    "rust",
+	".java":  "java",
+	".kt":    "kotlin",
+	".swift": "swift",
+	".c":     "c",
+	".h":     "c",
+	".cc":    "cpp",
+	".cpp":   "cpp",
+	".hpp":   "cpp",
+	".cs":    "csharp",
+	".php":   "php",
+	".scala": "scala",
+	".lua":   "lua",
+	".pl":    "perl",
+	".r":     "r",
+	".sh":    "bash",
+	".bash":  "bash",
+	".zsh":   "zsh",
+	".ps1":   "powershell",
+	".sql":   "sql",
+	".html":  "html",
+	".css":   "css",
+	".scss":  "scss",
+	".xml":   "xml",
+	".json":  "json",
+	".yaml":  "yaml",
+	".yml":   "yaml",
+	".toml":  "toml",
+	".ini":   "ini",
+	".md":    "markdown",
+	".tf":    "hcl",
+	".proto": "protobuf",
+	".vim":   "vim",
+	".diff":  "diff",
+	".patch": "diff",
+}
+
+// languageByFileName は拡張子を持たないファイル名とコードブロックの言語名の対応表です
+var languageByFileName = map[string]string{
+	"Dockerfile":  "dockerfile",
+	"Makefile":    "makefile",
+	"Jenkinsfile": "groovy",
+	"go.mod":      "go",
+}
+
+// DetectLanguage は、ファイル名からコードブロックに付ける言語名を推測します。
+// 推測できない場合は空文字を返します。
+func DetectLanguage(filePath string) string {
+	base := filepath.Base(filePath)
+	if lang, ok := languageByFileName[base]; ok {
+		return lang
+	}
+	return languageByExtension[strings.ToLower(filepath.Ext(base))]
+}
+
+// FileContent はプロンプトに埋め込むファイルのパスと内容の組です
+type FileContent struct {
+	Path    string
+	Content string
+}
+
+// RenderFileContext は、指定されたファイルを読み込み、設定された形式でプロンプト用の文字列に整形します。
+func RenderFileContext(paths []string, fc FileContextConfig) (string, error) {
+	files := make([]FileContent, 0, len(paths))
+	for _, filePath := range paths {
+		content, err := os.ReadFile(filePath)
+		if err != nil {
+			return "", fmt.Errorf("ファイルの読み込みに失敗しました (%s): %w", filePath, err)
+		}
+		files = append(files, FileContent{Path: filePath, Content: string(content)})
+	}
+	return RenderFileContents(files, fc)
+}
+
+// RenderFileContents は、読み込み済みのファイル内容を設定された形式でプロンプト用の文字列に整形します。
+// git のリビジョンから取り出した内容など、ディスク上のファイル以外を埋め込む場合に使用します。
+func RenderFileContents(files []FileContent, fc FileContextConfig) (string, error) {
+	var builder strings.Builder
+
+	format := fc.Format
+	if format == "" {
+		format = FileFormatPlain
+	}
+	if format != FileFormatPlain && format != FileFormatMarkdown && format != FileFormatXML {
+		return "", fmt.Errorf("サポートされていないファイル表示形式です: %s", fc.Format)
+	}
+
+	if fc.Tree && len(files) > 0 {
+		paths := make([]string, len(files))
+		for i, file := range files {
+			paths[i] = file.Path
+		}
+		tree := RenderFileTree(paths)
+		switch format {
+		case FileFormatXML:
+			fmt.Fprintf(&builder, "<directory_tree>\n%s</directory_tree>\n\n", tree)
+		case FileFormatMarkdown:
+			fmt.Fprintf(&builder, "ファイル構成:\n```\n%s```\n\n", tree)
+		default:
+			fmt.Fprintf(&builder, "ファイル構成:\n%s\n", tree)
+		}
+	}
+
+	for _, file := range files {
+		writeFileContext(&builder, file.Path, file.Content, format, fc.LineNumbers)
+	}
+
+	return builder.String(), nil
+}
+
+// writeFileContext は、1つのファイルの内容を指定された形式で書き込みます
+func writeFileContext(builder *strings.Builder, filePath, content, format string, lineNumbers bool) {
+	if lineNumbers {
+		content = addLineNumbers(content)
+	}
+
+	switch format {
+	case FileFormatMarkdown:
+		fence := codeFence(content)
+		fmt.Fprintf(builder, "### %s\n\n%s%s\n%s", filePath, fence, DetectLanguage(filePath), content)
+		if !strings.HasSuffix(content, "\n") {
+			builder.WriteString("\n")
+		}
+		fmt.Fprintf(builder, "%s\n\n", fence)
+	case FileFormatXML:
+		fmt.Fprintf(builder, "<file path=\"%s\"", xmlAttrEscaper.Replace(filePath))
+		if lang := DetectLanguage(filePath); lang != "" {
+			fmt.Fprintf(builder, " language=\"%s\"", lang)
+		}
+		// </file> を含む内容（XML や HTML のファイルなど）で要素が途中で閉じないよう、CDATA で囲む
+		if strings.Contains(content, "</file") {
+			content = "<![CDATA[" + strings.ReplaceAll(content, "]]>", "]]]]><![CDATA[>") + "]]>"
+		}
+		fmt.Fprintf(builder, ">\n%s", content)
+		if !strings.HasSuffix(content, "\n") {
+			builder.WriteString("\n")
+		}
+		builder.WriteString("</file>\n\n")
+	default:
+		fmt.Fprintf(builder, "ファイル名: %s\n内容:\n%s\n\n", filePath, content)
+	}
+}
+
+// xmlAttrEscaper はXML属性値に含められない文字をエスケープします
+var xmlAttrEscaper = strings.NewReplacer("&", "&amp;", "<", "&lt;", ">", "&gt;", "\"", "&quot;")
+
+// codeFence は、内容に含まれるバッククォートの連続より長いコードフェンスを返します
+func codeFence(content string) string {
+	longest, current := 0, 0
+	for _, r := range content {
+		if r == '`' {
+			current++
+			if current > longest {
+				longest = current
+			}
+		} else {
+			current = 0
+		}
+	}
+	if longest < 3 {
+		return "```"
+	}
+	return strings.Repeat("`", longest+1)
+}
+
+// addLineNumbers は各行の先頭に行番号を付けます
+func addLineNumbers(content string) string {
+	lines := strings.Split(strings.TrimSuffix(content, "\n"), "\n")
+	width := len(fmt.Sprint(len(lines)))
+
+	var builder strings.Builder
+	for i, line := range lines {
+		fmt.Fprintf(&builder, "%*d | %s\n", width, i+1, line)
+	}
+	return builder.String()
+}
+
+// fileTreeNode はディレクトリツリーの1要素です
+type fileTreeNode struct {
+	children map[string]*fileTreeNode
+}
+
+// RenderFileTree は、ファイルパスのリストからディレクトリツリーの文字列を作成します
+func RenderFileTree(paths []string) string {
+	root := &fileTreeNode{children: map[string]*fileTreeNode{}}
+	for _, p := range paths {
+		node := root
+		for _, segment := range strings.Split(path.Clean(filepath.ToSlash(p)), "/") {
+			if segment == "" || segment == "." {
+				continue
+			}
+			child, ok := node.children[segment]
+			if !ok {
+				child = &fileTreeNode{children: map[string]*fileTreeNode{}}
+				node.children[segment] = child
+			}
+			node = child
+		}
+	}
+
+	var builder strings.Builder
+	builder.WriteString(".\n")
+	writeFileTree(&builder, root, "")
+	return builder.String()
+}
+
+// writeFileTree はツリーの子要素を罫線付きで再帰的に書き込みます
+func writeFileTree(builder *strings.Builder, node *fileTreeNode, indent string) {
+	names := make([]string, 0, len(node.children))
+	for name := range node.children {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	for i, name := range names {
+		child := node.children[name]
+		branch, nextIndent := "├── ", "│   "
+		if i == len(names)-1 {
+			branch, nextIndent = "└── ", "    "
+		}
+		if len(child.children) > 0 {
+			name += "/"
+		}
+		fmt.Fprintf(builder, "%s%s%s\n", indent, branch, name)
+		writeFileTree(builder, child, indent+nextIndent)
+	}
+}
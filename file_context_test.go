@@ -0,0 +1,74 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestRenderFileContext(t *testing.T) {
+	dir := t.TempDir()
+	goFile := filepath.Join(dir, "main.go")
+	if err := os.WriteFile(goFile, []byte("package main\n```\n"), 0644); err != nil {
+		t.Fatalf("ファイル作成エラー: %v", err)
+	}
+
+	plain, err := RenderFileContext([]string{goFile}, FileContextConfig{})
+	if err != nil {
+		t.Fatalf("RenderFileContext() エラー: %v", err)
+	}
+	if plain != "ファイル名: "+goFile+"\n内容:\npackage main\n```\n\n\n" {
+		t.Errorf("plain 形式の出力が想定と異なります: %q", plain)
+	}
+
+	markdown, err := RenderFileContext([]string{goFile}, FileContextConfig{Format: FileFormatMarkdown, LineNumbers: true})
+	if err != nil {
+		t.Fatalf("RenderFileContext() エラー: %v", err)
+	}
+	if !strings.Contains(markdown, "````go\n1 | package main\n2 | ```\n````\n") {
+		t.Errorf("markdown 形式の出力が想定と異なります: %q", markdown)
+	}
+
+	xml, err := RenderFileContext([]string{goFile}, FileContextConfig{Format: FileFormatXML})
+	if err != nil {
+		t.Fatalf("RenderFileContext() エラー: %v", err)
+	}
+	if !strings.HasPrefix(xml, "<file path=\""+goFile+"\" language=\"go\">\n") || !strings.Contains(xml, "</file>") {
+		t.Errorf("xml 形式の出力が想定と異なります: %q", xml)
+	}
+
+	// </file> を含む内容は CDATA で囲み、]]> は分割する
+	var builder strings.Builder
+	writeFileContext(&builder, "fixture.xml", "<files><file>a</file></files>\n<![CDATA[x]]>\n", FileFormatXML, false)
+	want := "<file path=\"fixture.xml\" language=\"xml\">\n<![CDATA[<files><file>a</file></files>\n<![CDATA[x]]]]><![CDATA[>\n]]>\n</file>\n\n"
+	if builder.String() != want {
+		t.Errorf("</file> を含む xml 形式の出力 = %q, want %q", builder.String(), want)
+	}
+
+	if _, err := RenderFileContext([]string{goFile}, FileContextConfig{Format: "html"}); err == nil {
+		t.Errorf("未対応の形式でエラーになりませんでした")
+	}
+}
+
+func TestRenderFileTree(t *testing.T) {
+	got := RenderFileTree([]string{"main.go", "src/b.go", "src/a.go", "README.md"})
+	want := ".\n├── README.md\n├── main.go\n└── src/\n    ├── a.go\n    └── b.go\n"
+	if got != want {
+		t.Errorf("RenderFileTree() = %q, 期待値 %q", got, want)
+	}
+}
+
+func TestDetectLanguage(t *testing.T) {
+	cases := map[string]string{
+		"main.go":        "go",
+		"dir/Dockerfile": "dockerfile",
+		"script.SH":      "bash",
+		"unknown.xyz":    "",
+	}
+	for name, want := range cases {
+		if got := DetectLanguage(name); got != want {
+			t.Errorf("DetectLanguage(%q) = %q, 期待値 %q", name, got, want)
+		}
+	}
+}
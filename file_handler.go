@@ -250,15 +250,17 @@ func handleVectorStoreAction(client *openai.Client, options Options) error {
 }
 
 // ファイル名でファイルを削除するためのヘルパー関数
+// pattern は -f などと同じカンマ区切りのグロブパターンで、`**`、`{a,b}`、`!` による除外に対応します
 func DeleteFilesByName(client *openai.Client, pattern string) error {
 	files, err := ListUploadedFiles(client)
 	if err != nil {
 		return fmt.Errorf("ファイル一覧の取得に失敗しました: %w", err)
 	}
 
+	patterns := SplitPatternList(pattern)
 	var errors []error
 	for _, file := range files.Files {
-		match, err := filepath.Match(pattern, file.FileName)
+		match, err := MatchPatterns(patterns, file.FileName)
 		if err != nil {
 			return fmt.Errorf("パターンのマッチングに失敗しました: %w", err)
 		}
@@ -0,0 +1,225 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+)
+
+// GitContextOptions は、git リポジトリからプロンプトに追加する内容の設定で、以下のフィールドを含みます:
+// - Diff: 作業ツリーの未ステージの差分を追加する（-git-diff）
+// - Staged: ステージ済みの差分を追加する（-git-staged）
+// - Range: 指定したコミット範囲の差分とコミット一覧を追加する（-git-range A..B）
+// - FilesChanged: 変更されたファイルの全内容を追加する（-git-files-changed）
+type GitContextOptions struct {
+	Diff         bool
+	Staged       bool
+	Range        string
+	FilesChanged bool
+}
+
+// Enabled は git のコンテキストを追加する指定があるかを返します
+func (g GitContextOptions) Enabled() bool {
+	return g.Diff || g.Staged || g.Range != "" || g.FilesChanged
+}
+
+// validate は、差分の種類が1つだけ指定され、コミット範囲が git のオプションとして解釈されないことを確認します。
+// -git-diff、-git-staged、-git-range を組み合わせた場合と、範囲や終端のリビジョンが `-` で始まる場合はエラーにします。
+func (g GitContextOptions) validate() error {
+	kinds := 0
+	for _, set := range []bool{g.Diff, g.Staged, g.Range != ""} {
+		if set {
+			kinds++
+		}
+	}
+	if kinds > 1 {
+		return fmt.Errorf("-git-diff、-git-staged、-git-range は同時に指定できません（未ステージとステージ済みの両方の差分は -git-range HEAD で追加できます）")
+	}
+	if g.Range == "" {
+		return nil
+	}
+	for _, revision := range strings.FieldsFunc(g.Range, func(r rune) bool { return r == '.' }) {
+		if strings.HasPrefix(revision, "-") {
+			return fmt.Errorf("-git-range には - で始まるリビジョンを指定できません: %s", g.Range)
+		}
+	}
+	return nil
+}
+
+// diffArgs は、指定に応じた git diff の引数を返します。
+// Range, Staged のどちらも指定されていない場合は作業ツリーの差分です（組み合わせは validate でエラーにします）。
+func (g GitContextOptions) diffArgs() []string {
+	switch {
+	case g.Range != "":
+		return []string{"diff", g.Range}
+	case g.Staged:
+		return []string{"diff", "--cached"}
+	default:
+		return []string{"diff"}
+	}
+}
+
+// describe は差分の種類を表す見出し用の文字列を返します
+func (g GitContextOptions) describe() string {
+	switch {
+	case g.Range != "":
+		return fmt.Sprintf("コミット範囲 %s", g.Range)
+	case g.Staged:
+		return "ステージ済みの変更"
+	default:
+		return "作業ツリーの変更"
+	}
+}
+
+// BuildGitContext は、git リポジトリから差分や変更されたファイルの内容を取得し、プロンプト用の文字列に整形します。
+// 変更されたファイルの内容は fc の表示形式で整形されます。
+func BuildGitContext(g GitContextOptions, fc FileContextConfig) (string, error) {
+	if err := g.validate(); err != nil {
+		return "", err
+	}
+	if _, err := runGit("rev-parse", "--is-inside-work-tree"); err != nil {
+		return "", fmt.Errorf("git リポジトリ内で実行してください: %w", err)
+	}
+
+	var builder strings.Builder
+	includeDiff := g.Diff || g.Staged || g.Range != ""
+
+	// コミット範囲が指定された場合はコミット一覧を追加
+	if strings.Contains(g.Range, "..") {
+		log, err := runGit("log", "--no-color", "--format=%h %s%n%n%b", g.Range)
+		if err != nil {
+			return "", err
+		}
+		if strings.TrimSpace(log) != "" {
+			fence := codeFence(log)
+			fmt.Fprintf(&builder, "## コミット一覧 (%s)\n\n%stext\n%s\n%s\n\n", g.Range, fence, strings.TrimSpace(log), fence)
+		}
+	}
+
+	if includeDiff {
+		diff, err := runGit(append(g.diffArgs(), "--no-color", "--no-ext-diff")...)
+		if err != nil {
+			return "", err
+		}
+		if strings.TrimSpace(diff) == "" {
+			return "", fmt.Errorf("%sに差分がありません", g.describe())
+		}
+		fence := codeFence(diff)
+		fmt.Fprintf(&builder, "## 差分 (%s)\n\n%sdiff\n%s", g.describe(), fence, diff)
+		if !strings.HasSuffix(diff, "\n") {
+			builder.WriteString("\n")
+		}
+		fmt.Fprintf(&builder, "%s\n\n", fence)
+	}
+
+	if g.FilesChanged {
+		files, err := GitChangedFiles(g)
+		if err != nil {
+			return "", err
+		}
+		if len(files) == 0 && !includeDiff {
+			return "", fmt.Errorf("%sに変更されたファイルがありません", g.describe())
+		}
+		if len(files) > 0 {
+			content, err := RenderFileContents(files, fc)
+			if err != nil {
+				return "", err
+			}
+			fmt.Fprintf(&builder, "## 変更されたファイル\n\n%s", content)
+		}
+	}
+
+	return builder.String(), nil
+}
+
+// GitChangedFiles は、変更されたファイルのパスと変更後の内容を返します。
+// 削除されたファイルとバイナリファイルは含みません。
+// 内容はステージ済みの場合はインデックスから、コミット範囲の場合は範囲の終端のコミットから、
+// それ以外の場合は作業ツリーから取得します。
+func GitChangedFiles(g GitContextOptions) ([]FileContent, error) {
+	if err := g.validate(); err != nil {
+		return nil, err
+	}
+	out, err := runGit(append(g.diffArgs(), "--name-only", "--diff-filter=d", "-z")...)
+	if err != nil {
+		return nil, err
+	}
+
+	root, err := runGit("rev-parse", "--show-toplevel")
+	if err != nil {
+		return nil, err
+	}
+	root = strings.TrimSpace(root)
+
+	revision, fromRevision := g.contentRevision()
+
+	var files []FileContent
+	for _, name := range strings.Split(out, "\x00") {
+		if name == "" {
+			continue
+		}
+
+		var content []byte
+		if fromRevision {
+			show, err := runGit("show", revision+":"+name)
+			if err != nil {
+				return nil, err
+			}
+			content = []byte(show)
+		} else {
+			content, err = os.ReadFile(filepath.Join(root, name))
+			if err != nil {
+				return nil, fmt.Errorf("ファイルの読み込みに失敗しました (%s): %w", name, err)
+			}
+		}
+
+		if bytes.IndexByte(content, 0) >= 0 {
+			logger.Debug("バイナリファイルのため内容を省略します: %s", name)
+			continue
+		}
+		files = append(files, FileContent{Path: name, Content: string(content)})
+	}
+
+	return files, nil
+}
+
+// contentRevision は、変更後のファイル内容を取得するリビジョンを返します。
+// 作業ツリーから読み込む場合は false を返します。
+func (g GitContextOptions) contentRevision() (string, bool) {
+	switch {
+	case g.Range != "":
+		var end string
+		if i := strings.Index(g.Range, "..."); i >= 0 {
+			end = g.Range[i+3:]
+		} else if i := strings.Index(g.Range, ".."); i >= 0 {
+			end = g.Range[i+2:]
+		} else {
+			// 単一のリビジョンの場合は作業ツリーとの差分になる
+			return "", false
+		}
+		if end == "" {
+			end = "HEAD"
+		}
+		return end, true
+	case g.Staged:
+		// ":path" はインデックス上の内容を表す
+		return "", true
+	default:
+		return "", false
+	}
+}
+
+// runGit は git コマンドを実行し、標準出力を返します
+func runGit(args ...string) (string, error) {
+	cmd := exec.Command("git", args...)
+	var stdout, stderr bytes.Buffer
+	cmd.Stdout = &stdout
+	cmd.Stderr = &stderr
+	if err := cmd.Run(); err != nil {
+		return "", fmt.Errorf("git %s の実行に失敗しました: %v: %s", strings.Join(args, " "), err, strings.TrimSpace(stderr.String()))
+	}
+	return stdout.String(), nil
+}
@@ -0,0 +1,134 @@
+package main
+
+import (
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// setupGitRepo はテスト用の git リポジトリを作成し、カレントディレクトリを移動します
+func setupGitRepo(t *testing.T) {
+	t.Helper()
+	if _, err := exec.LookPath("git"); err != nil {
+		t.Skip("git コマンドが見つかりません")
+	}
+
+	dir := t.TempDir()
+	oldDir, err := os.Getwd()
+	if err != nil {
+		t.Fatalf("カレントディレクトリの取得エラー: %v", err)
+	}
+	if err := os.Chdir(dir); err != nil {
+		t.Fatalf("ディレクトリ移動エラー: %v", err)
+	}
+	t.Cleanup(func() { os.Chdir(oldDir) })
+
+	for _, args := range [][]string{
+		{"init", "-q"},
+		{"config", "user.email", "test@example.com"},
+		{"config", "user.name", "test"},
+	} {
+		if _, err := runGit(args...); err != nil {
+			t.Fatalf("git の初期化エラー: %v", err)
+		}
+	}
+}
+
+func TestBuildGitContextStaged(t *testing.T) {
+	logger = NewConsoleLogger(false)
+	setupGitRepo(t)
+
+	if err := os.WriteFile("a.go", []byte("package a\n"), 0644); err != nil {
+		t.Fatalf("ファイル作成エラー: %v", err)
+	}
+	if _, err := runGit("add", "a.go"); err != nil {
+		t.Fatalf("git add エラー: %v", err)
+	}
+	if _, err := runGit("commit", "-q", "-m", "init"); err != nil {
+		t.Fatalf("git commit エラー: %v", err)
+	}
+
+	if _, err := BuildGitContext(GitContextOptions{Staged: true}, FileContextConfig{}); err == nil {
+		t.Errorf("ステージされた変更がない場合にエラーになりませんでした")
+	}
+
+	if err := os.WriteFile("a.go", []byte("package a\n\nfunc A() {}\n"), 0644); err != nil {
+		t.Fatalf("ファイル作成エラー: %v", err)
+	}
+	if _, err := runGit("add", "a.go"); err != nil {
+		t.Fatalf("git add エラー: %v", err)
+	}
+	// ステージ後の作業ツリーの変更は含まれないこと
+	if err := os.WriteFile("a.go", []byte("package a\n\nfunc B() {}\n"), 0644); err != nil {
+		t.Fatalf("ファイル作成エラー: %v", err)
+	}
+
+	content, err := BuildGitContext(GitContextOptions{Staged: true, FilesChanged: true}, FileContextConfig{Format: FileFormatMarkdown})
+	if err != nil {
+		t.Fatalf("BuildGitContext() エラー: %v", err)
+	}
+	if !strings.Contains(content, "+func A() {}") {
+		t.Errorf("差分が含まれていません: %s", content)
+	}
+	if !strings.Contains(content, "### a.go") || strings.Contains(content, "func B") {
+		t.Errorf("ステージ済みのファイル内容が正しく含まれていません: %s", content)
+	}
+}
+
+func TestBuildGitContextRange(t *testing.T) {
+	logger = NewConsoleLogger(false)
+	setupGitRepo(t)
+
+	for i, body := range []string{"one\n", "two\n"} {
+		if err := os.WriteFile(filepath.Join(".", "note.txt"), []byte(body), 0644); err != nil {
+			t.Fatalf("ファイル作成エラー: %v", err)
+		}
+		if _, err := runGit("add", "note.txt"); err != nil {
+			t.Fatalf("git add エラー: %v", err)
+		}
+		if _, err := runGit("commit", "-q", "-m", []string{"first", "second"}[i]); err != nil {
+			t.Fatalf("git commit エラー: %v", err)
+		}
+	}
+
+	content, err := BuildGitContext(GitContextOptions{Range: "HEAD~1..HEAD", FilesChanged: true}, FileContextConfig{})
+	if err != nil {
+		t.Fatalf("BuildGitContext() エラー: %v", err)
+	}
+	for _, want := range []string{"second", "-one", "+two", "ファイル名: note.txt"} {
+		if !strings.Contains(content, want) {
+			t.Errorf("%q が含まれていません: %s", want, content)
+		}
+	}
+}
+
+func TestBuildGitContextRejectsOptionRange(t *testing.T) {
+	logger = NewConsoleLogger(false)
+	setupGitRepo(t)
+
+	for _, r := range []string{"--output=/tmp/x", "-p", "HEAD~1..--output=x", "main...-x"} {
+		if _, err := BuildGitContext(GitContextOptions{Range: r}, FileContextConfig{}); err == nil || !strings.Contains(err.Error(), "- で始まるリビジョン") {
+			t.Errorf("Range %q がエラーになりませんでした: %v", r, err)
+		}
+	}
+}
+
+func TestBuildGitContextRejectsCombinedDiffs(t *testing.T) {
+	logger = NewConsoleLogger(false)
+	setupGitRepo(t)
+
+	for _, g := range []GitContextOptions{
+		{Diff: true, Staged: true},
+		{Diff: true, Range: "HEAD"},
+		{Staged: true, Range: "HEAD", FilesChanged: true},
+	} {
+		if _, err := BuildGitContext(g, FileContextConfig{}); err == nil || !strings.Contains(err.Error(), "同時に指定できません") {
+			t.Errorf("%+v がエラーになりませんでした: %v", g, err)
+		}
+		if _, err := GitChangedFiles(g); err == nil {
+			t.Errorf("GitChangedFiles(%+v) がエラーになりませんでした", g)
+		}
+	}
+}
@@ -0,0 +1,324 @@
+package main
+
+import (
+	"fmt"
+	"io/fs"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+)
+
+// SplitPatternList は、カンマ区切りのパターンリストを分割します。
+// ブレース展開 `{a,b}` の中のカンマでは分割しません。
+// 各要素の前後の空白は取り除かれ、空の要素は無視されます。
+func SplitPatternList(list string) []string {
+	var patterns []string
+	var current strings.Builder
+	depth := 0
+
+	flush := func() {
+		if p := strings.TrimSpace(current.String()); p != "" {
+			patterns = append(patterns, p)
+		}
+		current.Reset()
+	}
+
+	for _, r := range list {
+		switch {
+		case r == '{':
+			depth++
+		case r == '}' && depth > 0:
+			depth--
+		case r == ',' && depth == 0:
+			flush()
+			continue
+		}
+		current.WriteRune(r)
+	}
+	flush()
+
+	return patterns
+}
+
+// ExpandFileList は、カンマ区切りのパターンリストをファイルパスのリストに展開します。
+// -f, -i, -upload-and-add-to-vector など、ファイルを受け取るオプションで共通に使用します。
+func ExpandFileList(list string) ([]string, error) {
+	return ExpandPatterns(SplitPatternList(list))
+}
+
+// ExpandPatterns は、複数のグロブパターンを展開し、重複を除いたファイルパスのリストを返します。
+// `!` で始まるパターンは除外パターンとして扱い、他のパターンで得られた結果から取り除きます。
+// メタ文字を含まないパターンは、存在確認をせずにそのままのパスとして扱います。
+func ExpandPatterns(patterns []string) ([]string, error) {
+	var includes, excludes []string
+	for _, pattern := range patterns {
+		if strings.HasPrefix(pattern, "!") {
+			excludes = append(excludes, strings.TrimPrefix(pattern, "!"))
+		} else {
+			includes = append(includes, pattern)
+		}
+	}
+
+	var result []string
+	seen := make(map[string]struct{})
+	for _, pattern := range includes {
+		matches, err := Glob(pattern)
+		if err != nil {
+			return nil, fmt.Errorf("パターンの展開に失敗しました (%s): %w", pattern, err)
+		}
+
+		for _, match := range matches {
+			if _, exists := seen[match]; exists {
+				continue
+			}
+			excluded, err := matchAny(excludes, match)
+			if err != nil {
+				return nil, err
+			}
+			if excluded {
+				continue
+			}
+			seen[match] = struct{}{}
+			result = append(result, match)
+		}
+	}
+
+	return result, nil
+}
+
+// MatchPatterns は、名前が指定されたパターンのいずれかにマッチし、
+// かつ `!` で始まる除外パターンのどれにもマッチしない場合に true を返します。
+// 除外パターンしか指定されていない場合は、何にもマッチしません。
+func MatchPatterns(patterns []string, name string) (bool, error) {
+	var includes, excludes []string
+	for _, pattern := range patterns {
+		if strings.HasPrefix(pattern, "!") {
+			excludes = append(excludes, strings.TrimPrefix(pattern, "!"))
+		} else {
+			includes = append(includes, pattern)
+		}
+	}
+
+	included, err := matchAny(includes, name)
+	if err != nil || !included {
+		return false, err
+	}
+	excluded, err := matchAny(excludes, name)
+	if err != nil {
+		return false, err
+	}
+	return !excluded, nil
+}
+
+// matchAny は、名前がパターンのいずれかにマッチするかを返します
+func matchAny(patterns []string, name string) (bool, error) {
+	for _, pattern := range patterns {
+		ok, err := MatchPattern(pattern, name)
+		if err != nil {
+			return false, err
+		}
+		if ok {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+// MatchPattern は、パスがグロブパターンにマッチするかを判定します。
+// 次の記法をサポートします:
+//   - `*`, `?`, `[abc]`, `[^a-z]`: パス区切りを跨がない通常のワイルドカード
+//   - `**`: 0個以上のディレクトリ階層
+//   - `{a,b}`: ブレース展開（入れ子も可）
+func MatchPattern(pattern, name string) (bool, error) {
+	name = path.Clean(filepath.ToSlash(name))
+	for _, alt := range expandBraces(filepath.ToSlash(pattern)) {
+		if _, err := path.Match(strings.ReplaceAll(alt, "**", "*"), ""); err != nil {
+			return false, fmt.Errorf("パターンの形式が正しくありません: %s", pattern)
+		}
+		if matchSegments(splitSegments(alt), strings.Split(name, "/"), false) {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+// Glob は、グロブパターンにマッチするファイルのパスを返します。
+// `**` やブレース展開を含むパターンにも対応し、結果にはディレクトリを含みません。
+// 探索中は .git ディレクトリをスキップします。
+func Glob(pattern string) ([]string, error) {
+	var matches []string
+	seen := make(map[string]struct{})
+
+	for _, alt := range expandBraces(filepath.ToSlash(pattern)) {
+		if _, err := path.Match(strings.ReplaceAll(alt, "**", "*"), ""); err != nil {
+			return nil, fmt.Errorf("パターンの形式が正しくありません: %s", pattern)
+		}
+
+		found, err := globOne(alt)
+		if err != nil {
+			return nil, err
+		}
+		for _, match := range found {
+			if _, exists := seen[match]; !exists {
+				seen[match] = struct{}{}
+				matches = append(matches, match)
+			}
+		}
+	}
+
+	return matches, nil
+}
+
+// globOne は、ブレース展開済みの単一パターンを展開します
+func globOne(pattern string) ([]string, error) {
+	if !hasGlobMeta(pattern) {
+		return []string{filepath.FromSlash(pattern)}, nil
+	}
+
+	// メタ文字を含まない先頭のディレクトリ部分を探索の起点にする
+	segments := strings.Split(pattern, "/")
+	baseLen := 0
+	for baseLen < len(segments)-1 && !hasGlobMeta(segments[baseLen]) {
+		baseLen++
+	}
+	base := strings.Join(segments[:baseLen], "/")
+	if base == "" && baseLen > 0 {
+		base = "/"
+	}
+	if base == "" {
+		base = "."
+	}
+	rest := splitSegments(strings.Join(segments[baseLen:], "/"))
+
+	var matches []string
+	err := filepath.WalkDir(filepath.FromSlash(base), func(p string, d fs.DirEntry, err error) error {
+		if err != nil {
+			// 起点が存在しない場合はマッチなしとして扱う
+			if p == filepath.FromSlash(base) && os.IsNotExist(err) {
+				return filepath.SkipDir
+			}
+			return err
+		}
+
+		rel, err := filepath.Rel(filepath.FromSlash(base), p)
+		if err != nil {
+			return err
+		}
+		if rel == "." {
+			return nil
+		}
+		relSegments := strings.Split(filepath.ToSlash(rel), "/")
+
+		if d.IsDir() {
+			if d.Name() == ".git" || !matchSegments(rest, relSegments, true) {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+
+		if matchSegments(rest, relSegments, false) {
+			matches = append(matches, p)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return matches, nil
+}
+
+// matchSegments は、パターンのセグメント列がパスのセグメント列にマッチするかを判定します。
+// partial が true の場合、パスがマッチの途中（ディレクトリ）であれば true を返します。
+func matchSegments(pattern, name []string, partial bool) bool {
+	for len(pattern) > 0 {
+		if pattern[0] == "**" {
+			for len(pattern) > 0 && pattern[0] == "**" {
+				pattern = pattern[1:]
+			}
+			if len(pattern) == 0 {
+				return true
+			}
+			for i := 0; i <= len(name); i++ {
+				if matchSegments(pattern, name[i:], partial) {
+					return true
+				}
+			}
+			return false
+		}
+
+		if len(name) == 0 {
+			return partial
+		}
+		if ok, _ := path.Match(pattern[0], name[0]); !ok {
+			return false
+		}
+		pattern, name = pattern[1:], name[1:]
+	}
+	return len(name) == 0
+}
+
+// splitSegments は、パターンを正規化してセグメントに分割します
+func splitSegments(pattern string) []string {
+	return strings.Split(path.Clean(pattern), "/")
+}
+
+// hasGlobMeta は、文字列にグロブのメタ文字が含まれるかを返します
+func hasGlobMeta(s string) bool {
+	return strings.ContainsAny(s, "*?[")
+}
+
+// expandBraces は、`{a,b}` 形式のブレースを展開したパターンのリストを返します。
+// 対応する閉じ括弧がない場合やカンマを含まない場合は、文字どおりに扱います。
+func expandBraces(pattern string) []string {
+	start := strings.IndexByte(pattern, '{')
+	for start >= 0 {
+		depth := 0
+		end := -1
+		var commas []int
+		for i := start; i < len(pattern) && end < 0; i++ {
+			switch pattern[i] {
+			case '{':
+				depth++
+			case '}':
+				depth--
+				if depth == 0 {
+					end = i
+				}
+			case ',':
+				if depth == 1 {
+					commas = append(commas, i)
+				}
+			}
+		}
+
+		if end < 0 {
+			break
+		}
+		if len(commas) == 0 {
+			next := strings.IndexByte(pattern[start+1:], '{')
+			if next < 0 {
+				break
+			}
+			start += next + 1
+			continue
+		}
+
+		prefix, suffix := pattern[:start], pattern[end+1:]
+		var alternatives []string
+		prev := start + 1
+		for _, comma := range append(commas, end) {
+			alternatives = append(alternatives, pattern[prev:comma])
+			prev = comma + 1
+		}
+
+		var expanded []string
+		for _, alt := range alternatives {
+			expanded = append(expanded, expandBraces(prefix+alt+suffix)...)
+		}
+		return expanded
+	}
+
+	return []string{pattern}
+}
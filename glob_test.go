@@ -0,0 +1,90 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"testing"
+)
+
+func TestMatchPattern(t *testing.T) {
+	tests := []struct {
+		pattern string
+		name    string
+		want    bool
+	}{
+		{"*.go", "main.go", true},
+		{"*.go", "src/main.go", false},
+		{"**/*.go", "main.go", true},
+		{"**/*.go", "src/a/b/main.go", true},
+		{"src/**/test/*.go", "src/test/a.go", true},
+		{"src/**/test/*.go", "src/x/y/test/a.go", true},
+		{"src/**/test/*.go", "src/x/y/a.go", false},
+		{"src/**/test/**/*.go", "src/a/test/b/c.go", true},
+		{"**/*.{go,md}", "docs/README.md", true},
+		{"**/*.{go,md}", "docs/README.txt", false},
+		{"{cmd,pkg}/**/*.go", "pkg/x/y.go", true},
+		{"file[0-9].txt", "file3.txt", true},
+		{"file[^0-9].txt", "file3.txt", false},
+		{"vendor/**", "vendor/a/b.go", true},
+	}
+
+	for _, tt := range tests {
+		got, err := MatchPattern(tt.pattern, tt.name)
+		if err != nil {
+			t.Fatalf("MatchPattern(%q, %q) エラー: %v", tt.pattern, tt.name, err)
+		}
+		if got != tt.want {
+			t.Errorf("MatchPattern(%q, %q) = %t, 期待値 %t", tt.pattern, tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestSplitPatternList(t *testing.T) {
+	got := SplitPatternList("a.go, **/*.{go,md} ,!vendor/**,")
+	want := []string{"a.go", "**/*.{go,md}", "!vendor/**"}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("SplitPatternList() = %v, 期待値 %v", got, want)
+	}
+}
+
+func TestExpandPatterns(t *testing.T) {
+	dir := t.TempDir()
+	for _, f := range []string{"main.go", "README.md", "src/a.go", "src/test/b.go", "vendor/c.go", ".git/d.go"} {
+		path := filepath.Join(dir, f)
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			t.Fatalf("ディレクトリ作成エラー: %v", err)
+		}
+		if err := os.WriteFile(path, []byte("x"), 0644); err != nil {
+			t.Fatalf("ファイル作成エラー: %v", err)
+		}
+	}
+
+	got, err := ExpandPatterns([]string{dir + "/**/*.{go,md}", "!" + dir + "/vendor/**"})
+	if err != nil {
+		t.Fatalf("ExpandPatterns() エラー: %v", err)
+	}
+	for i := range got {
+		got[i], _ = filepath.Rel(dir, got[i])
+	}
+	sort.Strings(got)
+
+	want := []string{"README.md", "main.go", "src/a.go", "src/test/b.go"}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("ExpandPatterns() = %v, 期待値 %v", got, want)
+	}
+}
+
+func TestMatchPatterns(t *testing.T) {
+	patterns := []string{"*.go", "!main.go"}
+	if ok, _ := MatchPatterns(patterns, "util.go"); !ok {
+		t.Errorf("util.go はマッチするはずです")
+	}
+	if ok, _ := MatchPatterns(patterns, "main.go"); ok {
+		t.Errorf("main.go は除外されるはずです")
+	}
+	if ok, _ := MatchPatterns([]string{"!main.go"}, "util.go"); ok {
+		t.Errorf("除外パターンのみの場合は何にもマッチしないはずです")
+	}
+}
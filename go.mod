@@ -10,6 +10,11 @@ require (
 )
 
 require (
+	filippo.io/age v1.2.1
+	golang.org/x/sys v0.32.0
+	golang.org/x/term v0.31.0
 	golang.org/x/text v0.24.0
 	gopkg.in/yaml.v2 v2.4.0
 )
+
+require golang.org/x/crypto v0.24.0 // indirect
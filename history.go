@@ -0,0 +1,363 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	openai "github.com/sashabaranov/go-openai"
+)
+
+// HistoryConfig は会話履歴の設定で、以下のフィールドを含みます:
+// - AutoTitle: 自動保存（autoSaveLogs）した会話履歴の最初のやり取りの後に、会話のタイトルを自動で生成するかどうか（未指定の場合は true）
+// - TitleModel: タイトルの生成に使用するモデル（未指定の場合は OpenAI の API では gpt-4o-mini、providers や baseURL で他の接続先を使う場合は会話と同じモデル）
+// - RenameWithTitle: 自動保存した会話履歴のファイル名を、タイトルから作った名前に変更するかどうか
+// - SearchIndex: history grep/search で常に検索用のインデックスを使用するかどうか
+// - Encryption: 会話履歴の暗号化の設定
+// - Retention: 会話履歴の保存期間、数、合計サイズの上限
+type HistoryConfig struct {
+	AutoTitle       *bool                   `yaml:"autoTitle,omitempty"`
+	TitleModel      string                  `yaml:"titleModel,omitempty"`
+	RenameWithTitle bool                    `yaml:"renameWithTitle,omitempty"`
+	SearchIndex     bool                    `yaml:"searchIndex,omitempty"`
+	Encryption      HistoryEncryptionConfig `yaml:"encryption,omitempty"`
+	Retention       HistoryRetentionConfig  `yaml:"retention,omitempty"`
+}
+
+// AutoTitleEnabled はタイトルを自動で生成するかどうかを返します
+func (h HistoryConfig) AutoTitleEnabled() bool {
+	return h.AutoTitle == nil || *h.AutoTitle
+}
+
+// TitleModelName はタイトルの生成に使用するモデルを返します。
+// titleModel が未指定で、OpenAI 以外の接続先（customEndpoint が true）の場合は、gpt-4o-mini が使えないため会話のモデル model を返します。
+func (h HistoryConfig) TitleModelName(model string, customEndpoint bool) string {
+	switch {
+	case h.TitleModel != "":
+		return h.TitleModel
+	case customEndpoint && model != "":
+		return model
+	}
+	return defaultTitleModel
+}
+
+// HistoryMeta は会話履歴のファイルに保存するメタデータで、以下のフィールドを含みます:
+// - Title: 会話のタイトル
+// - CreatedAt, UpdatedAt: 会話の作成日時と最終更新日時
+// - Model: 最後に使用したモデル
+// - Prompt: 最後に使用したプロンプト名（-p）
+// - Tags: 会話に付けたタグ（-tags）
+// - Usage: これまでのリクエストのトークン使用量の合計
+// - ForkedFrom: history fork で分岐した会話の場合、分岐元の会話履歴の名前
+// - Pinned: 固定した会話かどうか（固定した会話履歴は保存期間などの上限を超えても削除しません）
+type HistoryMeta struct {
+	Title      string       `json:"title,omitempty"`
+	CreatedAt  time.Time    `json:"createdAt"`
+	UpdatedAt  time.Time    `json:"updatedAt"`
+	Model      string       `json:"model,omitempty"`
+	Prompt     string       `json:"prompt,omitempty"`
+	Tags       []string     `json:"tags,omitempty"`
+	Usage      HistoryUsage `json:"usage"`
+	ForkedFrom string       `json:"forkedFrom,omitempty"`
+	Pinned     bool         `json:"pinned,omitempty"`
+}
+
+// HistoryUsage はトークン使用量の合計です
+type HistoryUsage struct {
+	PromptTokens     int `json:"promptTokens"`
+	CompletionTokens int `json:"completionTokens"`
+	TotalTokens      int `json:"totalTokens"`
+}
+
+// Conversation は会話履歴のファイルの内容で、メタデータとメッセージの一覧からなります
+type Conversation struct {
+	Meta     HistoryMeta                    `json:"meta"`
+	Messages []openai.ChatCompletionMessage `json:"messages"`
+}
+
+// Turns は会話の往復の数（ユーザーのメッセージの数）を返します
+func (c Conversation) Turns() int {
+	turns := 0
+	for _, message := range c.Messages {
+		if message.Role == openai.ChatMessageRoleUser {
+			turns++
+		}
+	}
+	return turns
+}
+
+// DisplayTitle は一覧に表示するタイトルを返します。タイトルがない場合は最初のユーザーのメッセージの先頭を返します。
+func (c Conversation) DisplayTitle() string {
+	if c.Meta.Title != "" {
+		return c.Meta.Title
+	}
+	for _, message := range c.Messages {
+		if message.Role == openai.ChatMessageRoleUser {
+			return truncateText(strings.Join(strings.Fields(message.Content), " "), 60)
+		}
+	}
+	return "(タイトルなし)"
+}
+
+// HasTag は会話に指定したタグが付いているかを返します
+func (c Conversation) HasTag(tag string) bool {
+	for _, t := range c.Meta.Tags {
+		if t == tag {
+			return true
+		}
+	}
+	return false
+}
+
+// historyFilename は、拡張子のないファイル名に .json を付けます
+func historyFilename(filename string) string {
+	if filepath.Ext(filename) == "" {
+		filename += ".json"
+	}
+	return filename
+}
+
+// errNotConversation は、ログディレクトリの JSON ファイルが会話履歴ではない場合のエラーです
+var errNotConversation = errors.New("会話履歴のファイルではありません")
+
+// LoadConversation はファイルから会話履歴を読み込みます。
+// メタデータのない以前の形式（メッセージの配列）のファイルも読み込めます。その場合、日時はファイルの更新日時になります。
+// JSON として解析できないファイル、メタデータの日時がないファイル、ロールのないメッセージを含む配列は会話履歴として扱わず errNotConversation を返します。
+// ファイルが存在しない場合は空の会話を返します。
+func LoadConversation(filename string) (Conversation, error) {
+	var conversation Conversation
+	if filename == "" {
+		return conversation, nil
+	}
+	filename = historyFilename(filename)
+	data, err := os.ReadFile(filename)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return conversation, nil
+		}
+		return conversation, err
+	}
+	if data, err = openHistoryData(data); err != nil {
+		return conversation, err
+	}
+
+	if trimmed := bytes.TrimSpace(data); len(trimmed) > 0 && trimmed[0] == '[' {
+		if err := json.Unmarshal(trimmed, &conversation.Messages); err != nil {
+			return Conversation{}, fmt.Errorf("%w: %s: %v", errNotConversation, filename, err)
+		}
+		for _, message := range conversation.Messages {
+			if message.Role == "" {
+				return Conversation{}, fmt.Errorf("%w: %s", errNotConversation, filename)
+			}
+		}
+		if info, err := os.Stat(filename); err == nil {
+			conversation.Meta.CreatedAt = info.ModTime()
+			conversation.Meta.UpdatedAt = info.ModTime()
+		}
+		return conversation, nil
+	}
+	if err := json.Unmarshal(data, &conversation); err != nil {
+		return Conversation{}, fmt.Errorf("%w: %s: %v", errNotConversation, filename, err)
+	}
+	// package.json などの会話履歴ではない JSON は、作成日時と更新日時がないため区別できる
+	if conversation.Meta.CreatedAt.IsZero() && conversation.Meta.UpdatedAt.IsZero() {
+		return Conversation{}, fmt.Errorf("%w: %s", errNotConversation, filename)
+	}
+	return conversation, nil
+}
+
+// SaveConversation は会話履歴をメタデータとともにファイルに保存します。
+// 更新日時は現在の日時に、作成日時が未設定の場合は作成日時も現在の日時にします。
+func SaveConversation(filename string, conversation Conversation) error {
+	now := time.Now()
+	if conversation.Meta.CreatedAt.IsZero() {
+		conversation.Meta.CreatedAt = now
+	}
+	conversation.Meta.UpdatedAt = now
+	return writeConversation(filename, conversation)
+}
+
+// writeConversation は、会話履歴をメタデータの日時を変えずにファイルに書き込みます
+func writeConversation(filename string, conversation Conversation) error {
+	data, err := json.MarshalIndent(conversation, "", "  ")
+	if err != nil {
+		return err
+	}
+	if data, err = sealHistoryData(data); err != nil {
+		return err
+	}
+	return writeFileAtomic(historyFilename(filename), data, 0600)
+}
+
+// writeFileAtomic は、同じディレクトリの一時ファイルに書き込んでから名前を変更してファイルを置き換えます。
+// 書き込みの途中で中断した場合でも、元のファイルが壊れたり途中までの内容が読まれたりすることはありません。
+func writeFileAtomic(filename string, data []byte, perm os.FileMode) error {
+	tmp, err := os.CreateTemp(filepath.Dir(filename), "."+filepath.Base(filename)+".tmp-*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Sync(); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	if err := os.Chmod(tmp.Name(), perm); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), filename)
+}
+
+// historyLockFileName は、会話履歴の読み込みから保存までの間にかけるロックのファイル名です。
+// 会話履歴のファイルは保存のたびに置き換わるため、ロックはログディレクトリごとの別のファイルにかけます。
+const historyLockFileName = ".history.lock"
+
+// LockHistory は、会話履歴のあるディレクトリのロックファイルに排他ロックをかけ、ロックを解放する関数を返します。
+// 他のプロセスがロックしている場合は解放されるまで待ちます。
+func LockHistory(filename string) (func(), error) {
+	path := filepath.Join(filepath.Dir(historyFilename(filename)), historyLockFileName)
+	file, err := os.OpenFile(path, os.O_RDWR|os.O_CREATE, 0600)
+	if err != nil {
+		return nil, fmt.Errorf("会話履歴のロックファイルを開けません: %w", err)
+	}
+	if err := lockFile(file); err != nil {
+		file.Close()
+		return nil, fmt.Errorf("会話履歴のロックに失敗しました: %w", err)
+	}
+	return func() {
+		unlockFile(file)
+		file.Close()
+	}, nil
+}
+
+// UpdateConversation は、ロックをかけた状態で会話履歴を読み込み、update で変更して保存します
+func UpdateConversation(filename string, update func(conversation *Conversation) error) error {
+	unlock, err := LockHistory(filename)
+	if err != nil {
+		return err
+	}
+	defer unlock()
+
+	conversation, err := LoadConversation(filename)
+	if err != nil {
+		return err
+	}
+	if err := update(&conversation); err != nil {
+		return err
+	}
+	return SaveConversation(filename, conversation)
+}
+
+// HistorySnapshot は、実行の開始時に読み込んだ会話履歴の状態で、以下のフィールドを含みます:
+// - Loaded: 会話履歴を読み込んだかどうか（false の場合は保存するときに変更を検出しません）
+// - UpdatedAt: 読み込んだときの会話履歴の最終更新日時
+// - Messages: 読み込んだメッセージのうち、今回のリクエストに含めた数（これより後が今回追加したメッセージです）
+// - Dropped: -regenerate で取り除いた最後の応答のメッセージの数（保存するときに今回の応答で置き換えます）
+type HistorySnapshot struct {
+	Loaded    bool
+	UpdatedAt time.Time
+	Messages  int
+	Dropped   int
+}
+
+// LoadConversationHistory はファイルから会話履歴のメッセージを読み込みます
+func LoadConversationHistory(filename string) ([]openai.ChatCompletionMessage, error) {
+	conversation, err := LoadConversation(filename)
+	if err != nil {
+		return nil, err
+	}
+	if conversation.Messages == nil {
+		return []openai.ChatCompletionMessage{}, nil
+	}
+	return conversation.Messages, nil
+}
+
+// RecordConversation は、会話履歴のメッセージを保存し、メタデータのモデル、プロンプト名、タグ、トークン使用量を更新します。
+// 既存のファイルのタイトルや作成日時はそのまま残します。
+// options.HistoryBase を読み込んだ後に他のプロセスが会話履歴を更新していた場合は、上書きせずに今回追加したメッセージを末尾に追加します。
+func RecordConversation(filename string, history []openai.ChatCompletionMessage, model string, options Options, usage openai.Usage) error {
+	return UpdateConversation(filename, func(conversation *Conversation) error {
+		base := options.HistoryBase
+		loaded := base.Messages + base.Dropped
+		switch {
+		case !base.Loaded || conversation.Meta.UpdatedAt.Equal(base.UpdatedAt) || base.Messages > len(history):
+			conversation.Messages = history
+		case len(conversation.Messages) < loaded:
+			// 実行中に会話履歴が削除された（history rm や保存期間による削除）場合は、末尾に追加すると前の往復が失われるため全体を保存する
+			logger.Info("会話履歴が他のプロセスによって削除または短くされていたため、今回の会話全体を保存します: %s", historyFilename(filename))
+			conversation.Messages = history
+		case base.Dropped > 0 && len(conversation.Messages) > loaded:
+			return fmt.Errorf("会話履歴が他のプロセスによって更新されたため、生成し直した応答を保存しませんでした（history fork で分岐してから -regenerate してください）")
+		default:
+			// 読み込んだ後に追加されたメッセージの後に今回のメッセージを追加する。-regenerate の場合は取り除いた応答を今回の応答で置き換える
+			logger.Info("会話履歴が他のプロセスによって更新されていたため、今回のメッセージを末尾に追加します: %s", historyFilename(filename))
+			merged := append([]openai.ChatCompletionMessage{}, conversation.Messages[:len(conversation.Messages)-base.Dropped]...)
+			conversation.Messages = append(merged, history[base.Messages:]...)
+		}
+
+		if model != "" {
+			conversation.Meta.Model = model
+		}
+		if options.PromptOption != "" {
+			conversation.Meta.Prompt = options.PromptOption
+		}
+		for _, tag := range options.Tags {
+			if !conversation.HasTag(tag) {
+				conversation.Meta.Tags = append(conversation.Meta.Tags, tag)
+			}
+		}
+		conversation.Meta.Usage.PromptTokens += usage.PromptTokens
+		conversation.Meta.Usage.CompletionTokens += usage.CompletionTokens
+		conversation.Meta.Usage.TotalTokens += usage.TotalTokens
+		return nil
+	})
+}
+
+// HistoryEntry はログディレクトリにある会話履歴の1つのファイルです
+// - Name: ログディレクトリからの相対パス（拡張子なし。-history や -show-history に指定できます）
+type HistoryEntry struct {
+	Name         string
+	Path         string
+	Conversation Conversation
+}
+
+// ListConversations は、ログディレクトリにある会話履歴を更新日時の新しい順に返します。
+// 会話履歴として読み込めないファイルは読み飛ばします。
+func ListConversations(logDir string) ([]HistoryEntry, error) {
+	paths, err := historyPaths(logDir)
+	if err != nil {
+		return nil, err
+	}
+	return loadHistoryEntries(paths), nil
+}
+
+// historyPaths はログディレクトリにある会話履歴のファイルのパスを返します
+func historyPaths(logDir string) ([]string, error) {
+	return filepath.Glob(filepath.Join(logDir, "*.json"))
+}
+
+// historyEntryName は会話履歴のファイルのパスから、-history に指定できる名前を返します
+func historyEntryName(path string) string {
+	return strings.TrimSuffix(filepath.Base(path), ".json")
+}
+
+// truncateText は文字列を最大 n 文字に切り詰め、切り詰めた場合は末尾に … を付けます
+func truncateText(s string, n int) string {
+	runes := []rune(s)
+	if len(runes) <= n {
+		return s
+	}
+	return string(runes[:n]) + "…"
+}
@@ -0,0 +1,191 @@
+package main
+
+import (
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	openai "github.com/sashabaranov/go-openai"
+)
+
+// turnStart は、turn 往復目（1から数える）が始まるメッセージの位置を返します。
+// 往復はユーザーのメッセージから始まり、直前のシステムメッセージはその往復に含めます。
+// turn が往復の数より大きい場合は len(messages) を返します。
+func turnStart(messages []openai.ChatCompletionMessage, turn int) int {
+	count := 0
+	for i, message := range messages {
+		if message.Role != openai.ChatMessageRoleUser {
+			continue
+		}
+		count++
+		if count == turn {
+			for i > 0 && messages[i-1].Role == openai.ChatMessageRoleSystem {
+				i--
+			}
+			return i
+		}
+	}
+	return len(messages)
+}
+
+// ForkConversation は、会話の at 往復目までを含む新しい会話を返します。
+// タグ、モデル、プロンプト名は引き継ぎ、トークン使用量は引き継ぎません。ForkedFrom には分岐元の名前を記録します。
+func ForkConversation(conversation Conversation, source string, at int) (Conversation, error) {
+	turns := conversation.Turns()
+	if at < 1 || at > turns {
+		return Conversation{}, fmt.Errorf("分岐する往復は 1 から %d の範囲で指定してください: %d", turns, at)
+	}
+
+	messages := conversation.Messages[:turnStart(conversation.Messages, at+1)]
+	forked := Conversation{
+		Meta: HistoryMeta{
+			Model:      conversation.Meta.Model,
+			Prompt:     conversation.Meta.Prompt,
+			Tags:       append([]string{}, conversation.Meta.Tags...),
+			ForkedFrom: source,
+		},
+		Messages: append([]openai.ChatCompletionMessage{}, messages...),
+	}
+	if conversation.Meta.Title != "" {
+		forked.Meta.Title = fmt.Sprintf("%s（%d往復目から分岐）", conversation.Meta.Title, at)
+	}
+	return forked, nil
+}
+
+// forkName は、分岐した会話履歴の名前を指定しなかった場合の名前（元の名前_fork_日時）を返します
+func forkName(name string, now time.Time) string {
+	return strings.TrimSuffix(name, ".json") + "_fork_" + now.Format("20060102_150405")
+}
+
+// DropLastResponse は、最後のユーザーのメッセージより後のメッセージ（アシスタントの応答とツールの結果）を取り除きます。
+// -regenerate で最後の質問をもう一度送るために使います。
+func DropLastResponse(messages []openai.ChatCompletionMessage) ([]openai.ChatCompletionMessage, error) {
+	for i := len(messages) - 1; i >= 0; i-- {
+		if messages[i].Role == openai.ChatMessageRoleUser {
+			return messages[:i+1], nil
+		}
+	}
+	return nil, fmt.Errorf("会話履歴にユーザーのメッセージがないため、応答を生成し直せません")
+}
+
+// turnEditHeaderPattern は、編集用のテキストでメッセージを区切る「=== 番号: ロール ===」の行に一致する正規表現です
+var turnEditHeaderPattern = regexp.MustCompile(`^=== (\d+): (\w+) ===$`)
+
+// turnEditNote は、編集用のテキストの先頭に付ける説明です
+const turnEditNote = `# 「=== 番号: ロール ===」の行の後のメッセージの本文を編集してください。
+# 区切りの行を変更したり削除したりすることはできません。「#」で始まるこの説明の行は無視されます。
+# すべてを削除して保存した場合は編集を中止します。
+`
+
+// editableMessage は、編集用のテキストに含めるメッセージかを返します。
+// 画像を含むメッセージは編集の対象にしません。
+func editableMessage(message openai.ChatCompletionMessage) bool {
+	return len(message.MultiContent) == 0 && !embeddedImagePattern.MatchString(message.Content)
+}
+
+// FormatTurnForEdit は、メッセージを $EDITOR で編集するためのテキストにします
+func FormatTurnForEdit(messages []openai.ChatCompletionMessage) string {
+	var sb strings.Builder
+	sb.WriteString(turnEditNote)
+	for i, message := range messages {
+		if !editableMessage(message) {
+			continue
+		}
+		fmt.Fprintf(&sb, "\n=== %d: %s ===\n%s\n", i+1, message.Role, message.Content)
+	}
+	return sb.String()
+}
+
+// ParseEditedTurn は、FormatTurnForEdit のテキストを編集した結果を messages に反映したコピーを返します。
+// テキストが空の場合は変更しなかったものとして false を返します。
+func ParseEditedTurn(text string, messages []openai.ChatCompletionMessage) ([]openai.ChatCompletionMessage, bool, error) {
+	edited := append([]openai.ChatCompletionMessage{}, messages...)
+	seen := make(map[int]bool)
+	current := -1
+	var body []string
+	flush := func() {
+		if current >= 0 {
+			edited[current].Content = strings.Trim(strings.Join(body, "\n"), "\n")
+		}
+		body = nil
+	}
+
+	empty := true
+	for _, line := range strings.Split(strings.ReplaceAll(text, "\r\n", "\n"), "\n") {
+		if current < 0 && (strings.HasPrefix(line, "#") || strings.TrimSpace(line) == "") {
+			continue
+		}
+		empty = false
+		m := turnEditHeaderPattern.FindStringSubmatch(line)
+		if m == nil {
+			if current < 0 {
+				return nil, false, fmt.Errorf("最初のメッセージの区切りの行より前に本文があります: %s", line)
+			}
+			body = append(body, line)
+			continue
+		}
+		flush()
+		index, _ := strconv.Atoi(m[1])
+		index--
+		if index < 0 || index >= len(messages) || messages[index].Role != m[2] || !editableMessage(messages[index]) || seen[index] {
+			return nil, false, fmt.Errorf("メッセージの区切りの行が正しくありません: %s", line)
+		}
+		seen[index] = true
+		current = index
+	}
+	if empty {
+		return messages, false, nil
+	}
+	flush()
+
+	for i, message := range messages {
+		if editableMessage(message) && !seen[i] {
+			return nil, false, fmt.Errorf("%d 番目のメッセージ（%s）の区切りの行が削除されています", i+1, message.Role)
+		}
+	}
+	return edited, true, nil
+}
+
+// EditConversationTurn は、会話の turn 往復目（0 の場合は最後の往復）のメッセージを edit で編集します。
+// edit は編集用のテキストを受け取り、編集後のテキストを返します。変更があった場合は true を返します。
+func EditConversationTurn(conversation Conversation, turn int, edit func(string) (string, error)) (Conversation, bool, error) {
+	turns := conversation.Turns()
+	if turns == 0 {
+		return conversation, false, fmt.Errorf("会話履歴にユーザーのメッセージがありません")
+	}
+	if turn == 0 {
+		turn = turns
+	}
+	if turn < 1 || turn > turns {
+		return conversation, false, fmt.Errorf("編集する往復は 1 から %d の範囲で指定してください: %d", turns, turn)
+	}
+
+	start := turnStart(conversation.Messages, turn)
+	end := turnStart(conversation.Messages, turn+1)
+	original := conversation.Messages[start:end]
+	text, err := edit(FormatTurnForEdit(original))
+	if err != nil {
+		return conversation, false, err
+	}
+	edited, ok, err := ParseEditedTurn(text, original)
+	if err != nil || !ok {
+		return conversation, false, err
+	}
+
+	changed := false
+	for i := range original {
+		if edited[i].Content != original[i].Content {
+			changed = true
+		}
+	}
+	if !changed {
+		return conversation, false, nil
+	}
+	messages := append([]openai.ChatCompletionMessage{}, conversation.Messages[:start]...)
+	messages = append(messages, edited...)
+	messages = append(messages, conversation.Messages[end:]...)
+	conversation.Messages = messages
+	return conversation, true, nil
+}
@@ -0,0 +1,87 @@
+package main
+
+import (
+	"strings"
+	"testing"
+
+	openai "github.com/sashabaranov/go-openai"
+)
+
+func testBranchConversation() Conversation {
+	return Conversation{
+		Meta: HistoryMeta{Title: "設計の相談", Tags: []string{"go"}, Usage: HistoryUsage{TotalTokens: 100}},
+		Messages: []openai.ChatCompletionMessage{
+			{Role: openai.ChatMessageRoleSystem, Content: "あなたはレビュアーです"},
+			{Role: openai.ChatMessageRoleUser, Content: "質問1"},
+			{Role: openai.ChatMessageRoleAssistant, Content: "回答1"},
+			{Role: openai.ChatMessageRoleSystem, Content: "あなたはレビュアーです"},
+			{Role: openai.ChatMessageRoleUser, Content: "質問2"},
+			{Role: openai.ChatMessageRoleAssistant, Content: "回答2"},
+			{Role: openai.ChatMessageRoleUser, Content: "質問3"},
+			{Role: openai.ChatMessageRoleAssistant, Content: "回答3"},
+		},
+	}
+}
+
+func TestForkConversation(t *testing.T) {
+	forked, err := ForkConversation(testBranchConversation(), "design", 1)
+	if err != nil {
+		t.Fatalf("ForkConversation() エラー: %v", err)
+	}
+	if len(forked.Messages) != 3 || forked.Messages[2].Content != "回答1" {
+		t.Errorf("1往復目までのメッセージ（次の往復のシステムメッセージを除く）が必要です: %+v", forked.Messages)
+	}
+	if forked.Meta.ForkedFrom != "design" || forked.Meta.Usage.TotalTokens != 0 || !forked.HasTag("go") || !strings.HasPrefix(forked.Meta.Title, "設計の相談") {
+		t.Errorf("メタデータが正しくありません: %+v", forked.Meta)
+	}
+
+	if _, err := ForkConversation(testBranchConversation(), "design", 4); err == nil {
+		t.Error("往復の数を超えた場合にエラーになりません")
+	}
+}
+
+func TestDropLastResponse(t *testing.T) {
+	messages, err := DropLastResponse(testBranchConversation().Messages)
+	if err != nil {
+		t.Fatalf("DropLastResponse() エラー: %v", err)
+	}
+	if len(messages) != 7 || messages[6].Content != "質問3" {
+		t.Errorf("最後の応答だけを削除する必要があります: %+v", messages)
+	}
+
+	if _, err := DropLastResponse([]openai.ChatCompletionMessage{{Role: openai.ChatMessageRoleSystem, Content: "s"}}); err == nil {
+		t.Error("ユーザーのメッセージがない場合にエラーになりません")
+	}
+}
+
+func TestEditConversationTurn(t *testing.T) {
+	conversation := testBranchConversation()
+	edited, changed, err := EditConversationTurn(conversation, 2, func(text string) (string, error) {
+		if !strings.Contains(text, "=== 2: user ===\n質問2\n") || strings.Contains(text, "質問1") {
+			t.Errorf("2往復目のメッセージだけを編集する必要があります:\n%s", text)
+		}
+		return strings.Replace(text, "質問2", "質問2（修正）\n# コメントではない行", 1), nil
+	})
+	if err != nil || !changed {
+		t.Fatalf("EditConversationTurn() = %v, %v", changed, err)
+	}
+	if edited.Messages[4].Content != "質問2（修正）\n# コメントではない行" || edited.Messages[6].Content != "質問3" || len(edited.Messages) != 8 {
+		t.Errorf("編集が反映されていません: %+v", edited.Messages)
+	}
+	if conversation.Messages[4].Content != "質問2" {
+		t.Error("元の会話が変更されています")
+	}
+
+	// 空にした場合は中止する
+	if _, changed, err := EditConversationTurn(conversation, 0, func(string) (string, error) { return "", nil }); err != nil || changed {
+		t.Errorf("空の場合は変更しない必要があります: %v, %v", changed, err)
+	}
+
+	// 区切りの行を削除した場合はエラー
+	_, _, err = EditConversationTurn(conversation, 0, func(text string) (string, error) {
+		return strings.Replace(text, "=== 2: assistant ===\n", "", 1), nil
+	})
+	if err == nil {
+		t.Error("区切りの行を削除した場合にエラーになりません")
+	}
+}
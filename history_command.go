@@ -0,0 +1,472 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// runHistoryCommand は history サブコマンドを実行します。
+//   - history list [-tag <tag>] [-n <件数>]: 会話履歴を更新日時の新しい順に表示
+//   - history grep [検索のオプション] <pattern>: すべての会話履歴から一致した行を「名前:往復 [ロール] 前後の文字列」の形式で表示
+//   - history search [検索のオプション] <pattern>: 一致した会話履歴を一覧で表示
+//   - history index: 検索用のインデックスを更新
+//   - history rm [-y] <name>...: 会話履歴を削除
+//   - history title <name> [title]: 会話履歴のタイトルを設定（title を省略した場合はモデルで生成）
+//   - history fork [-at <往復>] <name> [new-name]: 会話履歴の指定した往復までを新しい会話履歴にコピー
+//   - history edit [-turn <往復>] <name>: 指定した往復（省略した場合は最後の往復）のメッセージを $EDITOR で編集
+//   - history export [-format markdown|html|jsonl] [-o <file>] [-all] <name>...: 会話履歴をエクスポート
+//   - history import <conversations.json>: ChatGPT のデータエクスポートから会話履歴を取り込む
+//   - history pin <name>... / history unpin <name>...: 会話履歴を固定（保存期間などの上限を超えても削除しない）または固定を解除
+//   - history prune [-dry-run] [-y]: 設定ファイルの history.retention の上限を超えた会話履歴を削除
+//   - history keygen <file>: 会話履歴の暗号化に使う age の鍵を作成
+//   - history encrypt / history decrypt: 既存の会話履歴と検索用のインデックスを暗号化または復号
+//
+// 検索のオプションは -regex, -case-sensitive, -role, -since, -until, -tag, -index です。
+func runHistoryCommand(options Options, config Config, args []string) error {
+	fs := newSubcommandFlagSet("history")
+	tag := fs.String("tag", "", "指定したタグが付いた会話履歴だけを対象にする")
+	limit := fs.Int("n", 0, "表示する件数（0 の場合はすべて）")
+	yes := fs.Bool("y", false, "確認せずに削除する")
+	dryRun := fs.Bool("dry-run", false, "prune で削除せずに、削除する会話履歴を表示する")
+	regex := fs.Bool("regex", false, "検索する文字列を正規表現として扱う")
+	caseSensitive := fs.Bool("case-sensitive", false, "大文字と小文字を区別して検索する")
+	roles := fs.String("role", "", "検索するメッセージのロールをカンマ区切りで指定（user, assistant, system）")
+	since := fs.String("since", "", "この日時以降の会話履歴だけを検索（2006-01-02、RFC 3339、または 30d のような期間）")
+	until := fs.String("until", "", "この日時以前の会話履歴だけを検索（2006-01-02、RFC 3339、または 30d のような期間）")
+	useIndex := fs.Bool("index", config.History.SearchIndex, "検索用のインデックスで検索するファイルを絞り込む")
+	at := fs.Int("at", 0, "fork で新しい会話履歴に含める往復の数")
+	turn := fs.Int("turn", 0, "edit で編集する往復（0 の場合は最後の往復）")
+	format := fs.String("format", "", "エクスポートの形式（markdown, html, jsonl。省略した場合は -o の拡張子から推測）")
+	output := fs.String("o", "", "エクスポートの出力先のファイル（省略した場合は標準出力）")
+	all := fs.Bool("all", false, "すべての会話履歴をエクスポートする（jsonl のみ）")
+	positional, err := parseSubcommandFlags(fs, args)
+	if err != nil {
+		return err
+	}
+	if len(positional) == 0 {
+		return fmt.Errorf("history のアクションを指定してください (list, grep, search, index, rm, title, fork, edit, export, import, pin, unpin, prune, keygen, encrypt, decrypt)")
+	}
+
+	logDir := GetLogDirectory(config)
+	switch positional[0] {
+	case "list":
+		entries, err := ListConversations(logDir)
+		if err != nil {
+			return err
+		}
+		if *tag != "" {
+			entries = filterByTag(entries, *tag)
+		}
+		if *limit > 0 && len(entries) > *limit {
+			entries = entries[:*limit]
+		}
+		if len(entries) == 0 {
+			fmt.Println("会話履歴はありません。")
+			return nil
+		}
+		PrintHistoryEntries(os.Stdout, entries)
+		return nil
+	case "grep", "search":
+		if len(positional) < 2 {
+			return fmt.Errorf("検索する文字列を指定してください (history %s <pattern>)", positional[0])
+		}
+		query := HistoryQuery{
+			Pattern:       strings.Join(positional[1:], " "),
+			Regex:         *regex,
+			CaseSensitive: *caseSensitive,
+			Roles:         SplitPatternList(*roles),
+			Tag:           *tag,
+		}
+		now := time.Now()
+		if *since != "" {
+			if query.Since, err = ParseHistoryDate(*since, now, false); err != nil {
+				return err
+			}
+		}
+		if *until != "" {
+			if query.Until, err = ParseHistoryDate(*until, now, true); err != nil {
+				return err
+			}
+		}
+
+		results, err := SearchHistory(logDir, query, *useIndex)
+		if err != nil {
+			return err
+		}
+		if *limit > 0 && len(results) > *limit {
+			results = results[:*limit]
+		}
+		if len(results) == 0 {
+			fmt.Println("一致する会話履歴はありません。")
+			return nil
+		}
+		if positional[0] == "grep" {
+			PrintHistoryMatches(os.Stdout, results, useColor(os.Stdout))
+			return nil
+		}
+		entries := make([]HistoryEntry, len(results))
+		for i, result := range results {
+			entries[i] = result.Entry
+		}
+		PrintHistoryEntries(os.Stdout, entries)
+		return nil
+	case "index":
+		paths, err := historyPaths(logDir)
+		if err != nil {
+			return err
+		}
+		index := LoadSearchIndex(logDir)
+		updated := index.Update(paths)
+		if err := index.Save(logDir); err != nil {
+			return err
+		}
+		fmt.Printf("検索用のインデックスを更新しました（会話履歴 %d 件、更新 %d 件）。\n", len(index.Files), updated)
+		return nil
+	case "rm":
+		if len(positional) < 2 {
+			return fmt.Errorf("削除する会話履歴の名前を指定してください (history rm <name>...)")
+		}
+		return removeHistories(logDir, positional[1:], *yes)
+	case "title":
+		if len(positional) < 2 {
+			return fmt.Errorf("タイトルを設定する会話履歴の名前を指定してください (history title <name> [title])")
+		}
+		return setHistoryTitle(options, config, positional[1], strings.Join(positional[2:], " "))
+	case "fork":
+		if len(positional) < 2 || len(positional) > 3 {
+			return fmt.Errorf("分岐する会話履歴の名前を指定してください (history fork -at <往復> <name> [new-name])")
+		}
+		newName := forkName(positional[1], time.Now())
+		if len(positional) == 3 {
+			newName = positional[2]
+		}
+		return forkHistory(logDir, positional[1], newName, *at)
+	case "edit":
+		if len(positional) != 2 {
+			return fmt.Errorf("編集する会話履歴の名前を指定してください (history edit [-turn <往復>] <name>)")
+		}
+		return editHistory(logDir, positional[1], *turn)
+	case "export":
+		exportFormat, err := ResolveExportFormat(*format, *output)
+		if err != nil {
+			return err
+		}
+		return exportHistories(logDir, positional[1:], *all, *tag, exportFormat, *output)
+	case "import":
+		if len(positional) != 2 {
+			return fmt.Errorf("ChatGPT のエクスポートの conversations.json を指定してください (history import <conversations.json>)")
+		}
+		tags := []string{"chatgpt"}
+		if *tag != "" {
+			tags = append(tags, *tag)
+		}
+		imported, skipped, err := ImportChatGPTConversations(positional[1], logDir, tags)
+		if err != nil {
+			return err
+		}
+		fmt.Printf("%d 件の会話を取り込みました（読み飛ばした会話: %d 件）。\n", imported, skipped)
+		return nil
+	case "pin", "unpin":
+		if len(positional) < 2 {
+			return fmt.Errorf("会話履歴の名前を指定してください (history %s <name>...)", positional[0])
+		}
+		return setHistoryPinned(logDir, positional[1:], positional[0] == "pin")
+	case "prune":
+		return pruneHistories(logDir, config.History.Retention, *dryRun, *yes)
+	case "keygen":
+		if len(positional) != 2 {
+			return fmt.Errorf("鍵を保存するファイルを指定してください (history keygen <file>)")
+		}
+		recipient, err := GenerateHistoryKey(positional[1])
+		if err != nil {
+			return err
+		}
+		fmt.Printf("鍵を %s に保存しました（公開鍵: %s）。\n", positional[1], recipient)
+		fmt.Println("設定ファイルの history.encryption.identityFile にこのファイルを指定してください。鍵をなくすと会話履歴を読み込めなくなります。")
+		return nil
+	case "encrypt", "decrypt":
+		converted, err := MigrateHistoryEncryption(logDir, positional[0] == "encrypt")
+		if err != nil {
+			return err
+		}
+		if positional[0] == "encrypt" {
+			fmt.Printf("%d 件の会話履歴を暗号化しました。\n", converted)
+		} else {
+			fmt.Printf("%d 件の会話履歴を復号しました。\n", converted)
+		}
+		return nil
+	default:
+		return fmt.Errorf("不正な history のアクションが指定されました: %s", positional[0])
+	}
+}
+
+// filterByTag は指定したタグが付いた会話履歴だけを返します
+func filterByTag(entries []HistoryEntry, tag string) []HistoryEntry {
+	var filtered []HistoryEntry
+	for _, entry := range entries {
+		if entry.Conversation.HasTag(tag) {
+			filtered = append(filtered, entry)
+		}
+	}
+	return filtered
+}
+
+// PrintHistoryEntries は会話履歴を「名前、更新日時、往復の数、タイトル、タグ」の一覧として表示します
+func PrintHistoryEntries(w io.Writer, entries []HistoryEntry) {
+	nameWidth := 0
+	for _, entry := range entries {
+		nameWidth = max(nameWidth, displayWidth(entry.Name))
+	}
+	for _, entry := range entries {
+		conversation := entry.Conversation
+		line := fmt.Sprintf("%s  %s  %3d往復  %s",
+			padRight(entry.Name, nameWidth),
+			conversation.Meta.UpdatedAt.Local().Format("2006-01-02 15:04"),
+			conversation.Turns(),
+			conversation.DisplayTitle())
+		if conversation.Meta.Pinned {
+			line += "  (固定)"
+		}
+		if len(conversation.Meta.Tags) > 0 {
+			line += fmt.Sprintf("  [%s]", strings.Join(conversation.Meta.Tags, ", "))
+		}
+		fmt.Fprintln(w, line)
+	}
+}
+
+// resolveHistoryPath は、会話履歴の名前をログディレクトリ内のファイルのパスにします
+func resolveHistoryPath(logDir, name string) (string, error) {
+	name = historyFilename(name)
+	if !filepath.IsLocal(name) {
+		return "", fmt.Errorf("ログディレクトリの外の会話履歴は指定できません: %s", name)
+	}
+	return filepath.Join(logDir, name), nil
+}
+
+// removeHistories は会話履歴を削除します。yes が false の場合は削除する前に確認します。
+func removeHistories(logDir string, names []string, yes bool) error {
+	var paths []string
+	for _, name := range names {
+		path, err := resolveHistoryPath(logDir, name)
+		if err != nil {
+			return err
+		}
+		if _, err := os.Stat(path); err != nil {
+			return fmt.Errorf("会話履歴が見つかりません: %s", name)
+		}
+		paths = append(paths, path)
+	}
+
+	if !yes {
+		reader, closeReader := terminalReader()
+		defer closeReader()
+		if !confirm(reader, fmt.Sprintf("%d 件の会話履歴を削除しますか？", len(paths))) {
+			fmt.Fprintln(os.Stderr, "削除を中止しました。")
+			return nil
+		}
+	}
+
+	for _, path := range paths {
+		if err := os.Remove(path); err != nil {
+			return fmt.Errorf("会話履歴の削除に失敗しました: %w", err)
+		}
+		fmt.Fprintf(os.Stderr, "削除しました: %s\n", path)
+	}
+	return nil
+}
+
+// setHistoryTitle は会話履歴のタイトルを設定します。title が空の場合はモデルでタイトルを生成します。
+func setHistoryTitle(options Options, config Config, name, title string) error {
+	path, conversation, err := loadHistoryByName(GetLogDirectory(config), name)
+	if err != nil {
+		return err
+	}
+
+	if title == "" {
+		client, err := NewOpenAIClientWithConfig(config, "", options.Timeout)
+		if err != nil {
+			return err
+		}
+		title, err = GenerateTitle(client, config.History.TitleModelName(conversation.Meta.Model, usesCustomEndpoint(config, "")), conversation.Messages)
+		if err != nil {
+			return fmt.Errorf("会話のタイトルの生成に失敗しました: %w", err)
+		}
+	}
+	err = UpdateConversation(path, func(conversation *Conversation) error {
+		conversation.Meta.Title = title
+		return nil
+	})
+	if err != nil {
+		return fmt.Errorf("会話履歴の保存に失敗しました: %w", err)
+	}
+	fmt.Println(title)
+	return nil
+}
+
+// exportHistories は会話履歴を指定した形式でエクスポートします。
+// markdown と html は1つの会話履歴だけを、jsonl は複数の会話履歴（all の場合はすべて）をエクスポートできます。
+func exportHistories(logDir string, names []string, all bool, tag, format, output string) error {
+	var conversations []Conversation
+	if all {
+		entries, err := ListConversations(logDir)
+		if err != nil {
+			return err
+		}
+		if tag != "" {
+			entries = filterByTag(entries, tag)
+		}
+		for _, entry := range entries {
+			conversations = append(conversations, entry.Conversation)
+		}
+	}
+	for _, name := range names {
+		_, conversation, err := loadHistoryByName(logDir, name)
+		if err != nil {
+			return err
+		}
+		conversations = append(conversations, conversation)
+	}
+
+	if len(conversations) == 0 {
+		return fmt.Errorf("エクスポートする会話履歴の名前を指定してください (history export <name>...)")
+	}
+	if format != ExportFormatJSONL && len(conversations) != 1 {
+		return fmt.Errorf("%s では1つの会話履歴だけをエクスポートできます（複数の会話履歴は -format jsonl を指定してください）", format)
+	}
+
+	w := os.Stdout
+	if output != "" {
+		file, err := os.OpenFile(output, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0600)
+		if err != nil {
+			return fmt.Errorf("出力先のファイルを作成できません: %w", err)
+		}
+		defer file.Close()
+		w = file
+	}
+
+	switch format {
+	case ExportFormatHTML:
+		return ExportHTML(w, conversations[0])
+	case ExportFormatJSONL:
+		written, err := ExportJSONL(w, conversations)
+		if err != nil {
+			return err
+		}
+		if skipped := len(conversations) - written; skipped > 0 {
+			fmt.Fprintf(os.Stderr, "アシスタントの応答を含まない %d 件の会話履歴はエクスポートしませんでした。\n", skipped)
+		}
+		return nil
+	default:
+		return ExportMarkdown(w, conversations[0])
+	}
+}
+
+// loadHistoryByName は、ログディレクトリの会話履歴を名前で読み込み、ファイルのパスと会話を返します
+func loadHistoryByName(logDir, name string) (string, Conversation, error) {
+	path, err := resolveHistoryPath(logDir, name)
+	if err != nil {
+		return "", Conversation{}, err
+	}
+	if _, err := os.Stat(path); err != nil {
+		return "", Conversation{}, fmt.Errorf("会話履歴が見つかりません: %s", name)
+	}
+	conversation, err := LoadConversation(path)
+	if err != nil {
+		return "", Conversation{}, fmt.Errorf("会話履歴の読み込みに失敗しました (%s): %w", name, err)
+	}
+	return path, conversation, nil
+}
+
+// forkHistory は、会話履歴の at 往復目までを newName の会話履歴として保存します
+func forkHistory(logDir, name, newName string, at int) error {
+	_, conversation, err := loadHistoryByName(logDir, name)
+	if err != nil {
+		return err
+	}
+	forked, err := ForkConversation(conversation, strings.TrimSuffix(name, ".json"), at)
+	if err != nil {
+		return err
+	}
+
+	target, err := resolveHistoryPath(logDir, newName)
+	if err != nil {
+		return err
+	}
+	if _, err := os.Stat(target); err == nil {
+		return fmt.Errorf("会話履歴が既に存在します: %s", newName)
+	}
+	if err := SaveConversation(target, forked); err != nil {
+		return fmt.Errorf("会話履歴の保存に失敗しました: %w", err)
+	}
+	fmt.Printf("%d往復目までを %s に保存しました（続けるには -history %s を指定してください）。\n", at, target, strings.TrimSuffix(newName, ".json"))
+	return nil
+}
+
+// editHistory は、会話履歴の turn 往復目のメッセージを $EDITOR で編集して保存します
+func editHistory(logDir, name string, turn int) error {
+	path, conversation, err := loadHistoryByName(logDir, name)
+	if err != nil {
+		return err
+	}
+	edited, changed, err := EditConversationTurn(conversation, turn, func(text string) (string, error) {
+		return editInEditor(text, "history.md")
+	})
+	if err != nil {
+		return err
+	}
+	if !changed {
+		fmt.Fprintln(os.Stderr, "会話履歴は変更されませんでした。")
+		return nil
+	}
+	err = UpdateConversation(path, func(latest *Conversation) error {
+		if !latest.Meta.UpdatedAt.Equal(conversation.Meta.UpdatedAt) {
+			return fmt.Errorf("編集している間に会話履歴が他のプロセスによって更新されました。もう一度編集してください")
+		}
+		*latest = edited
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	fmt.Fprintf(os.Stderr, "会話履歴を更新しました: %s\n", path)
+	return nil
+}
+
+// pruneHistories は、保存期間などの上限を超えた会話履歴を表示し、確認してから削除します
+func pruneHistories(logDir string, retention HistoryRetentionConfig, dryRun, yes bool) error {
+	if !retention.Enabled() {
+		return fmt.Errorf("設定ファイルの history.retention に maxAge、maxCount、maxTotalSize のいずれかを指定してください")
+	}
+	candidates, err := PruneHistory(logDir, retention, "", true)
+	if err != nil {
+		return err
+	}
+	if len(candidates) == 0 {
+		fmt.Println("削除する会話履歴はありません。")
+		return nil
+	}
+	PrintPruneCandidates(os.Stdout, candidates)
+	if dryRun {
+		return nil
+	}
+
+	if !yes {
+		reader, closeReader := terminalReader()
+		defer closeReader()
+		if !confirm(reader, fmt.Sprintf("%d 件の会話履歴を削除しますか？", len(candidates))) {
+			fmt.Fprintln(os.Stderr, "削除を中止しました。")
+			return nil
+		}
+	}
+	for _, candidate := range candidates {
+		if err := os.Remove(candidate.Entry.Path); err != nil {
+			return fmt.Errorf("会話履歴の削除に失敗しました: %w", err)
+		}
+	}
+	fmt.Fprintf(os.Stderr, "%d 件の会話履歴を削除しました。\n", len(candidates))
+	return nil
+}
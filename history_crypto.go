@@ -0,0 +1,320 @@
+package main
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"filippo.io/age"
+)
+
+// HistoryEncryptionConfig は会話履歴の暗号化の設定で、以下のフィールドを含みます:
+// - Enabled: 保存する会話履歴と検索用のインデックスを age で暗号化するかどうか
+// - IdentityFile: age の秘密鍵のファイル（age-keygen や history keygen で作成）。複数の鍵がある場合はすべて復号に使い、最初の鍵で暗号化します。
+// - Passphrase: 鍵のファイルの代わりに使うパスフレーズ（${secret:name} で参照できます）。ログディレクトリの .history.key に保存した鍵をパスフレーズで復号して使います。
+//
+// 鍵のファイルかパスフレーズが設定されていれば、Enabled が false でも暗号化された会話履歴を読み込めます。
+type HistoryEncryptionConfig struct {
+	Enabled      bool   `yaml:"enabled,omitempty"`
+	IdentityFile string `yaml:"identityFile,omitempty"`
+	Passphrase   string `yaml:"passphrase,omitempty"`
+}
+
+// ageHeader は age で暗号化したファイルの先頭の文字列です
+const ageHeader = "age-encryption.org/"
+
+// historyKeyFileName は、パスフレーズで暗号化した会話履歴の鍵を保存するログディレクトリのファイル名です
+const historyKeyFileName = ".history.key"
+
+// errHistoryKeyMissing は、暗号化された会話履歴を読み込む鍵が設定されていない場合のエラーです
+var errHistoryKeyMissing = errors.New("暗号化された会話履歴を読み込むには history.encryption の identityFile または passphrase を設定してください")
+
+// historyKeyring は会話履歴の暗号化に使う鍵です。鍵は最初に必要になったときに読み込みます。
+type historyKeyring struct {
+	config     Config
+	loaded     bool
+	recipient  age.Recipient
+	identities []age.Identity
+}
+
+// historyEncryption は SetupHistoryEncryption で設定した会話履歴の暗号化の鍵です
+var historyEncryption = &historyKeyring{}
+
+// SetupHistoryEncryption は設定ファイルの history.encryption から会話履歴の暗号化を設定します
+func SetupHistoryEncryption(config Config) {
+	historyEncryption = &historyKeyring{config: config}
+}
+
+// HistoryEncrypted は、会話履歴を暗号化して保存するかどうかを返します
+func HistoryEncrypted() bool {
+	return historyEncryption.config.History.Encryption.Enabled
+}
+
+// load は鍵のファイルまたはパスフレーズから鍵を読み込みます
+func (k *historyKeyring) load() error {
+	if k.loaded {
+		return nil
+	}
+	encryption := k.config.History.Encryption
+	switch {
+	case encryption.IdentityFile != "":
+		path := encryption.IdentityFile
+		if strings.HasPrefix(path, "~/") {
+			home, err := os.UserHomeDir()
+			if err != nil {
+				return fmt.Errorf("ホームディレクトリの取得に失敗しました: %w", err)
+			}
+			path = filepath.Join(home, path[2:])
+		}
+		file, err := os.Open(filepath.Clean(path))
+		if err != nil {
+			return fmt.Errorf("会話履歴の暗号化の鍵のファイルを開けません: %w", err)
+		}
+		defer file.Close()
+		identities, err := age.ParseIdentities(file)
+		if err != nil {
+			return fmt.Errorf("会話履歴の暗号化の鍵のファイルの解析に失敗しました: %w", err)
+		}
+		k.identities = identities
+		if identity, ok := identities[0].(*age.X25519Identity); ok {
+			k.recipient = identity.Recipient()
+		}
+	case encryption.Passphrase != "":
+		passphrase, err := ResolveSecretReferences(k.config, encryption.Passphrase)
+		if err != nil {
+			return err
+		}
+		identity, err := age.NewScryptIdentity(passphrase)
+		if err != nil {
+			return fmt.Errorf("会話履歴の暗号化のパスフレーズが不正です: %w", err)
+		}
+		// 鍵の導出（scrypt）はファイルごとに行うと遅いため、パスフレーズでは鍵のファイルだけを復号し、
+		// 会話履歴はその X25519 の鍵で暗号化する。パスフレーズで直接暗号化した以前の会話履歴も読み込めるようにする。
+		key, err := unwrapHistoryKey(filepath.Join(GetLogDirectory(k.config), historyKeyFileName), passphrase, encryption.Enabled)
+		if err != nil {
+			return err
+		}
+		k.identities = []age.Identity{identity}
+		if key != nil {
+			k.recipient = key.Recipient()
+			k.identities = append([]age.Identity{key}, k.identities...)
+		}
+	}
+	k.loaded = true
+	return nil
+}
+
+// unwrapHistoryKey は、パスフレーズで暗号化して path に保存した X25519 の鍵を読み込みます。
+// 鍵のファイルがない場合、create が true なら鍵を作成して保存し、false なら nil を返します。
+func unwrapHistoryKey(path, passphrase string, create bool) (*age.X25519Identity, error) {
+	data, err := os.ReadFile(path)
+	if os.IsNotExist(err) {
+		if !create {
+			return nil, nil
+		}
+		return createHistoryKey(path, passphrase)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("会話履歴の鍵のファイルを読み込めません: %w", err)
+	}
+	identity, err := age.NewScryptIdentity(passphrase)
+	if err != nil {
+		return nil, fmt.Errorf("会話履歴の暗号化のパスフレーズが不正です: %w", err)
+	}
+	r, err := age.Decrypt(bytes.NewReader(data), identity)
+	if err != nil {
+		return nil, fmt.Errorf("会話履歴の鍵のファイル %s を復号できません（パスフレーズが違う可能性があります）: %w", path, err)
+	}
+	decrypted, err := io.ReadAll(r)
+	if err != nil {
+		return nil, fmt.Errorf("会話履歴の鍵のファイル %s を復号できません: %w", path, err)
+	}
+	key, err := age.ParseX25519Identity(strings.TrimSpace(string(decrypted)))
+	if err != nil {
+		return nil, fmt.Errorf("会話履歴の鍵のファイル %s の解析に失敗しました: %w", path, err)
+	}
+	return key, nil
+}
+
+// createHistoryKey は X25519 の鍵を作成し、パスフレーズで暗号化して path に保存します。
+// 別のプロセスが先に保存した場合は、その鍵を読み込みます。
+func createHistoryKey(path, passphrase string) (*age.X25519Identity, error) {
+	key, err := age.GenerateX25519Identity()
+	if err != nil {
+		return nil, fmt.Errorf("鍵の作成に失敗しました: %w", err)
+	}
+	recipient, err := age.NewScryptRecipient(passphrase)
+	if err != nil {
+		return nil, fmt.Errorf("会話履歴の暗号化のパスフレーズが不正です: %w", err)
+	}
+	var buf bytes.Buffer
+	w, err := age.Encrypt(&buf, recipient)
+	if err == nil {
+		_, err = io.WriteString(w, key.String()+"\n")
+	}
+	if err == nil {
+		err = w.Close()
+	}
+	if err != nil {
+		return nil, fmt.Errorf("会話履歴の鍵の暗号化に失敗しました: %w", err)
+	}
+
+	// 一時ファイルに書き込んでからリンクし、既に鍵のファイルがある場合は上書きしない
+	if err := EnsureDirectory(filepath.Dir(path)); err != nil {
+		return nil, fmt.Errorf("ログディレクトリの作成に失敗しました: %w", err)
+	}
+	tmp, err := os.CreateTemp(filepath.Dir(path), "."+filepath.Base(path)+".tmp-*")
+	if err != nil {
+		return nil, fmt.Errorf("会話履歴の鍵のファイルを作成できません: %w", err)
+	}
+	defer os.Remove(tmp.Name())
+	_, err = tmp.Write(buf.Bytes())
+	if closeErr := tmp.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		return nil, fmt.Errorf("会話履歴の鍵のファイルの書き込みに失敗しました: %w", err)
+	}
+	if err := os.Link(tmp.Name(), path); err != nil {
+		if os.IsExist(err) {
+			return unwrapHistoryKey(path, passphrase, false)
+		}
+		return nil, fmt.Errorf("会話履歴の鍵のファイルを作成できません: %w", err)
+	}
+	logger.Info("会話履歴の暗号化の鍵を作成しました: %s（パスフレーズで暗号化しています。会話履歴と一緒にバックアップしてください）", path)
+	return key, nil
+}
+
+// sealHistoryData は、暗号化が有効な場合に会話履歴のデータを暗号化します
+func sealHistoryData(data []byte) ([]byte, error) {
+	if !HistoryEncrypted() {
+		return data, nil
+	}
+	if err := historyEncryption.load(); err != nil {
+		return nil, err
+	}
+	if historyEncryption.recipient == nil {
+		return nil, fmt.Errorf("会話履歴を暗号化するには history.encryption の identityFile（X25519 の鍵）または passphrase を設定してください")
+	}
+
+	var buf bytes.Buffer
+	w, err := age.Encrypt(&buf, historyEncryption.recipient)
+	if err != nil {
+		return nil, fmt.Errorf("会話履歴の暗号化に失敗しました: %w", err)
+	}
+	if _, err := w.Write(data); err != nil {
+		return nil, fmt.Errorf("会話履歴の暗号化に失敗しました: %w", err)
+	}
+	if err := w.Close(); err != nil {
+		return nil, fmt.Errorf("会話履歴の暗号化に失敗しました: %w", err)
+	}
+	return buf.Bytes(), nil
+}
+
+// openHistoryData は、暗号化された会話履歴のデータを復号します。暗号化されていないデータはそのまま返します。
+func openHistoryData(data []byte) ([]byte, error) {
+	if !isEncryptedHistory(data) {
+		return data, nil
+	}
+	if err := historyEncryption.load(); err != nil {
+		return nil, err
+	}
+	if len(historyEncryption.identities) == 0 {
+		return nil, errHistoryKeyMissing
+	}
+	r, err := age.Decrypt(bytes.NewReader(data), historyEncryption.identities...)
+	if err != nil {
+		return nil, fmt.Errorf("会話履歴の復号に失敗しました: %w", err)
+	}
+	decrypted, err := io.ReadAll(r)
+	if err != nil {
+		return nil, fmt.Errorf("会話履歴の復号に失敗しました: %w", err)
+	}
+	return decrypted, nil
+}
+
+// isEncryptedHistory は、データが age で暗号化されているかを返します
+func isEncryptedHistory(data []byte) bool {
+	return bytes.HasPrefix(data, []byte(ageHeader))
+}
+
+// GenerateHistoryKey は age の X25519 の鍵を作成して path に保存し、公開鍵を返します。既にファイルがある場合は上書きしません。
+func GenerateHistoryKey(path string) (string, error) {
+	identity, err := age.GenerateX25519Identity()
+	if err != nil {
+		return "", fmt.Errorf("鍵の作成に失敗しました: %w", err)
+	}
+	file, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0600)
+	if err != nil {
+		return "", fmt.Errorf("鍵のファイルを作成できません: %w", err)
+	}
+	defer file.Close()
+	recipient := identity.Recipient().String()
+	if _, err := fmt.Fprintf(file, "# public key: %s\n%s\n", recipient, identity.String()); err != nil {
+		return "", fmt.Errorf("鍵のファイルの書き込みに失敗しました: %w", err)
+	}
+	return recipient, nil
+}
+
+// MigrateHistoryEncryption は、ログディレクトリの会話履歴と検索用のインデックスを現在の設定に合わせて暗号化または復号し直し、変換した会話履歴の数を返します。
+// encrypt が true の場合は暗号化されていない会話履歴を暗号化し、false の場合は暗号化された会話履歴を復号します。
+// ログディレクトリにある会話履歴ではない JSON ファイルは変換しません。
+func MigrateHistoryEncryption(logDir string, encrypt bool) (int, error) {
+	if encrypt != HistoryEncrypted() {
+		if encrypt {
+			return 0, fmt.Errorf("会話履歴を暗号化するには設定ファイルの history.encryption.enabled を true にしてください")
+		}
+		return 0, fmt.Errorf("会話履歴を復号するには設定ファイルの history.encryption.enabled を false にしてください")
+	}
+
+	paths, err := historyPaths(logDir)
+	if err != nil {
+		return 0, err
+	}
+	converted := 0
+	for _, path := range paths {
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return converted, err
+		}
+		if isEncryptedHistory(data) == encrypt {
+			continue
+		}
+		err = rewriteConversation(path)
+		if errors.Is(err, errNotConversation) {
+			// package.json などの会話履歴ではないファイルは書き換えると元の内容が失われるため変換しない
+			logger.Info("会話履歴ではないファイルを読み飛ばします: %v", err)
+			continue
+		}
+		if err != nil {
+			return converted, fmt.Errorf("会話履歴の変換に失敗しました (%s): %w", path, err)
+		}
+		converted++
+	}
+
+	// 検索用のインデックスにも会話の内容が含まれるため、同じように変換する
+	if _, err := os.Stat(filepath.Join(logDir, searchIndexFileName)); err == nil {
+		if err := LoadSearchIndex(logDir).Save(logDir); err != nil {
+			return converted, err
+		}
+	}
+	return converted, nil
+}
+
+// rewriteConversation は、ロックをかけて会話履歴を読み込み、メタデータの日時を変えずに現在の設定で書き込み直します
+func rewriteConversation(path string) error {
+	unlock, err := LockHistory(path)
+	if err != nil {
+		return err
+	}
+	defer unlock()
+	conversation, err := LoadConversation(path)
+	if err != nil {
+		return err
+	}
+	return writeConversation(path, conversation)
+}
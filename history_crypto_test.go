@@ -0,0 +1,153 @@
+package main
+
+import (
+	"bytes"
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"filippo.io/age"
+	openai "github.com/sashabaranov/go-openai"
+)
+
+func TestHistoryEncryption(t *testing.T) {
+	logger = NewConsoleLogger(false)
+	t.Cleanup(func() { SetupHistoryEncryption(Config{}) })
+
+	dir := t.TempDir()
+	keyFile := filepath.Join(dir, "history.key")
+	recipient, err := GenerateHistoryKey(keyFile)
+	if err != nil || !strings.HasPrefix(recipient, "age1") {
+		t.Fatalf("GenerateHistoryKey() = %q, %v", recipient, err)
+	}
+	if _, err := GenerateHistoryKey(keyFile); err == nil {
+		t.Error("既存の鍵のファイルを上書きしています")
+	}
+
+	logDir := filepath.Join(dir, "logs")
+	if err := os.Mkdir(logDir, 0700); err != nil {
+		t.Fatal(err)
+	}
+	plain := filepath.Join(logDir, "plain")
+	if err := SaveConversation(plain, Conversation{Messages: []openai.ChatCompletionMessage{{Role: openai.ChatMessageRoleUser, Content: "社外秘のコード"}}}); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := SearchHistory(logDir, HistoryQuery{Pattern: "社外秘"}, true); err != nil {
+		t.Fatal(err)
+	}
+
+	// 暗号化を有効にすると、新しく保存する会話履歴は暗号化される
+	SetupHistoryEncryption(Config{History: HistoryConfig{Encryption: HistoryEncryptionConfig{Enabled: true, IdentityFile: keyFile}}})
+	secret := filepath.Join(logDir, "secret")
+	if err := SaveConversation(secret, Conversation{Messages: []openai.ChatCompletionMessage{{Role: openai.ChatMessageRoleUser, Content: "社外秘の設計"}}}); err != nil {
+		t.Fatalf("SaveConversation() エラー: %v", err)
+	}
+	data, err := os.ReadFile(secret + ".json")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !isEncryptedHistory(data) || strings.Contains(string(data), "社外秘") {
+		t.Fatalf("会話履歴が暗号化されていません:\n%s", data)
+	}
+	conversation, err := LoadConversation(secret)
+	if err != nil || len(conversation.Messages) != 1 || conversation.Messages[0].Content != "社外秘の設計" {
+		t.Fatalf("暗号化された会話履歴を読み込めません: %+v, %v", conversation, err)
+	}
+
+	// 会話履歴ではない JSON ファイルは変換しない
+	foreign := map[string]string{
+		"package.json": `{"name": "app", "version": "1.0.0"}`,
+		"broken.json":  `{"name":`,
+	}
+	for name, content := range foreign {
+		if err := os.WriteFile(filepath.Join(logDir, name), []byte(content), 0600); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// 既存の会話履歴と検索用のインデックスを暗号化する
+	converted, err := MigrateHistoryEncryption(logDir, true)
+	if err != nil || converted != 1 {
+		t.Fatalf("MigrateHistoryEncryption() = %d, %v", converted, err)
+	}
+	for _, name := range []string{"plain.json", searchIndexFileName} {
+		data, err := os.ReadFile(filepath.Join(logDir, name))
+		if err != nil || !isEncryptedHistory(data) {
+			t.Errorf("%s が暗号化されていません: %v", name, err)
+		}
+	}
+	if results, err := SearchHistory(logDir, HistoryQuery{Pattern: "社外秘"}, true); err != nil || len(results) != 2 {
+		t.Errorf("暗号化された会話履歴を検索できません: %+v, %v", results, err)
+	}
+
+	// 鍵がない場合は読み込めない
+	SetupHistoryEncryption(Config{})
+	if _, err := LoadConversation(secret); !errors.Is(err, errHistoryKeyMissing) {
+		t.Errorf("鍵がない場合のエラーが正しくありません: %v", err)
+	}
+	if _, err := MigrateHistoryEncryption(logDir, true); err == nil {
+		t.Error("暗号化が無効な場合に暗号化できています")
+	}
+
+	// 鍵を設定したまま暗号化を無効にすると、復号できる
+	SetupHistoryEncryption(Config{History: HistoryConfig{Encryption: HistoryEncryptionConfig{IdentityFile: keyFile}}})
+	converted, err = MigrateHistoryEncryption(logDir, false)
+	if err != nil || converted != 2 {
+		t.Fatalf("MigrateHistoryEncryption() = %d, %v", converted, err)
+	}
+	if data, _ := os.ReadFile(secret + ".json"); isEncryptedHistory(data) {
+		t.Error("会話履歴が復号されていません")
+	}
+	for name, content := range foreign {
+		if data, err := os.ReadFile(filepath.Join(logDir, name)); err != nil || string(data) != content {
+			t.Errorf("会話履歴ではない %s が変換されました: %q, %v", name, data, err)
+		}
+	}
+}
+
+func TestHistoryEncryptionPassphrase(t *testing.T) {
+	t.Cleanup(func() { SetupHistoryEncryption(Config{}) })
+	t.Setenv("GPT_CLI_TEST_HISTORY_PASSPHRASE", "correct horse battery staple")
+	logDir := t.TempDir()
+	config := Config{
+		LogDir:  logDir,
+		Secrets: map[string]SecretConfig{"history": {Env: "GPT_CLI_TEST_HISTORY_PASSPHRASE"}},
+		History: HistoryConfig{Encryption: HistoryEncryptionConfig{Enabled: true, Passphrase: "${secret:history}"}},
+	}
+	SetupHistoryEncryption(config)
+
+	sealed, err := sealHistoryData([]byte(`{"messages":[]}`))
+	if err != nil || !isEncryptedHistory(sealed) {
+		t.Fatalf("sealHistoryData() = %v", err)
+	}
+	// 会話履歴はパスフレーズで復号した X25519 の鍵で暗号化する
+	if strings.Contains(string(sealed), "scrypt") || !strings.Contains(string(sealed), "X25519") {
+		t.Errorf("会話履歴がパスフレーズで直接暗号化されています:\n%s", sealed)
+	}
+	if _, err := os.Stat(filepath.Join(logDir, historyKeyFileName)); err != nil {
+		t.Fatalf("鍵のファイルが作成されていません: %v", err)
+	}
+
+	// 別のプロセスでも保存した鍵で復号でき、パスフレーズで直接暗号化した以前の会話履歴も読み込める
+	SetupHistoryEncryption(config)
+	recipient, _ := age.NewScryptRecipient("correct horse battery staple")
+	var legacy bytes.Buffer
+	w, _ := age.Encrypt(&legacy, recipient)
+	w.Write([]byte(`{"messages":[{"role":"user"}]}`))
+	w.Close()
+	for data, want := range map[string]string{string(sealed): `{"messages":[]}`, legacy.String(): `{"messages":[{"role":"user"}]}`} {
+		opened, err := openHistoryData([]byte(data))
+		if err != nil || string(opened) != want {
+			t.Errorf("openHistoryData() = %q, %v, 期待値 %q", opened, err, want)
+		}
+	}
+
+	// パスフレーズが違う場合は鍵のファイルを復号できない
+	config.History.Encryption.Passphrase = "wrong"
+	SetupHistoryEncryption(config)
+	if _, err := openHistoryData(sealed); err == nil {
+		t.Error("違うパスフレーズで復号できています")
+	}
+}
@@ -0,0 +1,441 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"html"
+	"io"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"time"
+
+	openai "github.com/sashabaranov/go-openai"
+	"golang.org/x/text/cases"
+	"golang.org/x/text/language"
+	"gopkg.in/yaml.v3"
+)
+
+// エクスポートの形式
+const (
+	ExportFormatMarkdown = "markdown"
+	ExportFormatHTML     = "html"
+	ExportFormatJSONL    = "jsonl"
+)
+
+// ResolveExportFormat は、-format の値（md, markdown, html, jsonl）を正規化します。
+// 指定されていない場合は出力先の拡張子から推測し、推測できない場合は markdown を返します。
+func ResolveExportFormat(format, output string) (string, error) {
+	if format == "" {
+		format = strings.TrimPrefix(strings.ToLower(filepath.Ext(output)), ".")
+	}
+	switch format {
+	case "", "md", "markdown":
+		return ExportFormatMarkdown, nil
+	case "html", "htm":
+		return ExportFormatHTML, nil
+	case "jsonl":
+		return ExportFormatJSONL, nil
+	}
+	return "", fmt.Errorf("不正なエクスポートの形式が指定されました: %s (markdown, html, jsonl)", format)
+}
+
+// embeddedImagePattern は、CreateMessages が添付画像を埋め込んだメッセージに一致する正規表現です
+var embeddedImagePattern = regexp.MustCompile(`^画像ファイル: (.*)\nデータ: (data:[^;\s]+;base64,\S+)$`)
+
+// messagePart は、エクスポートのためにメッセージを分割した本文または画像です
+type messagePart struct {
+	Text     string
+	ImageURL string
+}
+
+// messageParts はメッセージの本文と画像を順番に返します。
+// MultiContent の画像と、CreateMessages が本文に埋め込んだ画像を画像として扱います。
+func messageParts(message openai.ChatCompletionMessage) []messagePart {
+	if len(message.MultiContent) > 0 {
+		var parts []messagePart
+		for _, part := range message.MultiContent {
+			switch {
+			case part.Type == openai.ChatMessagePartTypeImageURL && part.ImageURL != nil:
+				parts = append(parts, messagePart{Text: "image", ImageURL: part.ImageURL.URL})
+			case part.Text != "":
+				parts = append(parts, messagePart{Text: part.Text})
+			}
+		}
+		return parts
+	}
+	if m := embeddedImagePattern.FindStringSubmatch(message.Content); m != nil {
+		return []messagePart{{Text: filepath.Base(m[1]), ImageURL: m[2]}}
+	}
+	if message.Content == "" {
+		return nil
+	}
+	return []messagePart{{Text: message.Content}}
+}
+
+// messageHeading は、メッセージの見出し（ロールと、name や tool_call_id がある場合はその値）を返します
+func messageHeading(message openai.ChatCompletionMessage) string {
+	heading := cases.Title(language.Und).String(message.Role)
+	switch {
+	case message.Name != "":
+		heading += " (" + message.Name + ")"
+	case message.ToolCallID != "":
+		heading += " (" + message.ToolCallID + ")"
+	}
+	return heading
+}
+
+// toolCallsOf は、メッセージのツール呼び出し（古い形式の function_call を含む）を「名前」と「引数」の組で返します
+func toolCallsOf(message openai.ChatCompletionMessage) [][2]string {
+	var calls [][2]string
+	for _, call := range message.ToolCalls {
+		name := call.Function.Name
+		if call.ID != "" {
+			name += " (" + call.ID + ")"
+		}
+		calls = append(calls, [2]string{name, prettyJSON(call.Function.Arguments)})
+	}
+	if message.FunctionCall != nil {
+		calls = append(calls, [2]string{message.FunctionCall.Name, prettyJSON(message.FunctionCall.Arguments)})
+	}
+	return calls
+}
+
+// prettyJSON は、JSON文字列を字下げして返します（JSONとして解析できない場合はそのまま返します）
+func prettyJSON(s string) string {
+	var buf bytes.Buffer
+	if err := json.Indent(&buf, []byte(s), "", "  "); err != nil {
+		return s
+	}
+	return buf.String()
+}
+
+// exportFrontMatter は Markdown のフロントマターに書き込むメタデータです
+type exportFrontMatter struct {
+	Title   string   `yaml:"title,omitempty"`
+	Created string   `yaml:"created,omitempty"`
+	Updated string   `yaml:"updated,omitempty"`
+	Model   string   `yaml:"model,omitempty"`
+	Prompt  string   `yaml:"prompt,omitempty"`
+	Tags    []string `yaml:"tags,omitempty"`
+	Tokens  int      `yaml:"tokens,omitempty"`
+}
+
+// formatExportTime は日時を RFC 3339 の形式にします（ゼロ値の場合は空）
+func formatExportTime(t time.Time) string {
+	if t.IsZero() {
+		return ""
+	}
+	return t.Format(time.RFC3339)
+}
+
+// ExportMarkdown は、会話履歴をフロントマター付きの Markdown として書き込みます
+func ExportMarkdown(w io.Writer, conversation Conversation) error {
+	meta := conversation.Meta
+	frontMatter, err := yaml.Marshal(exportFrontMatter{
+		Title:   conversation.DisplayTitle(),
+		Created: formatExportTime(meta.CreatedAt),
+		Updated: formatExportTime(meta.UpdatedAt),
+		Model:   meta.Model,
+		Prompt:  meta.Prompt,
+		Tags:    meta.Tags,
+		Tokens:  meta.Usage.TotalTokens,
+	})
+	if err != nil {
+		return err
+	}
+
+	var sb strings.Builder
+	sb.WriteString("---\n")
+	sb.Write(frontMatter)
+	sb.WriteString("---\n")
+	for _, message := range conversation.Messages {
+		fmt.Fprintf(&sb, "\n## %s\n\n", messageHeading(message))
+		for _, part := range messageParts(message) {
+			if part.ImageURL != "" {
+				fmt.Fprintf(&sb, "![%s](%s)\n\n", part.Text, part.ImageURL)
+				continue
+			}
+			sb.WriteString(strings.TrimRight(part.Text, "\n") + "\n\n")
+		}
+		for _, call := range toolCallsOf(message) {
+			fence := codeFence(call[1])
+			fmt.Fprintf(&sb, "**ツール呼び出し**: `%s`\n\n%sjson\n%s\n%s\n\n", call[0], fence, call[1], fence)
+		}
+	}
+	_, err = io.WriteString(w, strings.TrimRight(sb.String(), "\n")+"\n")
+	return err
+}
+
+// exportHTMLStyle はHTMLに埋め込むスタイルシートです
+const exportHTMLStyle = `body { max-width: 860px; margin: 2em auto; padding: 0 1em; font-family: -apple-system, "Segoe UI", "Hiragino Sans", "Noto Sans JP", sans-serif; line-height: 1.7; color: #1f2328; }
+header { border-bottom: 1px solid #d0d7de; margin-bottom: 1.5em; }
+.meta { color: #656d76; font-size: 0.9em; }
+.message { border: 1px solid #d0d7de; border-radius: 8px; padding: 0.5em 1.2em; margin: 1em 0; }
+.message h2 { font-size: 0.95em; color: #656d76; margin: 0.5em 0; }
+.message.user { background: #f6f8fa; }
+.message.system, .message.tool { background: #fff8c5; }
+pre { background: #f6f8fa; border: 1px solid #d0d7de; border-radius: 6px; padding: 0.8em; overflow-x: auto; }
+code { font-family: ui-monospace, SFMono-Regular, Menlo, monospace; font-size: 0.9em; }
+img { max-width: 100%; }
+table { border-collapse: collapse; }
+th, td { border: 1px solid #d0d7de; padding: 0.3em 0.8em; }
+blockquote { margin: 0; padding-left: 1em; border-left: 4px solid #d0d7de; color: #656d76; }
+.tok-comment { color: #6e7781; font-style: italic; }
+.tok-string { color: #0a3069; }
+.tok-number { color: #0550ae; }
+.tok-keyword { color: #cf222e; font-weight: bold; }
+`
+
+// ExportHTML は、会話履歴をスタイルとコードの構文ハイライトを含む単体のHTMLとして書き込みます
+func ExportHTML(w io.Writer, conversation Conversation) error {
+	title := html.EscapeString(conversation.DisplayTitle())
+	meta := conversation.Meta
+
+	var info []string
+	if !meta.CreatedAt.IsZero() {
+		info = append(info, meta.CreatedAt.Local().Format("2006-01-02 15:04"))
+	}
+	if meta.Model != "" {
+		info = append(info, html.EscapeString(meta.Model))
+	}
+	if len(meta.Tags) > 0 {
+		info = append(info, html.EscapeString(strings.Join(meta.Tags, ", ")))
+	}
+
+	var sb strings.Builder
+	fmt.Fprintf(&sb, "<!DOCTYPE html>\n<html lang=\"ja\">\n<head>\n<meta charset=\"utf-8\">\n<title>%s</title>\n<style>\n%s</style>\n</head>\n<body>\n", title, exportHTMLStyle)
+	fmt.Fprintf(&sb, "<header>\n<h1>%s</h1>\n<p class=\"meta\">%s</p>\n</header>\n", title, strings.Join(info, " · "))
+	for _, message := range conversation.Messages {
+		fmt.Fprintf(&sb, "<section class=\"message %s\">\n<h2>%s</h2>\n", html.EscapeString(message.Role), html.EscapeString(messageHeading(message)))
+		for _, part := range messageParts(message) {
+			if part.ImageURL != "" {
+				fmt.Fprintf(&sb, "<p><img src=\"%s\" alt=\"%s\"></p>\n", html.EscapeString(part.ImageURL), html.EscapeString(part.Text))
+				continue
+			}
+			sb.WriteString(markdownToHTML(part.Text))
+		}
+		for _, call := range toolCallsOf(message) {
+			fmt.Fprintf(&sb, "<p><strong>ツール呼び出し</strong>: <code>%s</code></p>\n%s", html.EscapeString(call[0]), codeBlockHTML(strings.Split(call[1], "\n"), "json"))
+		}
+		sb.WriteString("</section>\n")
+	}
+	sb.WriteString("</body>\n</html>\n")
+	_, err := io.WriteString(w, sb.String())
+	return err
+}
+
+var (
+	htmlInlineCode = regexp.MustCompile("`([^`]+)`")
+	htmlBold       = regexp.MustCompile(`\*\*([^*]+)\*\*`)
+	htmlItalic     = regexp.MustCompile(`(^|[^*])\*([^*\s][^*]*)\*`)
+	htmlLink       = regexp.MustCompile(`\[([^\]]+)\]\((https?://[^)\s]+)\)`)
+	htmlOrderedRow = regexp.MustCompile(`^\d+[.)]\s+`)
+)
+
+// markdownToHTML は、Markdown の見出し、リスト、引用、表、コードブロック、段落をHTMLに変換します
+func markdownToHTML(text string) string {
+	var sb strings.Builder
+	lines := strings.Split(strings.ReplaceAll(text, "\r\n", "\n"), "\n")
+	var paragraph []string
+	listTag := ""
+
+	flushParagraph := func() {
+		if len(paragraph) > 0 {
+			sb.WriteString("<p>" + strings.Join(paragraph, "<br>\n") + "</p>\n")
+			paragraph = nil
+		}
+	}
+	closeList := func() {
+		if listTag != "" {
+			sb.WriteString("</" + listTag + ">\n")
+			listTag = ""
+		}
+	}
+	openList := func(tag string) {
+		if listTag != tag {
+			closeList()
+			sb.WriteString("<" + tag + ">\n")
+			listTag = tag
+		}
+	}
+
+	for i := 0; i < len(lines); i++ {
+		line := lines[i]
+		trimmed := strings.TrimSpace(line)
+
+		if m := fenceOpenPattern.FindStringSubmatch(line); m != nil {
+			flushParagraph()
+			closeList()
+			fence := m[1]
+			lang, _, _ := strings.Cut(strings.TrimSpace(m[2]), " ")
+			var code []string
+			for i++; i < len(lines); i++ {
+				t := strings.TrimSpace(lines[i])
+				if strings.HasPrefix(t, fence) && strings.Trim(t, fence[:1]) == "" {
+					break
+				}
+				code = append(code, lines[i])
+			}
+			sb.WriteString(codeBlockHTML(code, lang))
+			continue
+		}
+
+		switch {
+		case trimmed == "":
+			flushParagraph()
+			closeList()
+		case headingPattern.MatchString(trimmed):
+			flushParagraph()
+			closeList()
+			level := len(trimmed) - len(strings.TrimLeft(trimmed, "#"))
+			if level > 6 {
+				level = 6
+			}
+			fmt.Fprintf(&sb, "<h%d>%s</h%d>\n", level+2, inlineHTML(strings.TrimSpace(trimmed[level:])), level+2)
+		case trimmed == "---" || trimmed == "***":
+			flushParagraph()
+			closeList()
+			sb.WriteString("<hr>\n")
+		case strings.HasPrefix(trimmed, ">"):
+			flushParagraph()
+			closeList()
+			sb.WriteString("<blockquote>" + inlineHTML(strings.TrimSpace(strings.TrimPrefix(trimmed, ">"))) + "</blockquote>\n")
+		case strings.HasPrefix(trimmed, "|"):
+			flushParagraph()
+			closeList()
+			var rows [][]string
+			for ; i < len(lines) && strings.HasPrefix(strings.TrimSpace(lines[i]), "|"); i++ {
+				row := splitTableRow(strings.TrimSpace(lines[i]))
+				if strings.Trim(strings.Join(row, ""), "-: ") == "" {
+					continue // 区切りの行
+				}
+				rows = append(rows, row)
+			}
+			i--
+			sb.WriteString(tableHTML(rows))
+		case strings.HasPrefix(trimmed, "- ") || strings.HasPrefix(trimmed, "* ") || strings.HasPrefix(trimmed, "+ "):
+			flushParagraph()
+			openList("ul")
+			sb.WriteString("<li>" + inlineHTML(trimmed[2:]) + "</li>\n")
+		case htmlOrderedRow.MatchString(trimmed):
+			flushParagraph()
+			openList("ol")
+			sb.WriteString("<li>" + inlineHTML(htmlOrderedRow.ReplaceAllString(trimmed, "")) + "</li>\n")
+		default:
+			closeList()
+			paragraph = append(paragraph, inlineHTML(trimmed))
+		}
+	}
+	flushParagraph()
+	closeList()
+	return sb.String()
+}
+
+// inlineHTML は、行内のコード、太字、斜体、リンクをHTMLに変換します
+func inlineHTML(text string) string {
+	// コードの中身は他の変換の対象にしないように、先に置き換えておく
+	var codes []string
+	text = htmlInlineCode.ReplaceAllStringFunc(text, func(s string) string {
+		codes = append(codes, "<code>"+html.EscapeString(s[1:len(s)-1])+"</code>")
+		return fmt.Sprintf("\x00%d\x00", len(codes)-1)
+	})
+	text = html.EscapeString(text)
+	text = htmlLink.ReplaceAllString(text, `<a href="$2">$1</a>`)
+	text = htmlBold.ReplaceAllString(text, "<strong>$1</strong>")
+	text = htmlItalic.ReplaceAllString(text, "$1<em>$2</em>")
+	for i, code := range codes {
+		text = strings.Replace(text, fmt.Sprintf("\x00%d\x00", i), code, 1)
+	}
+	return text
+}
+
+// tableHTML は表の行をHTMLの表に変換します（最初の行を見出しとして扱います）
+func tableHTML(rows [][]string) string {
+	var sb strings.Builder
+	sb.WriteString("<table>\n")
+	for i, row := range rows {
+		tag := "td"
+		if i == 0 {
+			tag = "th"
+		}
+		sb.WriteString("<tr>")
+		for _, cell := range row {
+			fmt.Fprintf(&sb, "<%s>%s</%s>", tag, inlineHTML(cell), tag)
+		}
+		sb.WriteString("</tr>\n")
+	}
+	sb.WriteString("</table>\n")
+	return sb.String()
+}
+
+// codeBlockHTML は、コードブロックを構文ハイライトのための span を付けたHTMLに変換します
+func codeBlockHTML(code []string, lang string) string {
+	classes := map[int]string{
+		codeTokenComment: "tok-comment",
+		codeTokenString:  "tok-string",
+		codeTokenNumber:  "tok-number",
+		codeTokenKeyword: "tok-keyword",
+	}
+
+	var sb strings.Builder
+	sb.WriteString("<pre><code")
+	if lang != "" {
+		fmt.Fprintf(&sb, " class=\"language-%s\"", html.EscapeString(lang))
+	}
+	sb.WriteString(">")
+	for i, line := range code {
+		if i > 0 {
+			sb.WriteString("\n")
+		}
+		for _, token := range tokenizeCode(line, lang) {
+			if class, ok := classes[token.Kind]; ok {
+				fmt.Fprintf(&sb, "<span class=\"%s\">%s</span>", class, html.EscapeString(token.Text))
+			} else {
+				sb.WriteString(html.EscapeString(token.Text))
+			}
+		}
+	}
+	sb.WriteString("</code></pre>\n")
+	return sb.String()
+}
+
+// fineTuningMessage は、メッセージを fine-tuning の JSONL で使える形にします。
+// CreateMessages が本文に埋め込んだ画像は image_url のパートに変換します。
+func fineTuningMessage(message openai.ChatCompletionMessage) openai.ChatCompletionMessage {
+	if m := embeddedImagePattern.FindStringSubmatch(message.Content); m != nil && len(message.MultiContent) == 0 {
+		message.Content = ""
+		message.MultiContent = []openai.ChatMessagePart{{
+			Type:     openai.ChatMessagePartTypeImageURL,
+			ImageURL: &openai.ChatMessageImageURL{URL: m[2]},
+		}}
+	}
+	return message
+}
+
+// ExportJSONL は、会話履歴を OpenAI の fine-tuning 用の JSONL（1行に1つの会話）として書き込み、書き込んだ会話の数を返します。
+// アシスタントの応答を含まない会話は学習データとして使えないため書き込みません。
+func ExportJSONL(w io.Writer, conversations []Conversation) (int, error) {
+	encoder := json.NewEncoder(w)
+	encoder.SetEscapeHTML(false)
+	written := 0
+	for _, conversation := range conversations {
+		var messages []openai.ChatCompletionMessage
+		hasAssistant := false
+		for _, message := range conversation.Messages {
+			messages = append(messages, fineTuningMessage(message))
+			hasAssistant = hasAssistant || message.Role == openai.ChatMessageRoleAssistant
+		}
+		if !hasAssistant {
+			continue
+		}
+		if err := encoder.Encode(struct {
+			Messages []openai.ChatCompletionMessage `json:"messages"`
+		}{messages}); err != nil {
+			return written, err
+		}
+		written++
+	}
+	return written, nil
+}
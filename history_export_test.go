@@ -0,0 +1,183 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	openai "github.com/sashabaranov/go-openai"
+)
+
+func TestResolveExportFormat(t *testing.T) {
+	tests := []struct {
+		format, output, want string
+	}{
+		{"", "", ExportFormatMarkdown},
+		{"md", "", ExportFormatMarkdown},
+		{"", "chat.html", ExportFormatHTML},
+		{"", "train.JSONL", ExportFormatJSONL},
+		{"jsonl", "out.md", ExportFormatJSONL},
+	}
+	for _, tt := range tests {
+		got, err := ResolveExportFormat(tt.format, tt.output)
+		if err != nil || got != tt.want {
+			t.Errorf("ResolveExportFormat(%q, %q) = %q, %v, want %q", tt.format, tt.output, got, err, tt.want)
+		}
+	}
+	if _, err := ResolveExportFormat("pdf", ""); err == nil {
+		t.Error("不正な形式でエラーになりません")
+	}
+}
+
+func testExportConversation() Conversation {
+	return Conversation{
+		Meta: HistoryMeta{
+			Title:     "Go のエラー処理",
+			CreatedAt: time.Date(2024, 5, 1, 9, 0, 0, 0, time.UTC),
+			UpdatedAt: time.Date(2024, 5, 1, 9, 30, 0, 0, time.UTC),
+			Model:     "gpt-4o",
+			Tags:      []string{"go"},
+			Usage:     HistoryUsage{TotalTokens: 42},
+		},
+		Messages: []openai.ChatCompletionMessage{
+			{Role: openai.ChatMessageRoleUser, Content: "画像ファイル: /tmp/screen.png\nデータ: data:image/png;base64,AAAA"},
+			{Role: openai.ChatMessageRoleUser, Content: "<b> を含む **質問**"},
+			{Role: openai.ChatMessageRoleAssistant, Content: "```go\nreturn nil // 成功\n```", ToolCalls: []openai.ToolCall{{
+				ID:       "call_1",
+				Type:     openai.ToolTypeFunction,
+				Function: openai.FunctionCall{Name: "read_file", Arguments: `{"path":"main.go"}`},
+			}}},
+			{Role: openai.ChatMessageRoleTool, ToolCallID: "call_1", Content: "package main"},
+		},
+	}
+}
+
+func TestExportMarkdown(t *testing.T) {
+	var buf bytes.Buffer
+	if err := ExportMarkdown(&buf, testExportConversation()); err != nil {
+		t.Fatalf("ExportMarkdown() エラー: %v", err)
+	}
+	out := buf.String()
+	for _, want := range []string{
+		"---\ntitle: Go のエラー処理\n",
+		"model: gpt-4o\n",
+		"tokens: 42\n",
+		"## User\n\n![screen.png](data:image/png;base64,AAAA)",
+		"**ツール呼び出し**: `read_file (call_1)`\n\n```json\n{\n  \"path\": \"main.go\"\n}\n```",
+		"## Tool (call_1)\n\npackage main\n",
+	} {
+		if !strings.Contains(out, want) {
+			t.Errorf("出力に %q が含まれません:\n%s", want, out)
+		}
+	}
+}
+
+func TestExportHTML(t *testing.T) {
+	var buf bytes.Buffer
+	if err := ExportHTML(&buf, testExportConversation()); err != nil {
+		t.Fatalf("ExportHTML() エラー: %v", err)
+	}
+	out := buf.String()
+	for _, want := range []string{
+		"<title>Go のエラー処理</title>",
+		`<img src="data:image/png;base64,AAAA" alt="screen.png">`,
+		"<p>&lt;b&gt; を含む <strong>質問</strong></p>",
+		`<pre><code class="language-go"><span class="tok-keyword">return</span> <span class="tok-keyword">nil</span> <span class="tok-comment">// 成功</span></code></pre>`,
+		"<code>read_file (call_1)</code>",
+	} {
+		if !strings.Contains(out, want) {
+			t.Errorf("出力に %q が含まれません:\n%s", want, out)
+		}
+	}
+	if strings.Contains(out, "<b>") {
+		t.Error("本文のHTMLがエスケープされていません")
+	}
+}
+
+func TestExportJSONL(t *testing.T) {
+	unanswered := Conversation{Messages: []openai.ChatCompletionMessage{{Role: openai.ChatMessageRoleUser, Content: "質問だけ"}}}
+
+	var buf bytes.Buffer
+	written, err := ExportJSONL(&buf, []Conversation{testExportConversation(), unanswered})
+	if err != nil {
+		t.Fatalf("ExportJSONL() エラー: %v", err)
+	}
+	lines := strings.Split(strings.TrimSpace(buf.String()), "\n")
+	if written != 1 || len(lines) != 1 {
+		t.Fatalf("アシスタントの応答を含む会話だけを書き込む必要があります: written=%d\n%s", written, buf.String())
+	}
+
+	var record struct {
+		Messages []openai.ChatCompletionMessage `json:"messages"`
+	}
+	if err := json.Unmarshal([]byte(lines[0]), &record); err != nil {
+		t.Fatalf("JSONL の行を解析できません: %v", err)
+	}
+	image := record.Messages[0]
+	if len(image.MultiContent) != 1 || image.MultiContent[0].ImageURL == nil || image.MultiContent[0].ImageURL.URL != "data:image/png;base64,AAAA" {
+		t.Errorf("埋め込まれた画像が image_url に変換されていません: %+v", image)
+	}
+	if record.Messages[1].Content != "<b> を含む **質問**" || len(record.Messages[2].ToolCalls) != 1 {
+		t.Errorf("メッセージがそのまま書き込まれていません: %s", lines[0])
+	}
+}
+
+const testChatGPTExport = `[
+  {
+    "title": "Rust について",
+    "create_time": 1714554000.5,
+    "update_time": 1714557600,
+    "current_node": "c",
+    "mapping": {
+      "root": {"message": null, "parent": null, "children": ["s"]},
+      "s": {"message": {"author": {"role": "system"}, "content": {"content_type": "text", "parts": [""]}, "metadata": {"is_visually_hidden_from_conversation": true}}, "parent": "root", "children": ["a"]},
+      "a": {"message": {"author": {"role": "user"}, "content": {"content_type": "text", "parts": ["所有権とは？"]}, "metadata": {}}, "parent": "s", "children": ["b", "old"]},
+      "old": {"message": {"author": {"role": "assistant"}, "content": {"content_type": "text", "parts": ["古い回答"]}, "metadata": {}}, "parent": "a", "children": []},
+      "b": {"message": {"author": {"role": "tool"}, "content": {"content_type": "text", "parts": ["検索結果"]}, "metadata": {}}, "parent": "a", "children": ["c"]},
+      "c": {"message": {"author": {"role": "assistant"}, "content": {"content_type": "text", "parts": ["値の持ち主です。"]}, "metadata": {"model_slug": "gpt-4o"}}, "parent": "b", "children": []}
+    }
+  },
+  {"title": "空の会話", "create_time": 1714554000, "mapping": {}}
+]`
+
+func TestImportChatGPTConversations(t *testing.T) {
+	dir := t.TempDir()
+	source := filepath.Join(dir, "conversations.json")
+	if err := os.WriteFile(source, []byte(testChatGPTExport), 0600); err != nil {
+		t.Fatal(err)
+	}
+	logDir := filepath.Join(dir, "logs")
+	if err := os.Mkdir(logDir, 0700); err != nil {
+		t.Fatal(err)
+	}
+
+	imported, skipped, err := ImportChatGPTConversations(source, logDir, []string{"chatgpt"})
+	if err != nil {
+		t.Fatalf("ImportChatGPTConversations() エラー: %v", err)
+	}
+	if imported != 1 || skipped != 1 {
+		t.Errorf("imported=%d skipped=%d, want 1, 1", imported, skipped)
+	}
+
+	entries, err := ListConversations(logDir)
+	if err != nil || len(entries) != 1 {
+		t.Fatalf("取り込んだ会話履歴が見つかりません: %v, %+v", err, entries)
+	}
+	conversation := entries[0].Conversation
+	if !strings.HasPrefix(entries[0].Name, "chatgpt_") || conversation.Meta.Title != "Rust について" || !conversation.HasTag("chatgpt") || conversation.Meta.Model != "gpt-4o" {
+		t.Errorf("メタデータが正しくありません: %s %+v", entries[0].Name, conversation.Meta)
+	}
+	if len(conversation.Messages) != 2 || conversation.Messages[0].Content != "所有権とは？" || conversation.Messages[1].Content != "値の持ち主です。" {
+		t.Errorf("表示されている分岐のメッセージだけを取り込む必要があります: %+v", conversation.Messages)
+	}
+
+	// 同じ会話は上書きせずに読み飛ばす
+	imported, skipped, err = ImportChatGPTConversations(source, logDir, nil)
+	if err != nil || imported != 0 || skipped != 2 {
+		t.Errorf("2回目の取り込み: imported=%d skipped=%d err=%v", imported, skipped, err)
+	}
+}
@@ -0,0 +1,186 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"math"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	openai "github.com/sashabaranov/go-openai"
+)
+
+// chatGPTConversation は、ChatGPT のデータエクスポートに含まれる conversations.json の1つの会話です。
+// メッセージは mapping に木構造で保存され、current_node から親をたどると表示されている会話になります。
+type chatGPTConversation struct {
+	Title       string                 `json:"title"`
+	CreateTime  float64                `json:"create_time"`
+	UpdateTime  float64                `json:"update_time"`
+	Mapping     map[string]chatGPTNode `json:"mapping"`
+	CurrentNode string                 `json:"current_node"`
+}
+
+// chatGPTNode は会話の木構造の1つのノードです
+type chatGPTNode struct {
+	Message  *chatGPTMessage `json:"message"`
+	Parent   string          `json:"parent"`
+	Children []string        `json:"children"`
+}
+
+// chatGPTMessage は ChatGPT のエクスポートの1つのメッセージです
+type chatGPTMessage struct {
+	Author struct {
+		Role string `json:"role"`
+	} `json:"author"`
+	Content struct {
+		ContentType string            `json:"content_type"`
+		Parts       []json.RawMessage `json:"parts"`
+		Text        string            `json:"text"`
+	} `json:"content"`
+	Metadata struct {
+		ModelSlug      string `json:"model_slug"`
+		VisuallyHidden bool   `json:"is_visually_hidden_from_conversation"`
+	} `json:"metadata"`
+}
+
+// text はメッセージの本文を返します。画像などテキスト以外のパートは [画像: ...] のような文字列にします。
+func (m chatGPTMessage) text() string {
+	if m.Content.ContentType == "code" {
+		return "```\n" + strings.TrimRight(m.Content.Text, "\n") + "\n```"
+	}
+	var texts []string
+	if m.Content.Text != "" {
+		texts = append(texts, m.Content.Text)
+	}
+	for _, raw := range m.Content.Parts {
+		var s string
+		if err := json.Unmarshal(raw, &s); err == nil {
+			if s != "" {
+				texts = append(texts, s)
+			}
+			continue
+		}
+		var part struct {
+			ContentType  string `json:"content_type"`
+			AssetPointer string `json:"asset_pointer"`
+		}
+		if err := json.Unmarshal(raw, &part); err == nil && part.ContentType == "image_asset_pointer" {
+			texts = append(texts, fmt.Sprintf("[画像: %s]", part.AssetPointer))
+		}
+	}
+	return strings.Join(texts, "\n\n")
+}
+
+// chatGPTTime は ChatGPT のエクスポートの日時（UNIX時間の秒数）を time.Time にします
+func chatGPTTime(seconds float64) time.Time {
+	if seconds <= 0 {
+		return time.Time{}
+	}
+	sec, frac := math.Modf(seconds)
+	return time.Unix(int64(sec), int64(frac*1e9))
+}
+
+// ConvertChatGPTConversation は、ChatGPT の会話を表示されている分岐に沿って会話履歴に変換します。
+// ユーザー、アシスタント、システム以外のメッセージ（ブラウジングなどのツールの結果）と、空や非表示のメッセージは含めません。
+func ConvertChatGPTConversation(source chatGPTConversation) Conversation {
+	conversation := Conversation{Meta: HistoryMeta{
+		Title:     source.Title,
+		CreatedAt: chatGPTTime(source.CreateTime),
+		UpdatedAt: chatGPTTime(source.UpdateTime),
+	}}
+
+	// current_node から親をたどり、ルートからの順に並べる
+	node := source.CurrentNode
+	if node == "" {
+		node = lastChatGPTLeaf(source.Mapping)
+	}
+	var path []string
+	visited := make(map[string]bool)
+	for node != "" && !visited[node] {
+		visited[node] = true
+		path = append([]string{node}, path...)
+		node = source.Mapping[node].Parent
+	}
+
+	for _, id := range path {
+		message := source.Mapping[id].Message
+		if message == nil || message.Metadata.VisuallyHidden {
+			continue
+		}
+		role := message.Author.Role
+		if role != openai.ChatMessageRoleUser && role != openai.ChatMessageRoleAssistant && role != openai.ChatMessageRoleSystem {
+			continue
+		}
+		text := strings.TrimSpace(message.text())
+		if text == "" {
+			continue
+		}
+		conversation.Messages = append(conversation.Messages, openai.ChatCompletionMessage{Role: role, Content: text})
+		if message.Metadata.ModelSlug != "" {
+			conversation.Meta.Model = message.Metadata.ModelSlug
+		}
+	}
+	return conversation
+}
+
+// lastChatGPTLeaf は、current_node がない場合に、ルートから最後の子をたどった末端のノードを返します
+func lastChatGPTLeaf(mapping map[string]chatGPTNode) string {
+	for id, node := range mapping {
+		if node.Parent != "" {
+			continue
+		}
+		for len(mapping[id].Children) > 0 {
+			children := mapping[id].Children
+			id = children[len(children)-1]
+		}
+		return id
+	}
+	return ""
+}
+
+// ImportChatGPTConversations は、ChatGPT のデータエクスポートの conversations.json を読み込み、
+// 会話ごとに logDir に「chatgpt_作成日時_タイトル.json」として保存します。tags は各会話に付けるタグです。
+// 同じ名前の会話履歴が既にある場合は上書きせずに読み飛ばします。取り込んだ数と読み飛ばした数を返します。
+func ImportChatGPTConversations(path, logDir string, tags []string) (int, int, error) {
+	data, err := os.ReadFile(filepath.Clean(path))
+	if err != nil {
+		return 0, 0, fmt.Errorf("ChatGPT のエクスポートの読み込みに失敗しました: %w", err)
+	}
+	var sources []chatGPTConversation
+	if err := json.Unmarshal(data, &sources); err != nil {
+		return 0, 0, fmt.Errorf("ChatGPT のエクスポートの解析に失敗しました（conversations.json を指定してください）: %w", err)
+	}
+
+	imported, skipped := 0, 0
+	for _, source := range sources {
+		conversation := ConvertChatGPTConversation(source)
+		if len(conversation.Messages) == 0 {
+			skipped++
+			continue
+		}
+		conversation.Meta.Tags = append([]string{}, tags...)
+		if conversation.Meta.CreatedAt.IsZero() {
+			conversation.Meta.CreatedAt = time.Now()
+		}
+		if conversation.Meta.UpdatedAt.IsZero() {
+			conversation.Meta.UpdatedAt = conversation.Meta.CreatedAt
+		}
+
+		name := "chatgpt_" + conversation.Meta.CreatedAt.Local().Format("20060102_150405")
+		if slug := titleSlug(conversation.Meta.Title); slug != "" {
+			name += "_" + slug
+		}
+		target := filepath.Join(logDir, name+".json")
+		if _, err := os.Stat(target); err == nil {
+			skipped++
+			continue
+		}
+		if err := writeConversation(target, conversation); err != nil {
+			return imported, skipped, fmt.Errorf("会話履歴の保存に失敗しました: %w", err)
+		}
+		imported++
+	}
+	return imported, skipped, nil
+}
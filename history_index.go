@@ -0,0 +1,256 @@
+package main
+
+import (
+	"bytes"
+	"encoding/gob"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+)
+
+// searchIndexFileName はログディレクトリに保存する検索用のインデックスのファイル名です
+const searchIndexFileName = ".search-index"
+
+// searchIndexVersion はインデックスの形式のバージョンです。形式を変えた場合はインデックスを作り直します。
+const searchIndexVersion = 2
+
+// SearchIndex は、3文字の組（トライグラム）ごとに、それを含む会話履歴のファイルの番号を記録した検索用の転置インデックスです。
+// 検索では必要なトライグラムの番号の一覧の共通部分だけを調べるため、会話履歴の数が多くても各ファイルの内容を調べません。
+//
+// 変更または削除したファイルの古い番号は Postings に残り、Stale に数えます。
+// 古い番号が登録中のファイルの数以上になった場合は compact で取り除きます。
+type SearchIndex struct {
+	Version  int
+	Files    map[string]IndexedFile
+	Postings map[string][]int
+	NextID   int
+	Stale    int
+}
+
+// IndexedFile はインデックスに登録した会話履歴のファイルです。
+// ファイルの更新日時とサイズが変わった場合は新しい番号で登録し直します。
+type IndexedFile struct {
+	ModTime time.Time
+	Size    int64
+	ID      int
+}
+
+// newSearchIndex は空のインデックスを返します
+func newSearchIndex() *SearchIndex {
+	return &SearchIndex{Version: searchIndexVersion, Files: make(map[string]IndexedFile), Postings: make(map[string][]int)}
+}
+
+// LoadSearchIndex はログディレクトリのインデックスを読み込みます。存在しない場合や形式が古い場合は空のインデックスを返します。
+// 会話履歴の暗号化が有効な場合、インデックスも暗号化して保存します。
+func LoadSearchIndex(logDir string) *SearchIndex {
+	index := newSearchIndex()
+	data, err := os.ReadFile(filepath.Join(logDir, searchIndexFileName))
+	if err != nil {
+		return index
+	}
+	if data, err = openHistoryData(data); err != nil {
+		logger.Debug("検索用のインデックスを作り直します: %v", err)
+		return index
+	}
+
+	var loaded SearchIndex
+	if err := gob.NewDecoder(bytes.NewReader(data)).Decode(&loaded); err != nil || loaded.Version != searchIndexVersion || loaded.Files == nil {
+		logger.Debug("検索用のインデックスを作り直します: %v", err)
+		return index
+	}
+	if loaded.Postings == nil {
+		loaded.Postings = make(map[string][]int)
+	}
+	return &loaded
+}
+
+// Save はインデックスをログディレクトリに保存します
+func (idx *SearchIndex) Save(logDir string) error {
+	var buf bytes.Buffer
+	if err := gob.NewEncoder(&buf).Encode(idx); err != nil {
+		return fmt.Errorf("検索用のインデックスの保存に失敗しました: %w", err)
+	}
+	data, err := sealHistoryData(buf.Bytes())
+	if err != nil {
+		return err
+	}
+	if err := writeFileAtomic(filepath.Join(logDir, searchIndexFileName), data, 0600); err != nil {
+		return fmt.Errorf("検索用のインデックスの保存に失敗しました: %w", err)
+	}
+	return nil
+}
+
+// Update は、paths のうち追加または変更されたファイルを登録し、存在しなくなったファイルを削除して、登録し直したファイルの数を返します
+func (idx *SearchIndex) Update(paths []string) int {
+	updated := 0
+	seen := make(map[string]bool)
+	for _, path := range paths {
+		name := filepath.Base(path)
+		seen[name] = true
+		info, err := os.Stat(path)
+		if err != nil {
+			continue
+		}
+		indexed, ok := idx.Files[name]
+		if ok && indexed.ModTime.Equal(info.ModTime()) && indexed.Size == info.Size() {
+			continue
+		}
+		if ok {
+			idx.remove(name)
+		}
+		conversation, err := LoadConversation(path)
+		if err != nil {
+			continue
+		}
+		// 番号は登録するたびに増えるため、各トライグラムの番号の一覧は昇順のまま追加できる
+		id := idx.NextID
+		idx.NextID++
+		for _, trigram := range conversationTrigrams(conversation) {
+			idx.Postings[trigram] = append(idx.Postings[trigram], id)
+		}
+		idx.Files[name] = IndexedFile{ModTime: info.ModTime(), Size: info.Size(), ID: id}
+		updated++
+	}
+	for name := range idx.Files {
+		if !seen[name] {
+			idx.remove(name)
+			updated++
+		}
+	}
+	if idx.Stale > 0 && idx.Stale >= len(idx.Files) {
+		idx.compact()
+	}
+	return updated
+}
+
+// remove はファイルをインデックスから削除します。Postings に残った古い番号は compact で取り除きます。
+func (idx *SearchIndex) remove(name string) {
+	delete(idx.Files, name)
+	idx.Stale++
+}
+
+// compact は、Postings から削除したファイルの番号を取り除きます
+func (idx *SearchIndex) compact() {
+	live := make(map[int]bool, len(idx.Files))
+	for _, indexed := range idx.Files {
+		live[indexed.ID] = true
+	}
+	for trigram, ids := range idx.Postings {
+		kept := ids[:0]
+		for _, id := range ids {
+			if live[id] {
+				kept = append(kept, id)
+			}
+		}
+		if len(kept) == 0 {
+			delete(idx.Postings, trigram)
+		} else {
+			idx.Postings[trigram] = kept
+		}
+	}
+	idx.Stale = 0
+}
+
+// Candidates は、paths のうち literals のすべてのトライグラムを含むファイルだけを返します。
+// インデックスに登録されていないファイルは候補に含めます。
+func (idx *SearchIndex) Candidates(paths []string, literals []string) []string {
+	required := make(map[string]bool)
+	for _, literal := range literals {
+		for _, trigram := range trigrams(literal) {
+			required[trigram] = true
+		}
+	}
+	if len(required) == 0 {
+		return paths
+	}
+
+	// 番号の一覧の短いものから順に共通部分を取る
+	lists := make([][]int, 0, len(required))
+	for trigram := range required {
+		lists = append(lists, idx.Postings[trigram])
+	}
+	sort.Slice(lists, func(i, j int) bool { return len(lists[i]) < len(lists[j]) })
+	matched := lists[0]
+	for _, list := range lists[1:] {
+		if len(matched) == 0 {
+			break
+		}
+		matched = intersectSorted(matched, list)
+	}
+	ids := make(map[int]bool, len(matched))
+	for _, id := range matched {
+		ids[id] = true
+	}
+
+	var candidates []string
+	for _, path := range paths {
+		indexed, ok := idx.Files[filepath.Base(path)]
+		if !ok || ids[indexed.ID] {
+			candidates = append(candidates, path)
+		}
+	}
+	return candidates
+}
+
+// intersectSorted は、昇順の a と b の両方に含まれる番号を昇順で返します
+func intersectSorted(a, b []int) []int {
+	var result []int
+	for i, j := 0, 0; i < len(a) && j < len(b); {
+		switch {
+		case a[i] < b[j]:
+			i++
+		case a[i] > b[j]:
+			j++
+		default:
+			result = append(result, a[i])
+			i++
+			j++
+		}
+	}
+	return result
+}
+
+// UpdateSearchIndex は、ログディレクトリのインデックスを読み込んで paths の変更を反映し、変更があれば保存します
+func UpdateSearchIndex(logDir string, paths []string) (*SearchIndex, error) {
+	index := LoadSearchIndex(logDir)
+	if index.Update(paths) > 0 {
+		if err := index.Save(logDir); err != nil {
+			return nil, err
+		}
+	}
+	return index, nil
+}
+
+// conversationTrigrams は、会話のタイトル、タグ、メッセージに含まれるトライグラムを重複なくソートして返します
+func conversationTrigrams(conversation Conversation) []string {
+	texts := []string{conversation.Meta.Title, strings.Join(conversation.Meta.Tags, "\n")}
+	for _, message := range conversation.Messages {
+		texts = append(texts, message.Content)
+	}
+
+	set := make(map[string]struct{})
+	for _, text := range texts {
+		for _, trigram := range trigrams(strings.ToLower(text)) {
+			set[trigram] = struct{}{}
+		}
+	}
+	result := make([]string, 0, len(set))
+	for trigram := range set {
+		result = append(result, trigram)
+	}
+	sort.Strings(result)
+	return result
+}
+
+// trigrams は文字列に含まれる連続した3文字の組をすべて返します
+func trigrams(s string) []string {
+	runes := []rune(s)
+	var result []string
+	for i := 0; i+3 <= len(runes); i++ {
+		result = append(result, string(runes[i:i+3]))
+	}
+	return result
+}
@@ -0,0 +1,15 @@
+//go:build !unix && !windows
+
+package main
+
+import "os"
+
+// lockFile は、ファイルのロックに対応していない環境では何もしません
+func lockFile(file *os.File) error {
+	return nil
+}
+
+// unlockFile は、ファイルのロックに対応していない環境では何もしません
+func unlockFile(file *os.File) error {
+	return nil
+}
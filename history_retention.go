@@ -0,0 +1,205 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// HistoryRetentionConfig は会話履歴の保存期間などの設定で、以下のフィールドを含みます:
+// - MaxAge: 最終更新日時からこの期間が過ぎた会話履歴を削除（30d, 12w, 720h のように指定）
+// - MaxCount: 会話履歴の数の上限（更新日時の古いものから削除）
+// - MaxTotalSize: 会話履歴のファイルの合計サイズの上限（500MB, 1GB のように指定。更新日時の古いものから削除）
+//
+// 固定（history pin）した会話履歴は削除しません。固定した会話履歴も数と合計サイズには含めます。
+type HistoryRetentionConfig struct {
+	MaxAge       string `yaml:"maxAge,omitempty"`
+	MaxCount     int    `yaml:"maxCount,omitempty"`
+	MaxTotalSize string `yaml:"maxTotalSize,omitempty"`
+}
+
+// Enabled は、保存期間などの上限が1つでも設定されているかを返します
+func (r HistoryRetentionConfig) Enabled() bool {
+	return r.MaxAge != "" || r.MaxCount > 0 || r.MaxTotalSize != ""
+}
+
+// ParseByteSize は、500MB や 1.5GiB のようなサイズをバイト数にします。単位がない場合はバイトとして扱います。
+func ParseByteSize(s string) (int64, error) {
+	units := []struct {
+		suffix string
+		size   float64
+	}{
+		{"KIB", 1 << 10}, {"MIB", 1 << 20}, {"GIB", 1 << 30},
+		{"KB", 1e3}, {"MB", 1e6}, {"GB", 1e9},
+		{"K", 1 << 10}, {"M", 1 << 20}, {"G", 1 << 30},
+		{"B", 1},
+	}
+	value := strings.ToUpper(strings.TrimSpace(s))
+	multiplier := 1.0
+	for _, unit := range units {
+		if strings.HasSuffix(value, unit.suffix) {
+			value = strings.TrimSpace(strings.TrimSuffix(value, unit.suffix))
+			multiplier = unit.size
+			break
+		}
+	}
+	n, err := strconv.ParseFloat(value, 64)
+	if err != nil || n < 0 {
+		return 0, fmt.Errorf("サイズは 500MB や 1GB のように指定してください: %s", s)
+	}
+	return int64(n * multiplier), nil
+}
+
+// formatByteSize はバイト数を読みやすい単位で表示します
+func formatByteSize(n int64) string {
+	switch {
+	case n >= 1e9:
+		return fmt.Sprintf("%.1fGB", float64(n)/1e9)
+	case n >= 1e6:
+		return fmt.Sprintf("%.1fMB", float64(n)/1e6)
+	case n >= 1e3:
+		return fmt.Sprintf("%.1fKB", float64(n)/1e3)
+	}
+	return fmt.Sprintf("%dB", n)
+}
+
+// PruneCandidate は保存期間などの上限を超えたために削除する会話履歴です
+type PruneCandidate struct {
+	Entry  HistoryEntry
+	Size   int64
+	Reason string
+}
+
+// PlanPrune は、retention の上限を超えた会話履歴を、更新日時の新しい順の entries から選んで返します。
+// 固定した会話履歴、パスが keep の会話履歴（今回保存した会話履歴）、作成日時と更新日時のない会話履歴は削除の対象にしません。
+func PlanPrune(entries []HistoryEntry, retention HistoryRetentionConfig, keep string, now time.Time) ([]PruneCandidate, error) {
+	var cutoff time.Time
+	if retention.MaxAge != "" {
+		var err error
+		if cutoff, err = ParseHistoryDate(retention.MaxAge, now, false); err != nil {
+			return nil, fmt.Errorf("history.retention.maxAge が不正です: %w", err)
+		}
+	}
+	var maxSize int64
+	if retention.MaxTotalSize != "" {
+		var err error
+		if maxSize, err = ParseByteSize(retention.MaxTotalSize); err != nil {
+			return nil, fmt.Errorf("history.retention.maxTotalSize が不正です: %w", err)
+		}
+	}
+
+	sizes := make([]int64, len(entries))
+	protected := make([]bool, len(entries))
+	count, total := 0, int64(0)
+	for i, entry := range entries {
+		if info, err := os.Stat(entry.Path); err == nil {
+			sizes[i] = info.Size()
+		}
+		// 日時のない会話履歴は保存期間を判断できないため削除しない
+		meta := entry.Conversation.Meta
+		protected[i] = meta.Pinned || (keep != "" && entry.Path == historyFilename(keep)) || (meta.CreatedAt.IsZero() && meta.UpdatedAt.IsZero())
+		if protected[i] {
+			count++
+			total += sizes[i]
+		}
+	}
+
+	// 固定した会話履歴を残したうえで、残りを新しい順に上限まで残す
+	var candidates []PruneCandidate
+	for i, entry := range entries {
+		if protected[i] {
+			continue
+		}
+		reason := ""
+		switch {
+		case !cutoff.IsZero() && entry.Conversation.Meta.UpdatedAt.Before(cutoff):
+			reason = "maxAge " + retention.MaxAge
+		case retention.MaxCount > 0 && count >= retention.MaxCount:
+			reason = fmt.Sprintf("maxCount %d", retention.MaxCount)
+		case maxSize > 0 && total+sizes[i] > maxSize:
+			reason = "maxTotalSize " + retention.MaxTotalSize
+		}
+		if reason != "" {
+			candidates = append(candidates, PruneCandidate{Entry: entry, Size: sizes[i], Reason: reason})
+			continue
+		}
+		count++
+		total += sizes[i]
+	}
+	return candidates, nil
+}
+
+// PruneHistory は、ログディレクトリの会話履歴のうち retention の上限を超えたものを削除し、削除した会話履歴を返します。
+// dryRun が true の場合は削除せずに、削除する会話履歴だけを返します。
+func PruneHistory(logDir string, retention HistoryRetentionConfig, keep string, dryRun bool) ([]PruneCandidate, error) {
+	entries, err := ListConversations(logDir)
+	if err != nil {
+		return nil, err
+	}
+	candidates, err := PlanPrune(entries, retention, keep, time.Now())
+	if err != nil || dryRun {
+		return candidates, err
+	}
+	for i, candidate := range candidates {
+		if err := os.Remove(candidate.Entry.Path); err != nil {
+			return candidates[:i], fmt.Errorf("会話履歴の削除に失敗しました: %w", err)
+		}
+	}
+	return candidates, nil
+}
+
+// PrintPruneCandidates は、削除する会話履歴を「名前、更新日時、サイズ、理由、タイトル」の一覧として表示します
+func PrintPruneCandidates(w io.Writer, candidates []PruneCandidate) {
+	nameWidth := 0
+	for _, candidate := range candidates {
+		nameWidth = max(nameWidth, displayWidth(candidate.Entry.Name))
+	}
+	var total int64
+	for _, candidate := range candidates {
+		fmt.Fprintf(w, "%s  %s  %8s  %-18s  %s\n",
+			padRight(candidate.Entry.Name, nameWidth),
+			candidate.Entry.Conversation.Meta.UpdatedAt.Local().Format("2006-01-02 15:04"),
+			formatByteSize(candidate.Size),
+			candidate.Reason,
+			candidate.Entry.Conversation.DisplayTitle())
+		total += candidate.Size
+	}
+	fmt.Fprintf(w, "%d 件、合計 %s\n", len(candidates), formatByteSize(total))
+}
+
+// autoPruneHistory は、会話履歴を保存した後に保存期間などの上限を超えた会話履歴を削除します。
+// 失敗しても会話履歴の保存には影響しないため、エラーはログに出力するだけです。
+func autoPruneHistory(options Options) {
+	retention := options.History.Retention
+	if !retention.Enabled() || options.LogDir == "" {
+		return
+	}
+	pruned, err := PruneHistory(options.LogDir, retention, options.HistoryFile, false)
+	if err != nil {
+		logger.Info("古い会話履歴の削除に失敗しました: %v", err)
+	}
+	if len(pruned) > 0 {
+		fmt.Fprintf(os.Stderr, "保存期間などの上限を超えた %d 件の会話履歴を削除しました。\n", len(pruned))
+	}
+}
+
+// setHistoryPinned は会話履歴を固定または固定を解除します。固定した会話履歴は history prune や自動の削除の対象になりません。
+func setHistoryPinned(logDir string, names []string, pinned bool) error {
+	for _, name := range names {
+		path, _, err := loadHistoryByName(logDir, name)
+		if err != nil {
+			return err
+		}
+		err = UpdateConversation(path, func(conversation *Conversation) error {
+			conversation.Meta.Pinned = pinned
+			return nil
+		})
+		if err != nil {
+			return fmt.Errorf("会話履歴の保存に失敗しました: %w", err)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,101 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	openai "github.com/sashabaranov/go-openai"
+)
+
+func TestParseByteSize(t *testing.T) {
+	tests := map[string]int64{
+		"1024":   1024,
+		"500MB":  500_000_000,
+		"1.5 GB": 1_500_000_000,
+		"2MiB":   2 << 20,
+		"10k":    10 << 10,
+	}
+	for input, want := range tests {
+		if got, err := ParseByteSize(input); err != nil || got != want {
+			t.Errorf("ParseByteSize(%q) = %d, %v, want %d", input, got, err, want)
+		}
+	}
+	if _, err := ParseByteSize("大きい"); err == nil {
+		t.Error("不正なサイズでエラーになりません")
+	}
+}
+
+func TestPruneHistory(t *testing.T) {
+	logger = NewConsoleLogger(false)
+	dir := t.TempDir()
+	now := time.Now()
+	write := func(name string, age time.Duration, pinned bool) string {
+		path := filepath.Join(dir, name+".json")
+		conversation := Conversation{
+			Meta: HistoryMeta{CreatedAt: now.Add(-age), UpdatedAt: now.Add(-age), Pinned: pinned},
+			Messages: []openai.ChatCompletionMessage{
+				{Role: openai.ChatMessageRoleUser, Content: strings.Repeat("あ", 100)},
+			},
+		}
+		if err := writeConversation(path, conversation); err != nil {
+			t.Fatal(err)
+		}
+		return path
+	}
+	write("new", time.Hour, false)
+	current := write("current", 2*time.Hour, false)
+	write("middle", 3*24*time.Hour, false)
+	write("pinned", 100*24*time.Hour, true)
+	write("old", 60*24*time.Hour, false)
+	// ログディレクトリにある会話履歴ではない JSON ファイルは削除しない
+	foreign := map[string]string{
+		"package.json":  `{"name": "app", "version": "1.0.0"}`,
+		"tsconfig.json": `{"compilerOptions": {"strict": true}}`,
+		"list.json":     `[{"id": 1}]`,
+	}
+	for name, content := range foreign {
+		if err := os.WriteFile(filepath.Join(dir, name), []byte(content), 0600); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	retention := HistoryRetentionConfig{MaxAge: "30d", MaxCount: 3}
+	candidates, err := PruneHistory(dir, retention, current, true)
+	if err != nil {
+		t.Fatalf("PruneHistory() エラー: %v", err)
+	}
+	var names []string
+	for _, candidate := range candidates {
+		names = append(names, candidate.Entry.Name+":"+strings.Fields(candidate.Reason)[0])
+	}
+	// pinned と current は残し、件数の上限（3件）に new を含めて残りを削除する
+	if strings.Join(names, ",") != "middle:maxCount,old:maxAge" {
+		t.Fatalf("削除する会話履歴が正しくありません: %v", names)
+	}
+	if _, err := os.Stat(filepath.Join(dir, "middle.json")); err != nil {
+		t.Error("-dry-run で削除されています")
+	}
+
+	if _, err := PruneHistory(dir, HistoryRetentionConfig{MaxTotalSize: "1B"}, current, false); err != nil {
+		t.Fatal(err)
+	}
+	entries, err := ListConversations(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	names = nil
+	for _, entry := range entries {
+		names = append(names, entry.Name)
+	}
+	if strings.Join(names, ",") != "current,pinned" {
+		t.Errorf("固定した会話履歴と今回の会話履歴だけが残る必要があります: %v", names)
+	}
+	for name, content := range foreign {
+		if data, err := os.ReadFile(filepath.Join(dir, name)); err != nil || string(data) != content {
+			t.Errorf("会話履歴ではない %s が削除または変更されました: %v", name, err)
+		}
+	}
+}
@@ -0,0 +1,291 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"regexp"
+	"regexp/syntax"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	openai "github.com/sashabaranov/go-openai"
+)
+
+// HistoryQuery は会話履歴の検索条件で、以下のフィールドを含みます:
+// - Pattern: 検索する文字列（Regex が true の場合は正規表現）
+// - Regex: Pattern を正規表現として扱うかどうか
+// - CaseSensitive: 大文字と小文字を区別するかどうか
+// - Roles: 検索するメッセージのロール（空の場合はすべてのメッセージとタイトル、タグ）
+// - Since, Until: 会話の期間（作成日時から最終更新日時まで）がこの範囲と重なる会話履歴だけを検索（ゼロ値の場合は制限なし）
+// - Tag: 指定したタグが付いた会話履歴だけを検索
+type HistoryQuery struct {
+	Pattern       string
+	Regex         bool
+	CaseSensitive bool
+	Roles         []string
+	Since         time.Time
+	Until         time.Time
+	Tag           string
+}
+
+// HistoryMatch は検索に一致した1行です
+// - Turn: 一致したメッセージが何往復目か（タイトルやタグの場合は0）
+// - Role: メッセージのロール（タイトルの場合は title、タグの場合は tags）
+// - Line: 一致した行
+// - Start, End: Line の中で一致した部分のバイト位置
+type HistoryMatch struct {
+	Turn       int
+	Role       string
+	Line       string
+	Start, End int
+}
+
+// Compile は検索条件の正規表現を返します
+func (q HistoryQuery) Compile() (*regexp.Regexp, error) {
+	if q.Pattern == "" {
+		return nil, fmt.Errorf("検索する文字列を指定してください")
+	}
+	pattern := q.Pattern
+	if !q.Regex {
+		pattern = regexp.QuoteMeta(pattern)
+	}
+	if !q.CaseSensitive {
+		pattern = "(?i)" + pattern
+	}
+	re, err := regexp.Compile(pattern)
+	if err != nil {
+		return nil, fmt.Errorf("検索する正規表現が不正です: %w", err)
+	}
+	return re, nil
+}
+
+// Accepts は、会話履歴がタグと期間の条件を満たすかを返します
+func (q HistoryQuery) Accepts(conversation Conversation) bool {
+	if q.Tag != "" && !conversation.HasTag(q.Tag) {
+		return false
+	}
+	if !q.Since.IsZero() && conversation.Meta.UpdatedAt.Before(q.Since) {
+		return false
+	}
+	if !q.Until.IsZero() && !conversation.Meta.CreatedAt.Before(q.Until) {
+		return false
+	}
+	return true
+}
+
+// Match は、会話履歴の中で re に一致する行をすべて返します
+func (q HistoryQuery) Match(conversation Conversation, re *regexp.Regexp) []HistoryMatch {
+	var matches []HistoryMatch
+	if len(q.Roles) == 0 {
+		matches = append(matches, matchLines(re, conversation.Meta.Title, 0, "title")...)
+		matches = append(matches, matchLines(re, strings.Join(conversation.Meta.Tags, ", "), 0, "tags")...)
+	}
+
+	turn := 0
+	for _, message := range conversation.Messages {
+		if message.Role == openai.ChatMessageRoleUser {
+			turn++
+		}
+		if len(q.Roles) > 0 && !containsString(q.Roles, message.Role) {
+			continue
+		}
+		matches = append(matches, matchLines(re, message.Content, turn, message.Role)...)
+	}
+	return matches
+}
+
+// matchLines は text の中で re に一致する行を返します
+func matchLines(re *regexp.Regexp, text string, turn int, role string) []HistoryMatch {
+	var matches []HistoryMatch
+	for _, line := range strings.Split(text, "\n") {
+		if loc := re.FindStringIndex(line); loc != nil {
+			matches = append(matches, HistoryMatch{Turn: turn, Role: role, Line: line, Start: loc[0], End: loc[1]})
+		}
+	}
+	return matches
+}
+
+// containsString はスライスに文字列が含まれるかを返します
+func containsString(list []string, s string) bool {
+	for _, item := range list {
+		if item == s {
+			return true
+		}
+	}
+	return false
+}
+
+// HistorySearchResult は検索に一致した会話履歴と、一致した行の一覧です
+type HistorySearchResult struct {
+	Entry   HistoryEntry
+	Matches []HistoryMatch
+}
+
+// SearchHistory は、ログディレクトリの会話履歴を検索し、一致した会話履歴を更新日時の新しい順に返します。
+// useIndex が true の場合は、検索用のインデックスを更新して、一致する可能性のあるファイルだけを読み込みます。
+func SearchHistory(logDir string, query HistoryQuery, useIndex bool) ([]HistorySearchResult, error) {
+	re, err := query.Compile()
+	if err != nil {
+		return nil, err
+	}
+
+	paths, err := historyPaths(logDir)
+	if err != nil {
+		return nil, err
+	}
+	if useIndex {
+		index, err := UpdateSearchIndex(logDir, paths)
+		if err != nil {
+			return nil, err
+		}
+		paths = index.Candidates(paths, requiredLiterals(re))
+	}
+
+	var results []HistorySearchResult
+	for _, entry := range loadHistoryEntries(paths) {
+		if !query.Accepts(entry.Conversation) {
+			continue
+		}
+		if matches := query.Match(entry.Conversation, re); len(matches) > 0 {
+			results = append(results, HistorySearchResult{Entry: entry, Matches: matches})
+		}
+	}
+	return results, nil
+}
+
+// requiredLiterals は、正規表現に一致する文字列に必ず含まれる文字列（小文字）を返します。
+// インデックスで候補を絞り込むために使います。
+func requiredLiterals(re *regexp.Regexp) []string {
+	parsed, err := syntax.Parse(re.String(), syntax.Perl)
+	if err != nil {
+		return nil
+	}
+	var literals []string
+	var walk func(r *syntax.Regexp)
+	walk = func(r *syntax.Regexp) {
+		switch r.Op {
+		case syntax.OpLiteral:
+			literals = append(literals, strings.ToLower(string(r.Rune)))
+		case syntax.OpConcat:
+			// 連続するリテラルは1つの文字列として扱う
+			var current []rune
+			flush := func() {
+				if len(current) > 0 {
+					literals = append(literals, strings.ToLower(string(current)))
+					current = nil
+				}
+			}
+			for _, sub := range r.Sub {
+				if sub.Op == syntax.OpLiteral {
+					current = append(current, sub.Rune...)
+					continue
+				}
+				flush()
+				walk(sub)
+			}
+			flush()
+		case syntax.OpCapture, syntax.OpPlus:
+			walk(r.Sub[0])
+		case syntax.OpRepeat:
+			if r.Min >= 1 {
+				walk(r.Sub[0])
+			}
+		}
+	}
+	walk(parsed.Simplify())
+	return literals
+}
+
+// ParseHistoryDate は、日付（2006-01-02）、日時（RFC 3339）、または現在からの相対的な期間（30d, 2w, 12h）を解析します。
+// endOfDay が true の場合、日付だけの指定はその日の終わり（翌日の0時）として扱います。
+func ParseHistoryDate(s string, now time.Time, endOfDay bool) (time.Time, error) {
+	if t, err := time.Parse(time.RFC3339, s); err == nil {
+		return t, nil
+	}
+	if t, err := time.ParseInLocation("2006-01-02", s, time.Local); err == nil {
+		if endOfDay {
+			t = t.AddDate(0, 0, 1)
+		}
+		return t, nil
+	}
+	if len(s) >= 2 {
+		if n, err := strconv.Atoi(s[:len(s)-1]); err == nil && n >= 0 {
+			switch s[len(s)-1] {
+			case 'h':
+				return now.Add(-time.Duration(n) * time.Hour), nil
+			case 'd':
+				return now.AddDate(0, 0, -n), nil
+			case 'w':
+				return now.AddDate(0, 0, -7*n), nil
+			}
+		}
+	}
+	return time.Time{}, fmt.Errorf("日付は 2006-01-02、RFC 3339、または 30d のような期間で指定してください: %s", s)
+}
+
+// PrintHistoryMatches は、一致した行を「名前:往復 [ロール] 一致した部分の前後」の形式で表示します。
+// color が true の場合は一致した部分を強調して表示します。
+func PrintHistoryMatches(w io.Writer, results []HistorySearchResult, color bool) {
+	for _, result := range results {
+		for _, match := range result.Matches {
+			location := fmt.Sprintf("%s:%d", result.Entry.Name, match.Turn)
+			if color {
+				location = ansiCyan + location + ansiReset
+			}
+			fmt.Fprintf(w, "%s [%s] %s\n", location, match.Role, matchSnippet(match, 40, 80, color))
+		}
+	}
+}
+
+// matchSnippet は、一致した部分の前 before 文字と後 after 文字を切り出します
+func matchSnippet(match HistoryMatch, before, after int, color bool) string {
+	head := []rune(strings.TrimLeft(match.Line[:match.Start], " \t"))
+	body := match.Line[match.Start:match.End]
+	tail := []rune(strings.TrimRight(match.Line[match.End:], " \t\r"))
+
+	prefix := string(head)
+	if len(head) > before {
+		prefix = "…" + string(head[len(head)-before:])
+	}
+	suffix := string(tail)
+	if len(tail) > after {
+		suffix = string(tail[:after]) + "…"
+	}
+	if color {
+		body = ansiBold + ansiRed + body + ansiReset
+	}
+	return prefix + body + suffix
+}
+
+// loadHistoryEntries は会話履歴のファイルを読み込み、更新日時の新しい順に返します。
+// 会話履歴として読み込めないファイルは読み飛ばします。
+func loadHistoryEntries(paths []string) []HistoryEntry {
+	var entries []HistoryEntry
+	locked := 0
+	for _, path := range paths {
+		conversation, err := LoadConversation(path)
+		if errors.Is(err, errHistoryKeyMissing) {
+			locked++
+			continue
+		}
+		if err != nil {
+			logger.Debug("会話履歴として読み込めないファイルを読み飛ばします (%s): %v", path, err)
+			continue
+		}
+		entries = append(entries, HistoryEntry{
+			Name:         historyEntryName(path),
+			Path:         path,
+			Conversation: conversation,
+		})
+	}
+	if locked > 0 {
+		logger.Info("暗号化された %d 件の会話履歴を読み飛ばしました: %v", locked, errHistoryKeyMissing)
+	}
+	sort.SliceStable(entries, func(i, j int) bool {
+		return entries[i].Conversation.Meta.UpdatedAt.After(entries[j].Conversation.Meta.UpdatedAt)
+	})
+	return entries
+}
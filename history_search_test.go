@@ -0,0 +1,139 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	openai "github.com/sashabaranov/go-openai"
+)
+
+func TestSearchHistory(t *testing.T) {
+	logger = NewConsoleLogger(false)
+	dir := t.TempDir()
+	conversations := map[string]Conversation{
+		"k8s": {
+			Meta: HistoryMeta{Title: "ノードのドレイン", CreatedAt: time.Date(2026, 9, 1, 10, 0, 0, 0, time.Local)},
+			Messages: []openai.ChatCompletionMessage{
+				{Role: openai.ChatMessageRoleUser, Content: "kubectl drain の使い方"},
+				{Role: openai.ChatMessageRoleAssistant, Content: "手順です。\nkubectl drain node-1 --ignore-daemonsets を実行します。"},
+				{Role: openai.ChatMessageRoleUser, Content: "Error: cannot evict pod"},
+			},
+		},
+		"go": {
+			Meta: HistoryMeta{Title: "Goのエラー処理", CreatedAt: time.Date(2026, 10, 1, 10, 0, 0, 0, time.Local)},
+			Messages: []openai.ChatCompletionMessage{
+				{Role: openai.ChatMessageRoleUser, Content: "errors.Is と errors.As の違い"},
+				{Role: openai.ChatMessageRoleAssistant, Content: "errors.Is はエラーの比較に使います。"},
+			},
+		},
+	}
+	for name, conversation := range conversations {
+		if err := SaveConversation(filepath.Join(dir, name), conversation); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	results, err := SearchHistory(dir, HistoryQuery{Pattern: "DRAIN", Roles: []string{"assistant"}}, false)
+	if err != nil {
+		t.Fatalf("SearchHistory() エラー: %v", err)
+	}
+	if len(results) != 1 || len(results[0].Matches) != 1 {
+		t.Fatalf("検索結果が正しくありません: %+v", results)
+	}
+	if match := results[0].Matches[0]; match.Turn != 1 || match.Role != "assistant" || match.Line[match.Start:match.End] != "drain" {
+		t.Errorf("一致した行が正しくありません: %+v", match)
+	}
+
+	// 正規表現、大文字と小文字の区別、インデックスを使った検索
+	for _, useIndex := range []bool{false, true} {
+		results, err = SearchHistory(dir, HistoryQuery{Pattern: `errors\.(Is|As)`, Regex: true, CaseSensitive: true}, useIndex)
+		if err != nil || len(results) != 1 || results[0].Entry.Name != "go" || len(results[0].Matches) != 2 {
+			t.Errorf("正規表現の検索結果が正しくありません (index: %t): %+v, %v", useIndex, results, err)
+		}
+	}
+	if _, err := os.Stat(filepath.Join(dir, searchIndexFileName)); err != nil {
+		t.Errorf("インデックスが保存されていません: %v", err)
+	}
+
+	// 会話の期間（作成日時から最終更新日時まで）による絞り込み
+	until, _ := ParseHistoryDate("2026-09-15", time.Now(), true)
+	results, _ = SearchHistory(dir, HistoryQuery{Pattern: "の", Until: until}, true)
+	if len(results) != 1 || results[0].Entry.Name != "k8s" {
+		t.Errorf("期間での絞り込みが正しくありません: %+v", results)
+	}
+}
+
+func TestSearchIndexCandidates(t *testing.T) {
+	logger = NewConsoleLogger(false)
+	dir := t.TempDir()
+	paths := []string{filepath.Join(dir, "a.json"), filepath.Join(dir, "b.json")}
+	SaveConversation(paths[0], Conversation{Messages: []openai.ChatCompletionMessage{{Role: "user", Content: "Terraform の state"}}})
+	SaveConversation(paths[1], Conversation{Messages: []openai.ChatCompletionMessage{{Role: "user", Content: "Ansible の inventory"}}})
+
+	index, err := UpdateSearchIndex(dir, paths)
+	if err != nil {
+		t.Fatalf("UpdateSearchIndex() エラー: %v", err)
+	}
+	re, _ := HistoryQuery{Pattern: `terra\w+ の`, Regex: true}.Compile()
+	if candidates := index.Candidates(paths, requiredLiterals(re)); len(candidates) != 1 || candidates[0] != paths[0] {
+		t.Errorf("候補が正しくありません: %v (literals: %q)", candidates, requiredLiterals(re))
+	}
+	re, _ = HistoryQuery{Pattern: `(terraform|ansible)`, Regex: true}.Compile()
+	if candidates := index.Candidates(paths, requiredLiterals(re)); len(candidates) != 2 {
+		t.Errorf("選択の正規表現で候補が絞り込まれました: %v", candidates)
+	}
+
+	// 削除したファイルはインデックスから取り除く
+	os.Remove(paths[1])
+	if updated := index.Update(paths[:1]); updated != 1 || len(index.Files) != 1 {
+		t.Errorf("削除したファイルがインデックスに残っています: %d, %v", updated, index.Files)
+	}
+	if _, ok := index.Postings["ans"]; ok || index.Stale != 0 {
+		t.Errorf("削除したファイルの番号が取り除かれていません: %v, stale %d", index.Postings["ans"], index.Stale)
+	}
+
+	// 変更したファイルは新しい内容で登録し直す
+	SaveConversation(paths[0], Conversation{Messages: []openai.ChatCompletionMessage{{Role: "user", Content: "Pulumi の stack"}}})
+	os.Chtimes(paths[0], time.Now(), time.Now().Add(time.Minute))
+	index.Update(paths[:1])
+	re, _ = HistoryQuery{Pattern: "terraform"}.Compile()
+	if candidates := index.Candidates(paths[:1], requiredLiterals(re)); len(candidates) != 0 {
+		t.Errorf("変更前の内容で候補になりました: %v", candidates)
+	}
+	re, _ = HistoryQuery{Pattern: "pulumi"}.Compile()
+	if candidates := index.Candidates(paths[:1], requiredLiterals(re)); len(candidates) != 1 {
+		t.Errorf("変更後の内容で候補になりませんでした: %v", candidates)
+	}
+}
+
+func TestParseHistoryDate(t *testing.T) {
+	now := time.Date(2026, 10, 19, 12, 0, 0, 0, time.Local)
+	tests := []struct {
+		input    string
+		endOfDay bool
+		want     time.Time
+	}{
+		{"2026-10-01", false, time.Date(2026, 10, 1, 0, 0, 0, 0, time.Local)},
+		{"2026-10-01", true, time.Date(2026, 10, 2, 0, 0, 0, 0, time.Local)},
+		{"30d", false, time.Date(2026, 9, 19, 12, 0, 0, 0, time.Local)},
+		{"2w", false, time.Date(2026, 10, 5, 12, 0, 0, 0, time.Local)},
+		{"12h", false, time.Date(2026, 10, 19, 0, 0, 0, 0, time.Local)},
+	}
+	for _, tt := range tests {
+		got, err := ParseHistoryDate(tt.input, now, tt.endOfDay)
+		if err != nil || !got.Equal(tt.want) {
+			t.Errorf("ParseHistoryDate(%q) = %v, %v, 期待値 %v", tt.input, got, err, tt.want)
+		}
+	}
+	if _, err := ParseHistoryDate("last month", now, false); err == nil {
+		t.Errorf("不正な日付がエラーになりませんでした")
+	}
+
+	snippet := matchSnippet(HistoryMatch{Line: strings.Repeat("あ", 50) + "drain" + strings.Repeat("い", 100), Start: 150, End: 155}, 10, 5, false)
+	if snippet != "…"+strings.Repeat("あ", 10)+"drain"+strings.Repeat("い", 5)+"…" {
+		t.Errorf("matchSnippet() = %q", snippet)
+	}
+}
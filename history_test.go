@@ -0,0 +1,252 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	openai "github.com/sashabaranov/go-openai"
+)
+
+func TestLoadConversationLegacyFormat(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "old.json")
+	legacy := `[{"role":"user","content":"こんにちは"},{"role":"assistant","content":"はい"}]`
+	if err := os.WriteFile(path, []byte(legacy), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	conversation, err := LoadConversation(strings.TrimSuffix(path, ".json"))
+	if err != nil {
+		t.Fatalf("LoadConversation() エラー: %v", err)
+	}
+	if len(conversation.Messages) != 2 || conversation.Turns() != 1 {
+		t.Errorf("以前の形式のメッセージが読み込めません: %+v", conversation.Messages)
+	}
+	if conversation.Meta.UpdatedAt.IsZero() || conversation.DisplayTitle() != "こんにちは" {
+		t.Errorf("メタデータが正しくありません: %+v", conversation.Meta)
+	}
+}
+
+func TestRecordConversation(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "chat")
+	history := []openai.ChatCompletionMessage{{Role: openai.ChatMessageRoleUser, Content: "質問"}}
+	options := Options{PromptOption: "review", Tags: []string{"go", "cli"}}
+
+	if err := RecordConversation(path, history, "gpt-4o-mini", options, openai.Usage{PromptTokens: 10, CompletionTokens: 5, TotalTokens: 15}); err != nil {
+		t.Fatalf("RecordConversation() エラー: %v", err)
+	}
+	first, _ := LoadConversation(path)
+	first.Meta.Title = "タイトル"
+	if err := SaveConversation(path, first); err != nil {
+		t.Fatal(err)
+	}
+
+	history = append(history, openai.ChatCompletionMessage{Role: openai.ChatMessageRoleAssistant, Content: "回答"})
+	options.Tags = []string{"go", "test"}
+	if err := RecordConversation(path, history, "gpt-4o", options, openai.Usage{PromptTokens: 20, CompletionTokens: 10, TotalTokens: 30}); err != nil {
+		t.Fatalf("RecordConversation() エラー: %v", err)
+	}
+
+	conversation, err := LoadConversation(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	meta := conversation.Meta
+	if meta.Title != "タイトル" || meta.Model != "gpt-4o" || meta.Prompt != "review" {
+		t.Errorf("メタデータが正しくありません: %+v", meta)
+	}
+	if strings.Join(meta.Tags, ",") != "go,cli,test" {
+		t.Errorf("タグ = %v, 期待値 [go cli test]", meta.Tags)
+	}
+	if meta.Usage.TotalTokens != 45 || meta.Usage.PromptTokens != 30 {
+		t.Errorf("トークン使用量の合計が正しくありません: %+v", meta.Usage)
+	}
+	if !meta.CreatedAt.Equal(first.Meta.CreatedAt) || len(conversation.Messages) != 2 {
+		t.Errorf("作成日時またはメッセージが正しくありません: %+v", conversation)
+	}
+}
+
+func TestRecordConversationMergesConcurrentUpdate(t *testing.T) {
+	logger = NewConsoleLogger(false)
+	path := filepath.Join(t.TempDir(), "shared")
+	base := []openai.ChatCompletionMessage{
+		{Role: openai.ChatMessageRoleUser, Content: "質問1"},
+		{Role: openai.ChatMessageRoleAssistant, Content: "回答1"},
+	}
+	if err := SaveConversation(path, Conversation{Messages: base}); err != nil {
+		t.Fatal(err)
+	}
+	loaded, err := LoadConversation(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	options := Options{HistoryBase: HistorySnapshot{Loaded: true, UpdatedAt: loaded.Meta.UpdatedAt, Messages: len(loaded.Messages)}}
+
+	// 別の端末が先に1往復を追加する
+	other := append(append([]openai.ChatCompletionMessage{}, base...),
+		openai.ChatCompletionMessage{Role: openai.ChatMessageRoleUser, Content: "別の端末の質問"},
+		openai.ChatCompletionMessage{Role: openai.ChatMessageRoleAssistant, Content: "別の端末の回答"})
+	if err := RecordConversation(path, other, "", Options{}, openai.Usage{}); err != nil {
+		t.Fatal(err)
+	}
+
+	mine := append(append([]openai.ChatCompletionMessage{}, base...),
+		openai.ChatCompletionMessage{Role: openai.ChatMessageRoleUser, Content: "この端末の質問"},
+		openai.ChatCompletionMessage{Role: openai.ChatMessageRoleAssistant, Content: "この端末の回答"})
+	if err := RecordConversation(path, mine, "", options, openai.Usage{}); err != nil {
+		t.Fatalf("RecordConversation() エラー: %v", err)
+	}
+
+	saved, err := LoadConversation(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var contents []string
+	for _, message := range saved.Messages {
+		contents = append(contents, message.Content)
+	}
+	want := "質問1,回答1,別の端末の質問,別の端末の回答,この端末の質問,この端末の回答"
+	if strings.Join(contents, ",") != want {
+		t.Errorf("両方の往復が残る必要があります: %v", contents)
+	}
+}
+
+func TestRecordConversationAfterDeleteAndRegenerate(t *testing.T) {
+	logger = NewConsoleLogger(false)
+	path := filepath.Join(t.TempDir(), "shared")
+	messages := func(contents ...string) []openai.ChatCompletionMessage {
+		var result []openai.ChatCompletionMessage
+		for i, content := range contents {
+			role := openai.ChatMessageRoleUser
+			if i%2 == 1 {
+				role = openai.ChatMessageRoleAssistant
+			}
+			result = append(result, openai.ChatCompletionMessage{Role: role, Content: content})
+		}
+		return result
+	}
+	contents := func() string {
+		saved, err := LoadConversation(path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		var result []string
+		for _, message := range saved.Messages {
+			result = append(result, message.Content)
+		}
+		return strings.Join(result, ",")
+	}
+	snapshot := func(dropped int) Options {
+		loaded, err := LoadConversation(path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return Options{HistoryBase: HistorySnapshot{Loaded: true, UpdatedAt: loaded.Meta.UpdatedAt, Messages: len(loaded.Messages) - dropped, Dropped: dropped}}
+	}
+
+	// 実行中に会話履歴が削除された場合は、前の往復を含めて全体を保存する
+	SaveConversation(path, Conversation{Messages: messages("質問1", "回答1")})
+	options := snapshot(0)
+	os.Remove(historyFilename(path))
+	if err := RecordConversation(path, messages("質問1", "回答1", "質問2", "回答2"), "", options, openai.Usage{}); err != nil {
+		t.Fatalf("RecordConversation() エラー: %v", err)
+	}
+	if got := contents(); got != "質問1,回答1,質問2,回答2" {
+		t.Errorf("削除された会話履歴の前の往復が失われました: %s", got)
+	}
+
+	// -regenerate で、メタデータだけが更新された場合は最後の応答を置き換える
+	options = snapshot(1)
+	setHistoryPinned(filepath.Dir(path), []string{"shared"}, true)
+	if err := RecordConversation(path, messages("質問1", "回答1", "質問2", "新しい回答2"), "", options, openai.Usage{}); err != nil {
+		t.Fatalf("RecordConversation() エラー: %v", err)
+	}
+	if got := contents(); got != "質問1,回答1,質問2,新しい回答2" {
+		t.Errorf("生成し直した応答で置き換えられていません: %s", got)
+	}
+
+	// -regenerate で、他のプロセスが往復を追加した場合は保存しない
+	options = snapshot(1)
+	RecordConversation(path, messages("質問1", "回答1", "質問2", "新しい回答2", "質問3", "回答3"), "", Options{}, openai.Usage{})
+	if err := RecordConversation(path, messages("質問1", "回答1", "質問2", "もう一度"), "", options, openai.Usage{}); err == nil {
+		t.Errorf("他のプロセスが往復を追加した会話履歴に、生成し直した応答が保存されました")
+	}
+	if got := contents(); got != "質問1,回答1,質問2,新しい回答2,質問3,回答3" {
+		t.Errorf("他のプロセスが追加した往復が変更されました: %s", got)
+	}
+}
+
+func TestUpdateConversationConcurrent(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "concurrent")
+	var wg sync.WaitGroup
+	for i := 0; i < 20; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			err := UpdateConversation(path, func(conversation *Conversation) error {
+				conversation.Messages = append(conversation.Messages, openai.ChatCompletionMessage{Role: openai.ChatMessageRoleUser, Content: "並行"})
+				return nil
+			})
+			if err != nil {
+				t.Error(err)
+			}
+		}()
+	}
+	wg.Wait()
+
+	conversation, err := LoadConversation(path)
+	if err != nil {
+		t.Fatalf("会話履歴が壊れています: %v", err)
+	}
+	if len(conversation.Messages) != 20 {
+		t.Errorf("ロックされずに更新が失われています: %d 件", len(conversation.Messages))
+	}
+	if matches, _ := filepath.Glob(filepath.Join(filepath.Dir(path), ".*.tmp-*")); len(matches) > 0 {
+		t.Errorf("一時ファイルが残っています: %v", matches)
+	}
+}
+
+func TestListConversations(t *testing.T) {
+	logger = NewConsoleLogger(false)
+	dir := t.TempDir()
+	now := time.Now()
+	for name, conversation := range map[string]Conversation{
+		"older": {Meta: HistoryMeta{Title: "Goのテスト", Tags: []string{"go"}, UpdatedAt: now.Add(-time.Hour)}},
+		"newer": {Meta: HistoryMeta{UpdatedAt: now}, Messages: []openai.ChatCompletionMessage{{Role: openai.ChatMessageRoleUser, Content: "Rust の所有権"}}},
+	} {
+		data, err := json.Marshal(conversation)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(filepath.Join(dir, name+".json"), data, 0600); err != nil {
+			t.Fatal(err)
+		}
+	}
+	os.WriteFile(filepath.Join(dir, "broken.json"), []byte("{"), 0600)
+
+	entries, err := ListConversations(dir)
+	if err != nil {
+		t.Fatalf("ListConversations() エラー: %v", err)
+	}
+	if len(entries) != 2 || entries[0].Name != "newer" || entries[1].Name != "older" {
+		t.Fatalf("会話履歴の一覧が正しくありません: %+v", entries)
+	}
+
+	if results, err := SearchHistory(dir, HistoryQuery{Pattern: "rust"}, false); err != nil || len(results) != 1 || results[0].Entry.Name != "newer" {
+		t.Errorf("メッセージの検索結果が正しくありません: %+v, %v", results, err)
+	}
+	if matched := filterByTag(entries, "go"); len(matched) != 1 || matched[0].Name != "older" {
+		t.Errorf("タグでの絞り込みが正しくありません: %+v", matched)
+	}
+
+	var out bytes.Buffer
+	PrintHistoryEntries(&out, entries)
+	if !strings.Contains(out.String(), "Rust の所有権") || !strings.Contains(out.String(), "Goのテスト  [go]") {
+		t.Errorf("一覧の表示が正しくありません:\n%s", out.String())
+	}
+}
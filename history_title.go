@@ -0,0 +1,128 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"unicode"
+
+	openai "github.com/sashabaranov/go-openai"
+)
+
+// defaultTitleModel は、タイトルの生成に使用するモデルが設定されていない場合のモデルです
+const defaultTitleModel = "gpt-4o-mini"
+
+// titleSystemPrompt はタイトルを生成するときのシステムメッセージです
+const titleSystemPrompt = `与えられた会話の内容を表す短いタイトルを1つだけ作成してください。
+- 会話と同じ言語で、30文字以内にしてください。
+- タイトル以外の説明、引用符、句点は出力しないでください。`
+
+// GenerateTitle は、会話の最初のやり取りからタイトルを生成します
+func GenerateTitle(client ChatCompletionClient, model string, messages []openai.ChatCompletionMessage) (string, error) {
+	var sb strings.Builder
+	for _, message := range messages {
+		if message.Role != openai.ChatMessageRoleUser && message.Role != openai.ChatMessageRoleAssistant {
+			continue
+		}
+		fmt.Fprintf(&sb, "%s: %s\n\n", message.Role, truncateText(message.Content, 1000))
+		if message.Role == openai.ChatMessageRoleAssistant {
+			break
+		}
+	}
+
+	maxTokens := 60
+	resp, err := RequestChatCompletion(client, Prompt{Model: model, MaxTokens: &maxTokens}, []openai.ChatCompletionMessage{
+		{Role: openai.ChatMessageRoleSystem, Content: titleSystemPrompt},
+		{Role: openai.ChatMessageRoleUser, Content: sb.String()},
+	})
+	if err != nil {
+		return "", err
+	}
+	title := cleanTitle(resp.Choices[0].Message.Content)
+	if title == "" {
+		return "", fmt.Errorf("タイトルが空です")
+	}
+	return title, nil
+}
+
+// cleanTitle は生成されたタイトルの最初の行から、前後の空白、引用符、見出しの記号、句点を取り除きます
+func cleanTitle(title string) string {
+	title, _, _ = strings.Cut(strings.TrimSpace(title), "\n")
+	title = strings.TrimPrefix(title, "タイトル:")
+	const quotes = " \t#*\"'`「」『』"
+	title = strings.Trim(strings.TrimRight(strings.Trim(title, quotes), "。."), quotes)
+	return truncateText(title, 60)
+}
+
+// titleSlug は、タイトルをファイル名に使える文字列にします。
+// 文字と数字以外は - に置き換え、最大40文字に切り詰めます。
+func titleSlug(title string) string {
+	var slug []rune
+	for _, r := range strings.ToLower(title) {
+		switch {
+		case unicode.IsLetter(r) || unicode.IsDigit(r):
+			slug = append(slug, r)
+		case len(slug) > 0 && slug[len(slug)-1] != '-':
+			slug = append(slug, '-')
+		}
+	}
+	if len(slug) > 40 {
+		slug = slug[:40]
+	}
+	return strings.Trim(string(slug), "-")
+}
+
+// AutoTitleConversation は、自動保存したタイトルのない会話履歴の最初のやり取りの後にタイトルを生成して保存し、会話履歴のパスを返します。
+// -history で名前を指定した会話履歴ではタイトルを生成しません（history title で生成できます）。
+// renameWithTitle が有効な場合は、ファイル名を「作成日時_タイトル.json」に変更し、変更後のパスを返します。
+func AutoTitleConversation(client ChatCompletionClient, filename string, options Options) (string, error) {
+	filename = historyFilename(filename)
+	if !options.AutoHistory || !options.History.AutoTitleEnabled() {
+		return filename, nil
+	}
+	conversation, err := LoadConversation(filename)
+	if err != nil {
+		return filename, err
+	}
+	if conversation.Meta.Title != "" || conversation.Turns() != 1 {
+		return filename, nil
+	}
+
+	model := options.TitleModel
+	if model == "" {
+		model = options.History.TitleModelName(conversation.Meta.Model, false)
+	}
+	title, err := GenerateTitle(client, model, conversation.Messages)
+	if err != nil {
+		return filename, err
+	}
+	// タイトルを生成している間に他のプロセスが会話履歴を更新した場合に備えて、ロックをかけて読み込み直してから保存する
+	err = UpdateConversation(filename, func(latest *Conversation) error {
+		if latest.Meta.Title == "" {
+			latest.Meta.Title = title
+		}
+		conversation = *latest
+		return nil
+	})
+	if err != nil {
+		return filename, err
+	}
+
+	slug := titleSlug(title)
+	if !options.History.RenameWithTitle || slug == "" {
+		return filename, nil
+	}
+	base := conversation.Meta.CreatedAt.Local().Format("20060102_150405") + "_" + slug
+	renamed := filepath.Join(filepath.Dir(filename), base+".json")
+	for i := 2; ; i++ {
+		if _, err := os.Stat(renamed); os.IsNotExist(err) {
+			break
+		}
+		renamed = filepath.Join(filepath.Dir(filename), fmt.Sprintf("%s-%d.json", base, i))
+	}
+	if err := os.Rename(filename, renamed); err != nil {
+		return filename, fmt.Errorf("会話履歴のファイル名の変更に失敗しました: %w", err)
+	}
+	return renamed, nil
+}
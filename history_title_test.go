@@ -0,0 +1,98 @@
+package main
+
+import (
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	openai "github.com/sashabaranov/go-openai"
+)
+
+func TestTitleSlug(t *testing.T) {
+	tests := map[string]string{
+		"Goのcontextの使い方":            "goのcontextの使い方",
+		"  Fix: nil pointer (v2)! ": "fix-nil-pointer-v2",
+		"!!!":                       "",
+	}
+	for title, want := range tests {
+		if got := titleSlug(title); got != want {
+			t.Errorf("titleSlug(%q) = %q, 期待値 %q", title, got, want)
+		}
+	}
+	if got := cleanTitle("「Dockerの使い方」。\n説明"); got != "Dockerの使い方" {
+		t.Errorf("cleanTitle() = %q", got)
+	}
+}
+
+func TestAutoTitleConversation(t *testing.T) {
+	logger = NewConsoleLogger(false)
+	dir := t.TempDir()
+	path := filepath.Join(dir, "log_20260101_120000.000.json")
+	history := []openai.ChatCompletionMessage{
+		{Role: openai.ChatMessageRoleUser, Content: "質問"},
+		{Role: openai.ChatMessageRoleAssistant, Content: "回答"},
+	}
+	if err := SaveConversation(path, Conversation{Messages: history, Meta: HistoryMeta{CreatedAt: time.Date(2026, 1, 1, 12, 0, 0, 0, time.Local)}}); err != nil {
+		t.Fatal(err)
+	}
+
+	client := &fakeChatClient{}
+	options := Options{AutoHistory: true, History: HistoryConfig{RenameWithTitle: true}}
+	renamed, err := AutoTitleConversation(client, path, options)
+	if err != nil {
+		t.Fatalf("AutoTitleConversation() エラー: %v", err)
+	}
+	if want := filepath.Join(dir, "20260101_120000_共通の行.json"); renamed != want {
+		t.Errorf("変更後のパス = %s, 期待値 %s", renamed, want)
+	}
+	conversation, _ := LoadConversation(renamed)
+	if conversation.Meta.Title != "共通の行" {
+		t.Errorf("タイトル = %q, 期待値 %q", conversation.Meta.Title, "共通の行")
+	}
+
+	// タイトルが付いた会話履歴では再生成しない
+	if again, err := AutoTitleConversation(client, renamed, options); err != nil || again != renamed || client.calls != 1 {
+		t.Errorf("タイトルが再生成されました: %s, %v, 呼び出し回数 %d", again, err, client.calls)
+	}
+
+	// -history で名前を指定した会話履歴では生成しない
+	other := filepath.Join(dir, "named.json")
+	SaveConversation(other, Conversation{Messages: history})
+	if _, err := AutoTitleConversation(client, other, Options{}); err != nil || client.calls != 1 {
+		t.Errorf("自動保存していない会話履歴でタイトルが生成されました: %v", err)
+	}
+
+	// autoTitle: false の場合は生成しない
+	disabled := false
+	options.History.AutoTitle = &disabled
+	if _, err := AutoTitleConversation(client, strings.TrimSuffix(other, ".json"), options); err != nil || client.calls != 1 {
+		t.Errorf("autoTitle: false でタイトルが生成されました: %v", err)
+	}
+}
+
+func TestTitleModelName(t *testing.T) {
+	tests := []struct {
+		history HistoryConfig
+		model   string
+		custom  bool
+		want    string
+	}{
+		{HistoryConfig{}, "gpt-4o", false, defaultTitleModel},
+		{HistoryConfig{}, "llama-3.1-8b-instant", true, "llama-3.1-8b-instant"},
+		{HistoryConfig{TitleModel: "cheap"}, "llama-3.1-8b-instant", true, "cheap"},
+	}
+	for _, tt := range tests {
+		if got := tt.history.TitleModelName(tt.model, tt.custom); got != tt.want {
+			t.Errorf("TitleModelName(%q, %t) = %q, 期待値 %q", tt.model, tt.custom, got, tt.want)
+		}
+	}
+
+	t.Setenv("OPENAI_BASE_URL", "")
+	if usesCustomEndpoint(Config{}, "") {
+		t.Errorf("OpenAI の API が他の接続先として扱われました")
+	}
+	if !usesCustomEndpoint(Config{API: APIConfig{BaseURL: "http://localhost:11434/v1"}}, "") || !usesCustomEndpoint(Config{}, "groq") {
+		t.Errorf("他の接続先が OpenAI の API として扱われました")
+	}
+}
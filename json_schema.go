@@ -0,0 +1,326 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"math"
+	"os"
+	"path/filepath"
+	"reflect"
+	"regexp"
+	"sort"
+	"strings"
+	"unicode/utf8"
+
+	"gopkg.in/yaml.v3"
+)
+
+// JSONSchema は構造化出力で使用するJSONスキーマです
+type JSONSchema struct {
+	Name   string
+	Schema map[string]interface{}
+}
+
+// schemaNamePattern は response_format の name に使用できない文字に一致する正規表現です
+var schemaNamePattern = regexp.MustCompile(`[^a-zA-Z0-9_-]+`)
+
+// LoadJSONSchema は、ファイルのパスまたはインラインのJSON（YAML）からスキーマを読み込みます。
+// 値が { で始まる場合、または改行を含む場合はインラインのスキーマとして扱います。
+func LoadJSONSchema(spec string) (JSONSchema, error) {
+	var schema JSONSchema
+	spec = strings.TrimSpace(spec)
+	if spec == "" {
+		return schema, fmt.Errorf("スキーマが指定されていません")
+	}
+
+	data := []byte(spec)
+	name := "response"
+	if !strings.HasPrefix(spec, "{") && !strings.Contains(spec, "\n") {
+		var err error
+		data, err = os.ReadFile(filepath.Clean(spec))
+		if err != nil {
+			return schema, fmt.Errorf("スキーマファイルの読み込みに失敗しました: %w", err)
+		}
+		name = strings.TrimSuffix(filepath.Base(spec), filepath.Ext(spec))
+	}
+
+	// JSON は YAML として解析できるため、YAML で書かれたスキーマも受け付ける
+	if err := yaml.Unmarshal(data, &schema.Schema); err != nil {
+		return schema, fmt.Errorf("スキーマの解析に失敗しました: %w", err)
+	}
+	if schema.Schema == nil {
+		return schema, fmt.Errorf("スキーマが空です")
+	}
+	if title, ok := schema.Schema["title"].(string); ok && title != "" {
+		name = title
+	}
+	schema.Name = strings.Trim(schemaNamePattern.ReplaceAllString(name, "_"), "_")
+	if schema.Name == "" {
+		schema.Name = "response"
+	}
+	return schema, nil
+}
+
+// MarshalJSON はスキーマをJSONに変換します（response_format の schema として送信するため）
+func (s JSONSchema) MarshalJSON() ([]byte, error) {
+	return json.Marshal(s.Schema)
+}
+
+// Validate は、JSON文字列がスキーマに一致するかを検証します
+func (s JSONSchema) Validate(content string) error {
+	var value interface{}
+	if err := json.Unmarshal([]byte(content), &value); err != nil {
+		return fmt.Errorf("応答がJSONとして解析できません: %w", err)
+	}
+	return validateSchemaValue(s.Schema, s.Schema, value, "$")
+}
+
+// validateSchemaValue は値を JSON Schema のサブセットで検証します。
+// 対応しているキーワードは type, enum, const, properties, required, additionalProperties, items,
+// minItems, maxItems, minLength, maxLength, pattern, minimum, maximum, exclusiveMinimum, exclusiveMaximum,
+// anyOf, oneOf, allOf, $ref（同じスキーマ内の #/... のみ）です。
+func validateSchemaValue(root, schema map[string]interface{}, value interface{}, path string) error {
+	if ref, ok := schema["$ref"].(string); ok {
+		resolved, err := resolveSchemaRef(root, ref)
+		if err != nil {
+			return fmt.Errorf("%s: %w", path, err)
+		}
+		return validateSchemaValue(root, resolved, value, path)
+	}
+
+	if types, ok := schema["type"]; ok && !matchesSchemaType(types, value) {
+		return fmt.Errorf("%s: 型が一致しません (期待: %v, 実際: %s)", path, types, jsonTypeName(value))
+	}
+
+	if enum, ok := schema["enum"].([]interface{}); ok {
+		found := false
+		for _, candidate := range enum {
+			if jsonEqual(candidate, value) {
+				found = true
+				break
+			}
+		}
+		if !found {
+			return fmt.Errorf("%s: 値 %v は enum %v のいずれでもありません", path, value, enum)
+		}
+	}
+	if constValue, ok := schema["const"]; ok && !jsonEqual(constValue, value) {
+		return fmt.Errorf("%s: 値 %v は %v と一致しません", path, value, constValue)
+	}
+
+	switch v := value.(type) {
+	case map[string]interface{}:
+		if err := validateSchemaObject(root, schema, v, path); err != nil {
+			return err
+		}
+	case []interface{}:
+		if min, ok := schemaNumber(schema["minItems"]); ok && float64(len(v)) < min {
+			return fmt.Errorf("%s: 要素数 %d は minItems %v 未満です", path, len(v), min)
+		}
+		if max, ok := schemaNumber(schema["maxItems"]); ok && float64(len(v)) > max {
+			return fmt.Errorf("%s: 要素数 %d は maxItems %v を超えています", path, len(v), max)
+		}
+		if items, ok := schema["items"].(map[string]interface{}); ok {
+			for i, item := range v {
+				if err := validateSchemaValue(root, items, item, fmt.Sprintf("%s[%d]", path, i)); err != nil {
+					return err
+				}
+			}
+		}
+	case string:
+		length := float64(utf8.RuneCountInString(v))
+		if min, ok := schemaNumber(schema["minLength"]); ok && length < min {
+			return fmt.Errorf("%s: 文字数 %v は minLength %v 未満です", path, length, min)
+		}
+		if max, ok := schemaNumber(schema["maxLength"]); ok && length > max {
+			return fmt.Errorf("%s: 文字数 %v は maxLength %v を超えています", path, length, max)
+		}
+		if pattern, ok := schema["pattern"].(string); ok {
+			re, err := regexp.Compile(pattern)
+			if err != nil {
+				return fmt.Errorf("%s: スキーマの pattern が不正です: %w", path, err)
+			}
+			if !re.MatchString(v) {
+				return fmt.Errorf("%s: %q は pattern %s に一致しません", path, v, pattern)
+			}
+		}
+	case float64:
+		if min, ok := schemaNumber(schema["minimum"]); ok && v < min {
+			return fmt.Errorf("%s: %v は minimum %v 未満です", path, v, min)
+		}
+		if max, ok := schemaNumber(schema["maximum"]); ok && v > max {
+			return fmt.Errorf("%s: %v は maximum %v を超えています", path, v, max)
+		}
+		if min, ok := schemaNumber(schema["exclusiveMinimum"]); ok && v <= min {
+			return fmt.Errorf("%s: %v は exclusiveMinimum %v 以下です", path, v, min)
+		}
+		if max, ok := schemaNumber(schema["exclusiveMaximum"]); ok && v >= max {
+			return fmt.Errorf("%s: %v は exclusiveMaximum %v 以上です", path, v, max)
+		}
+	}
+
+	if allOf, ok := schema["allOf"].([]interface{}); ok {
+		for _, sub := range allOf {
+			if subSchema, ok := sub.(map[string]interface{}); ok {
+				if err := validateSchemaValue(root, subSchema, value, path); err != nil {
+					return err
+				}
+			}
+		}
+	}
+	if anyOf, ok := schema["anyOf"].([]interface{}); ok {
+		if countMatchingSchemas(root, anyOf, value, path) == 0 {
+			return fmt.Errorf("%s: anyOf のいずれのスキーマにも一致しません", path)
+		}
+	}
+	if oneOf, ok := schema["oneOf"].([]interface{}); ok {
+		if n := countMatchingSchemas(root, oneOf, value, path); n != 1 {
+			return fmt.Errorf("%s: oneOf のスキーマにちょうど1つ一致する必要があります (一致: %d)", path, n)
+		}
+	}
+	return nil
+}
+
+// validateSchemaObject はオブジェクトのプロパティを検証します
+func validateSchemaObject(root, schema map[string]interface{}, object map[string]interface{}, path string) error {
+	if required, ok := schema["required"].([]interface{}); ok {
+		for _, key := range required {
+			if name, ok := key.(string); ok {
+				if _, exists := object[name]; !exists {
+					return fmt.Errorf("%s: 必須のプロパティ %s がありません", path, name)
+				}
+			}
+		}
+	}
+
+	properties, _ := schema["properties"].(map[string]interface{})
+	keys := make([]string, 0, len(object))
+	for key := range object {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	for _, key := range keys {
+		childPath := path + "." + key
+		if propSchema, ok := properties[key].(map[string]interface{}); ok {
+			if err := validateSchemaValue(root, propSchema, object[key], childPath); err != nil {
+				return err
+			}
+			continue
+		}
+		switch additional := schema["additionalProperties"].(type) {
+		case bool:
+			if !additional {
+				return fmt.Errorf("%s: スキーマにないプロパティです", childPath)
+			}
+		case map[string]interface{}:
+			if err := validateSchemaValue(root, additional, object[key], childPath); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// countMatchingSchemas は、値が一致するスキーマの数を返します
+func countMatchingSchemas(root map[string]interface{}, schemas []interface{}, value interface{}, path string) int {
+	count := 0
+	for _, sub := range schemas {
+		if subSchema, ok := sub.(map[string]interface{}); ok {
+			if validateSchemaValue(root, subSchema, value, path) == nil {
+				count++
+			}
+		}
+	}
+	return count
+}
+
+// resolveSchemaRef は "#/$defs/name" のような同じスキーマ内の参照を解決します
+func resolveSchemaRef(root map[string]interface{}, ref string) (map[string]interface{}, error) {
+	if !strings.HasPrefix(ref, "#") {
+		return nil, fmt.Errorf("外部の $ref には対応していません: %s", ref)
+	}
+	current := root
+	for _, part := range strings.Split(strings.TrimPrefix(strings.TrimPrefix(ref, "#"), "/"), "/") {
+		if part == "" {
+			continue
+		}
+		part = strings.ReplaceAll(strings.ReplaceAll(part, "~1", "/"), "~0", "~")
+		next, ok := current[part].(map[string]interface{})
+		if !ok {
+			return nil, fmt.Errorf("$ref %s を解決できません", ref)
+		}
+		current = next
+	}
+	return current, nil
+}
+
+// matchesSchemaType は値がスキーマの type（文字列または文字列のリスト）に一致するかを返します
+func matchesSchemaType(types interface{}, value interface{}) bool {
+	var names []interface{}
+	switch t := types.(type) {
+	case string:
+		names = []interface{}{t}
+	case []interface{}:
+		names = t
+	default:
+		return true
+	}
+
+	actual := jsonTypeName(value)
+	for _, name := range names {
+		switch name {
+		case actual:
+			return true
+		case "number":
+			if actual == "integer" {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// jsonTypeName はJSONの値の型名を返します（整数値の数値は integer）
+func jsonTypeName(value interface{}) string {
+	switch v := value.(type) {
+	case nil:
+		return "null"
+	case bool:
+		return "boolean"
+	case string:
+		return "string"
+	case float64:
+		if v == math.Trunc(v) {
+			return "integer"
+		}
+		return "number"
+	case []interface{}:
+		return "array"
+	case map[string]interface{}:
+		return "object"
+	}
+	return fmt.Sprintf("%T", value)
+}
+
+// schemaNumber はスキーマの数値（YAMLから読み込んだ int も含む）を float64 で返します
+func schemaNumber(value interface{}) (float64, bool) {
+	switch v := value.(type) {
+	case int:
+		return float64(v), true
+	case int64:
+		return float64(v), true
+	case float64:
+		return v, true
+	}
+	return 0, false
+}
+
+// jsonEqual は、スキーマの値とJSONの値を数値の型の違いを無視して比較します
+func jsonEqual(schemaValue, value interface{}) bool {
+	if n, ok := schemaNumber(schemaValue); ok {
+		v, ok := value.(float64)
+		return ok && v == n
+	}
+	return reflect.DeepEqual(schemaValue, value)
+}
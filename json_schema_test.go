@@ -0,0 +1,85 @@
+package main
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestJSONSchemaValidate(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "review result.yaml")
+	schemaYAML := `
+type: object
+additionalProperties: false
+required: [summary, severity, issues]
+properties:
+  summary:
+    type: string
+    minLength: 1
+  severity:
+    enum: [low, medium, high]
+  issues:
+    type: array
+    maxItems: 2
+    items:
+      $ref: "#/$defs/issue"
+$defs:
+  issue:
+    type: object
+    required: [line]
+    properties:
+      line:
+        type: integer
+        minimum: 1
+      note:
+        type: [string, "null"]
+`
+	if err := os.WriteFile(path, []byte(schemaYAML), 0644); err != nil {
+		t.Fatalf("ファイル作成エラー: %v", err)
+	}
+
+	schema, err := LoadJSONSchema(path)
+	if err != nil {
+		t.Fatalf("LoadJSONSchema() エラー: %v", err)
+	}
+	if schema.Name != "review_result" {
+		t.Errorf("Name = %s", schema.Name)
+	}
+	if _, err := json.Marshal(schema); err != nil {
+		t.Errorf("スキーマをJSONに変換できません: %v", err)
+	}
+
+	valid := `{"summary": "OK", "severity": "low", "issues": [{"line": 3, "note": null}]}`
+	if err := schema.Validate(valid); err != nil {
+		t.Errorf("正しい応答がエラーになりました: %v", err)
+	}
+
+	invalid := map[string]string{
+		"JSONではない":  `summary: OK`,
+		"必須プロパティ":   `{"summary": "OK", "severity": "low"}`,
+		"enum":      `{"summary": "OK", "severity": "critical", "issues": []}`,
+		"追加プロパティ":   `{"summary": "OK", "severity": "low", "issues": [], "extra": 1}`,
+		"$ref の型":   `{"summary": "OK", "severity": "low", "issues": [{"line": 1.5}]}`,
+		"minimum":   `{"summary": "OK", "severity": "low", "issues": [{"line": 0}]}`,
+		"maxItems":  `{"summary": "OK", "severity": "low", "issues": [{"line": 1}, {"line": 2}, {"line": 3}]}`,
+		"minLength": `{"summary": "", "severity": "low", "issues": []}`,
+		"null 許容の型": `{"summary": "OK", "severity": "low", "issues": [{"line": 1, "note": 2}]}`,
+	}
+	for name, content := range invalid {
+		if err := schema.Validate(content); err == nil {
+			t.Errorf("%s: 不正な応答がエラーになりませんでした", name)
+		}
+	}
+
+	err = schema.Validate(`{"summary": "OK", "severity": "low", "issues": [{"line": 0}]}`)
+	if err == nil || !strings.Contains(err.Error(), "$.issues[0].line") {
+		t.Errorf("エラーに値のパスが含まれていません: %v", err)
+	}
+
+	inline, err := LoadJSONSchema(`{"title": "answer", "type": "object", "required": ["ok"]}`)
+	if err != nil || inline.Name != "answer" {
+		t.Fatalf("インラインのスキーマが読み込めません: %+v, %v", inline, err)
+	}
+}
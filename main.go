@@ -3,6 +3,8 @@ package main
 import (
 	"fmt"
 	"log"
+	"os"
+	"strings"
 )
 
 var Version string
@@ -35,18 +37,31 @@ func Run() error {
 	// ロギングの設定
 	SetupLogging(options.Debug)
 
+	// config validate はすべての問題を報告するため、-strict-config でも最初の問題で中断しないよう設定ファイルを読み込む前に実行する
+	if isConfigValidateCommand(options.Args) {
+		return validateConfigFiles(options)
+	}
+
 	// 設定ファイルの読み込み
-	config, err := LoadConfiguration(options.ConfigPath)
+	config, err := LoadConfiguration(options.ConfigPath, options.StrictConfig)
 	if err != nil {
 		return err
 	}
 
+	// 会話履歴の暗号化の設定
+	SetupHistoryEncryption(config)
+
 	// ログディレクトリの設定と検証
 	err = ConfigureLogDirectory(&options, config)
 	if err != nil {
 		return err
 	}
 
+	// サブコマンドの実行
+	if command, args, ok := findSubcommand(options.Args); ok {
+		return command(options, config, args)
+	}
+
 	// ユーザーメッセージの構築
 	err = BuildUserMessage(&options)
 	if err != nil {
@@ -59,17 +74,39 @@ func Run() error {
 		return err
 	}
 
-	// 会話履歴の読み込み
-	conversationHistory, err := LoadConversationHistory(options.HistoryFile)
+	// 会話履歴の読み込み（保存するときに他のプロセスによる変更を検出できるように、読み込んだ時点の状態を記録する）
+	history, err := LoadConversation(options.HistoryFile)
 	if err != nil {
 		return fmt.Errorf("会話履歴の読み込みに失敗しました: %w", err)
 	}
+	conversationHistory := history.Messages
+
+	// -regenerate の場合は最後の応答を削除し、最後の質問をもう一度送る
+	if options.Regenerate {
+		if options.HistoryFile == "" || options.AutoHistory {
+			return fmt.Errorf("-regenerate では -history で会話履歴を指定してください")
+		}
+		if strings.TrimSpace(options.UserMessage) != "" {
+			return fmt.Errorf("-regenerate では新しいメッセージは指定できません")
+		}
+		conversationHistory, err = DropLastResponse(conversationHistory)
+		if err != nil {
+			return err
+		}
+	}
+	options.HistoryBase = HistorySnapshot{
+		Loaded:    true,
+		UpdatedAt: history.Meta.UpdatedAt,
+		Messages:  len(conversationHistory),
+		Dropped:   len(history.Messages) - len(conversationHistory),
+	}
 
 	// OpenAI API クライアントの初期化
-	client, err := NewOpenAIClient(options.Timeout)
+	client, err := NewOpenAIClientWithConfig(config, promptConfig.Provider, promptConfig.Timeout)
 	if err != nil {
 		return err
 	}
+	options.TitleModel = config.History.TitleModelName(promptConfig.Model, usesCustomEndpoint(config, promptConfig.Provider))
 
 	// ファイルアップロードとベクトルストア追加
 	if len(options.UploadAndAddFiles) > 0 {
@@ -97,7 +134,7 @@ func Run() error {
 		}
 
 		// アシスタントとの対話を開始
-		err = handleAssistantInteraction(client, options)
+		err = handleAssistantInteraction(client, options, config)
 		if err != nil {
 			return fmt.Errorf("アシスタントとの対話に失敗しました: %v", err)
 		}
@@ -135,6 +172,12 @@ func Run() error {
 		return fmt.Errorf("メッセージの作成に失敗しました: %w", err)
 	}
 
+	// 送信する前に機密情報を伏せ字にする
+	messages, err = ApplySecretRedaction(messages, config.Redaction, options.AllowSecrets, os.Stderr)
+	if err != nil {
+		return err
+	}
+
 	// デフォルトプロンプトを設定
 	logger.Debug("現在のオプション内容:\n%s", options.String())
 	if promptConfig.System == "" && promptConfig.User == "" {
@@ -151,15 +194,17 @@ func Run() error {
 			fmt.Println("会話履歴はありません。")
 			return nil
 		}
-		DisplayConversationHistory(conversationHistory)
+		DisplayConversationHistory(conversationHistory, options.RenderMarkdownOutput(promptConfig))
 		return nil
 	}
 
-	// 会話履歴に新しいメッセージを追加
-	conversationHistory = append(conversationHistory, messages...)
+	// 会話履歴に新しいメッセージを追加（-regenerate の場合は最後の質問をそのまま送る）
+	if !options.Regenerate {
+		conversationHistory = append(conversationHistory, messages...)
+	}
 
 	// OpenAI API へのリクエスト
-	if options.UserMessage != "" || promptConfig.User != "" {
+	if options.Regenerate || options.UserMessage != "" || promptConfig.User != "" {
 		return handleChatCompletion(client, promptConfig, conversationHistory, options)
 	}
 
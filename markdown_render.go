@@ -0,0 +1,427 @@
+package main
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+// 端末でのMarkdownの表示に使用するANSIエスケープシーケンス
+const (
+	ansiItalic    = "\033[3m"
+	ansiUnderline = "\033[4m"
+	ansiYellow    = "\033[33m"
+	ansiBlue      = "\033[34m"
+	ansiMagenta   = "\033[35m"
+	ansiGray      = "\033[90m"
+)
+
+var (
+	headingPattern     = regexp.MustCompile(`^(#{1,6})\s+(.*?)\s*#*\s*$`)
+	listItemPattern    = regexp.MustCompile(`^(\s*)([-*+]|\d+[.)])\s+(.*)$`)
+	tableDelimPattern  = regexp.MustCompile(`^\s*\|?\s*:?-{2,}:?\s*(\|\s*:?-{2,}:?\s*)*\|?\s*$`)
+	hrPattern          = regexp.MustCompile(`^\s*([-*_])(\s*([-*_])){2,}\s*$`)
+	inlineCodePattern  = regexp.MustCompile("`([^`]+)`")
+	boldPattern        = regexp.MustCompile(`\*\*([^*]+)\*\*|__([^_]+)__`)
+	italicPattern      = regexp.MustCompile(`(^|[^*\w])\*([^*\s][^*]*)\*|(^|[^_\w])_([^_\s][^_]*)_`)
+	linkPattern        = regexp.MustCompile(`\[([^\]]+)\]\(([^)\s]+)\)`)
+	ansiSequence       = regexp.MustCompile(`\x1b\[[0-9;]*m`)
+	placeholderPattern = regexp.MustCompile("\x00(\\d+)\x00")
+)
+
+// RenderMarkdown は、Markdownのテキストを端末向けに整形します。
+// 見出し、リスト、引用、表、水平線、コードブロック（簡易的な構文ハイライト付き）、
+// 強調・インラインコード・リンクに対応し、段落とリストは width の幅で折り返します。
+func RenderMarkdown(text string, width int) string {
+	if width < 20 {
+		width = 20
+	}
+
+	var out strings.Builder
+	lines := strings.Split(strings.ReplaceAll(text, "\r\n", "\n"), "\n")
+	var paragraph []string
+
+	flushParagraph := func() {
+		if len(paragraph) == 0 {
+			return
+		}
+		for _, line := range wrapStyled(renderInline(strings.Join(paragraph, " ")), width) {
+			out.WriteString(line + "\n")
+		}
+		paragraph = nil
+	}
+
+	for i := 0; i < len(lines); i++ {
+		line := lines[i]
+		trimmed := strings.TrimSpace(line)
+
+		switch {
+		case strings.HasPrefix(trimmed, "```") || strings.HasPrefix(trimmed, "~~~"):
+			flushParagraph()
+			fence := trimmed[:3]
+			lang := strings.TrimSpace(strings.TrimLeft(trimmed, fence[:1]))
+			var code []string
+			for i++; i < len(lines) && !strings.HasPrefix(strings.TrimSpace(lines[i]), fence); i++ {
+				code = append(code, lines[i])
+			}
+			out.WriteString(renderCodeBlock(code, lang))
+
+		case trimmed == "":
+			flushParagraph()
+			out.WriteString("\n")
+
+		case headingPattern.MatchString(trimmed):
+			flushParagraph()
+			m := headingPattern.FindStringSubmatch(trimmed)
+			heading := renderInline(m[2])
+			switch len(m[1]) {
+			case 1:
+				out.WriteString(ansiBold + ansiUnderline + ansiCyan + heading + ansiReset + "\n")
+			case 2:
+				out.WriteString(ansiBold + ansiCyan + heading + ansiReset + "\n")
+			default:
+				out.WriteString(ansiBold + heading + ansiReset + "\n")
+			}
+
+		case hrPattern.MatchString(trimmed):
+			flushParagraph()
+			out.WriteString(ansiGray + strings.Repeat("─", width) + ansiReset + "\n")
+
+		case strings.HasPrefix(trimmed, ">"):
+			flushParagraph()
+			var quote []string
+			for ; i < len(lines) && strings.HasPrefix(strings.TrimSpace(lines[i]), ">"); i++ {
+				quote = append(quote, strings.TrimSpace(strings.TrimPrefix(strings.TrimSpace(lines[i]), ">")))
+			}
+			i--
+			for _, l := range wrapStyled(renderInline(strings.Join(quote, " ")), width-2) {
+				out.WriteString(ansiGray + "│ " + ansiReset + ansiItalic + l + ansiReset + "\n")
+			}
+
+		case strings.Contains(trimmed, "|") && i+1 < len(lines) && tableDelimPattern.MatchString(lines[i+1]):
+			flushParagraph()
+			rows := [][]string{splitTableRow(line)}
+			for i += 2; i < len(lines) && strings.Contains(lines[i], "|") && strings.TrimSpace(lines[i]) != ""; i++ {
+				rows = append(rows, splitTableRow(lines[i]))
+			}
+			i--
+			out.WriteString(renderTable(rows))
+
+		case listItemPattern.MatchString(line):
+			flushParagraph()
+			m := listItemPattern.FindStringSubmatch(line)
+			indent := strings.Repeat(" ", len(strings.ReplaceAll(m[1], "\t", "  ")))
+			marker := m[2]
+			if marker == "-" || marker == "*" || marker == "+" {
+				marker = "•"
+			}
+			item := m[3]
+			// 継続行（インデントされた行）をまとめる
+			for i+1 < len(lines) && strings.TrimSpace(lines[i+1]) != "" &&
+				strings.HasPrefix(lines[i+1], indent+" ") && !listItemPattern.MatchString(lines[i+1]) {
+				i++
+				item += " " + strings.TrimSpace(lines[i])
+			}
+			if strings.HasPrefix(item, "[ ] ") || strings.HasPrefix(item, "[x] ") {
+				marker = map[bool]string{true: "☑", false: "☐"}[item[1] == 'x']
+				item = item[4:]
+			}
+			prefix := indent + marker + " "
+			hanging := strings.Repeat(" ", displayWidth(prefix))
+			for j, l := range wrapStyled(renderInline(item), width-displayWidth(prefix)) {
+				if j == 0 {
+					out.WriteString(indent + ansiYellow + marker + ansiReset + " " + l + "\n")
+				} else {
+					out.WriteString(hanging + l + "\n")
+				}
+			}
+
+		default:
+			paragraph = append(paragraph, trimmed)
+		}
+	}
+	flushParagraph()
+
+	return strings.TrimRight(out.String(), "\n") + "\n"
+}
+
+// renderInline は、強調、インラインコード、リンクをANSIエスケープシーケンスに変換します
+func renderInline(text string) string {
+	// インラインコードの中身は他の書式の対象外にするため、一旦プレースホルダーに置き換える
+	var codes []string
+	text = inlineCodePattern.ReplaceAllStringFunc(text, func(s string) string {
+		codes = append(codes, ansiYellow+inlineCodePattern.FindStringSubmatch(s)[1]+ansiReset)
+		return fmt.Sprintf("\x00%d\x00", len(codes)-1)
+	})
+
+	text = linkPattern.ReplaceAllString(text, ansiUnderline+ansiBlue+"$1"+ansiReset+ansiGray+" ($2)"+ansiReset)
+	text = boldPattern.ReplaceAllString(text, ansiBold+"$1$2"+ansiReset)
+	text = italicPattern.ReplaceAllString(text, "$1$3"+ansiItalic+"$2$4"+ansiReset)
+
+	return placeholderPattern.ReplaceAllStringFunc(text, func(s string) string {
+		var index int
+		fmt.Sscanf(placeholderPattern.FindStringSubmatch(s)[1], "%d", &index)
+		return codes[index]
+	})
+}
+
+// wrapStyled は、ANSIエスケープシーケンスを含む文字列を表示幅 width で折り返します。
+// 英単語は空白の位置で、全角文字は任意の位置で折り返します。
+func wrapStyled(text string, width int) []string {
+	var lines []string
+	var line, word strings.Builder
+	lineWidth, wordWidth := 0, 0
+
+	flushWord := func() {
+		if word.Len() == 0 {
+			return
+		}
+		if lineWidth > 0 && lineWidth+wordWidth > width {
+			lines = append(lines, strings.TrimRight(line.String(), " "))
+			line.Reset()
+			lineWidth = 0
+		}
+		line.WriteString(word.String())
+		lineWidth += wordWidth
+		word.Reset()
+		wordWidth = 0
+	}
+
+	for i := 0; i < len(text); {
+		if text[i] == '\x1b' {
+			if loc := ansiSequence.FindStringIndex(text[i:]); loc != nil && loc[0] == 0 {
+				word.WriteString(text[i : i+loc[1]])
+				i += loc[1]
+				continue
+			}
+		}
+		r, size := utf8.DecodeRuneInString(text[i:])
+		i += size
+
+		switch {
+		case r == ' ':
+			flushWord()
+			if lineWidth > 0 && lineWidth < width {
+				line.WriteRune(' ')
+				lineWidth++
+			}
+		case runeWidth(r) == 2 || unicode.Is(unicode.Han, r):
+			flushWord()
+			word.WriteRune(r)
+			wordWidth = runeWidth(r)
+			flushWord()
+		default:
+			word.WriteRune(r)
+			wordWidth += runeWidth(r)
+		}
+	}
+	flushWord()
+	lines = append(lines, strings.TrimRight(line.String(), " "))
+	return lines
+}
+
+// visibleWidth はANSIエスケープシーケンスを除いた表示幅を返します
+func visibleWidth(s string) int {
+	return displayWidth(ansiSequence.ReplaceAllString(s, ""))
+}
+
+// splitTableRow は表の行をセルに分割します
+func splitTableRow(line string) []string {
+	line = strings.TrimSpace(line)
+	line = strings.TrimPrefix(line, "|")
+	line = strings.TrimSuffix(line, "|")
+	cells := strings.Split(line, "|")
+	for i := range cells {
+		cells[i] = renderInline(strings.TrimSpace(cells[i]))
+	}
+	return cells
+}
+
+// renderTable は表を罫線付きで列をそろえて表示します
+func renderTable(rows [][]string) string {
+	columns := 0
+	for _, row := range rows {
+		if len(row) > columns {
+			columns = len(row)
+		}
+	}
+	widths := make([]int, columns)
+	for _, row := range rows {
+		for i, cell := range row {
+			if w := visibleWidth(cell); w > widths[i] {
+				widths[i] = w
+			}
+		}
+	}
+
+	var sb strings.Builder
+	for r, row := range rows {
+		for i := 0; i < columns; i++ {
+			cell := ""
+			if i < len(row) {
+				cell = row[i]
+			}
+			if r == 0 {
+				cell = ansiBold + cell + ansiReset
+			}
+			sb.WriteString(cell + strings.Repeat(" ", widths[i]-visibleWidth(cell)))
+			if i < columns-1 {
+				sb.WriteString(ansiGray + " │ " + ansiReset)
+			}
+		}
+		sb.WriteString("\n")
+		if r == 0 {
+			for i, w := range widths {
+				sb.WriteString(ansiGray + strings.Repeat("─", w))
+				if i < columns-1 {
+					sb.WriteString("─┼─")
+				}
+			}
+			sb.WriteString(ansiReset + "\n")
+		}
+	}
+	return sb.String()
+}
+
+// renderCodeBlock はコードブロックを言語名の見出しとインデント付きで、構文ハイライトして表示します
+func renderCodeBlock(code []string, lang string) string {
+	var sb strings.Builder
+	if lang != "" {
+		sb.WriteString(ansiGray + "  ┌ " + lang + ansiReset + "\n")
+	}
+	for _, line := range code {
+		sb.WriteString(ansiGray + "  │ " + ansiReset + highlightCode(line, lang) + "\n")
+	}
+	return sb.String()
+}
+
+// codeKeywords は構文ハイライトで強調するキーワードです
+var codeKeywords = map[string][]string{
+	"go":     {"break", "case", "chan", "const", "continue", "default", "defer", "else", "fallthrough", "for", "func", "go", "goto", "if", "import", "interface", "map", "package", "range", "return", "select", "struct", "switch", "type", "var", "nil", "true", "false"},
+	"python": {"and", "as", "assert", "async", "await", "break", "class", "continue", "def", "del", "elif", "else", "except", "finally", "for", "from", "global", "if", "import", "in", "is", "lambda", "not", "or", "pass", "raise", "return", "try", "while", "with", "yield", "None", "True", "False"},
+	"js":     {"async", "await", "break", "case", "catch", "class", "const", "continue", "default", "delete", "else", "export", "extends", "finally", "for", "function", "if", "import", "in", "instanceof", "let", "new", "of", "return", "switch", "this", "throw", "try", "typeof", "var", "while", "null", "undefined", "true", "false", "interface", "type"},
+	"sh":     {"if", "then", "else", "elif", "fi", "for", "while", "do", "done", "case", "esac", "function", "in", "export", "local", "return"},
+	"rust":   {"as", "break", "const", "continue", "crate", "else", "enum", "fn", "for", "if", "impl", "in", "let", "loop", "match", "mod", "move", "mut", "pub", "ref", "return", "self", "Self", "static", "struct", "trait", "true", "false", "type", "use", "where", "while"},
+}
+
+// codeLanguageAliases はコードブロックの言語名の別名です
+var codeLanguageAliases = map[string]string{
+	"golang": "go", "py": "python", "javascript": "js", "ts": "js", "typescript": "js", "jsx": "js", "tsx": "js",
+	"bash": "sh", "shell": "sh", "zsh": "sh", "console": "sh", "rs": "rust",
+}
+
+// コードのトークンの種類
+const (
+	codeTokenPlain   = iota
+	codeTokenComment // コメント
+	codeTokenString  // 文字列
+	codeTokenNumber  // 数値
+	codeTokenKeyword // キーワード
+)
+
+// codeToken は構文ハイライトのために分割したコードの一部です
+type codeToken struct {
+	Kind int
+	Text string
+}
+
+// highlightCode は1行のコードに、コメント・文字列・数値・キーワードの色を付けます
+func highlightCode(line, lang string) string {
+	var sb strings.Builder
+	for _, token := range tokenizeCode(line, lang) {
+		switch token.Kind {
+		case codeTokenComment:
+			sb.WriteString(ansiGray + token.Text + ansiReset)
+		case codeTokenString:
+			sb.WriteString(ansiGreen + token.Text + ansiReset)
+		case codeTokenNumber:
+			sb.WriteString(ansiMagenta + token.Text + ansiReset)
+		case codeTokenKeyword:
+			sb.WriteString(ansiBlue + token.Text + ansiReset)
+		default:
+			sb.WriteString(token.Text)
+		}
+	}
+	return sb.String()
+}
+
+// tokenizeCode は1行のコードを、コメント・文字列・数値・キーワードとそれ以外の部分に分割します
+func tokenizeCode(line, lang string) []codeToken {
+	lang = strings.ToLower(lang)
+	if alias, ok := codeLanguageAliases[lang]; ok {
+		lang = alias
+	}
+	keywords := make(map[string]bool)
+	for _, keyword := range codeKeywords[lang] {
+		keywords[keyword] = true
+	}
+	lineComment := "//"
+	switch lang {
+	case "python", "sh", "yaml", "yml", "toml", "ruby", "rb":
+		lineComment = "#"
+	case "sql", "lua":
+		lineComment = "--"
+	}
+
+	var tokens []codeToken
+	add := func(kind int, text string) {
+		if n := len(tokens); n > 0 && kind == codeTokenPlain && tokens[n-1].Kind == codeTokenPlain {
+			tokens[n-1].Text += text
+			return
+		}
+		tokens = append(tokens, codeToken{kind, text})
+	}
+
+	runes := []rune(line)
+	for i := 0; i < len(runes); {
+		r := runes[i]
+		switch {
+		case strings.HasPrefix(string(runes[i:]), lineComment) && lang != "":
+			add(codeTokenComment, string(runes[i:]))
+			return tokens
+		case r == '"' || r == '\'' || r == '`':
+			j := i + 1
+			for j < len(runes) && runes[j] != r {
+				if runes[j] == '\\' {
+					j++
+				}
+				j++
+			}
+			if j >= len(runes) {
+				j = len(runes) - 1
+			}
+			add(codeTokenString, string(runes[i:j+1]))
+			i = j + 1
+		case unicode.IsDigit(r) && (i == 0 || !isIdentRune(runes[i-1])):
+			j := i
+			for j < len(runes) && (isIdentRune(runes[j]) || runes[j] == '.') {
+				j++
+			}
+			add(codeTokenNumber, string(runes[i:j]))
+			i = j
+		case isIdentRune(r):
+			j := i
+			for j < len(runes) && isIdentRune(runes[j]) {
+				j++
+			}
+			word := string(runes[i:j])
+			if keywords[word] {
+				add(codeTokenKeyword, word)
+			} else {
+				add(codeTokenPlain, word)
+			}
+			i = j
+		default:
+			add(codeTokenPlain, string(r))
+			i++
+		}
+	}
+	return tokens
+}
+
+// isIdentRune は識別子に使用できる文字かどうかを返します
+func isIdentRune(r rune) bool {
+	return r == '_' || unicode.IsLetter(r) || unicode.IsDigit(r)
+}
@@ -0,0 +1,61 @@
+package main
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestRenderMarkdown(t *testing.T) {
+	input := "# 見出し\n\n" +
+		"これは **太字** と `code` と [リンク](https://example.com) を含む段落です。\n\n" +
+		"- 項目1\n" +
+		"- [x] 完了した項目\n" +
+		"1. 番号付き\n\n" +
+		"| 名前 | 値 |\n" +
+		"| --- | --- |\n" +
+		"| あ | 1 |\n" +
+		"| long name | 2 |\n\n" +
+		"```go\n" +
+		"func main() { // コメント\n" +
+		"```\n" +
+		"> 引用文\n"
+
+	rendered := RenderMarkdown(input, 80)
+	plain := ansiSequence.ReplaceAllString(rendered, "")
+
+	for _, want := range []string{
+		"見出し\n",
+		"これは 太字 と code と リンク (https://example.com) を含む段落です。",
+		"• 項目1",
+		"☑ 完了した項目",
+		"1. 番号付き",
+		"名前      │ 値",
+		"あ        │ 1",
+		"  ┌ go",
+		"  │ func main() { // コメント",
+		"│ 引用文",
+	} {
+		if !strings.Contains(plain, want) {
+			t.Errorf("整形結果に %q が含まれていません:\n%s", want, plain)
+		}
+	}
+	if strings.Contains(plain, "**") || strings.Contains(plain, "```") {
+		t.Errorf("Markdownの記号が残っています:\n%s", plain)
+	}
+	if !strings.Contains(rendered, ansiBlue+"func"+ansiReset) {
+		t.Errorf("コードブロックのキーワードがハイライトされていません: %q", rendered)
+	}
+}
+
+func TestWrapStyled(t *testing.T) {
+	text := renderInline("The **quick** brown fox jumps over the lazy dog とても長い日本語の文章です")
+	for _, line := range wrapStyled(text, 12) {
+		if w := visibleWidth(line); w > 12 {
+			t.Errorf("行の表示幅 %d が12を超えています: %q", w, line)
+		}
+	}
+	lines := wrapStyled("hello world", 5)
+	if len(lines) != 2 || lines[0] != "hello" || lines[1] != "world" {
+		t.Errorf("単語の位置で折り返されていません: %q", lines)
+	}
+}
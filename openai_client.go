@@ -2,9 +2,12 @@ package main
 
 import (
 	"context"
+	"encoding/json"
 	"fmt"
+	"math"
 	"net/http"
 	"os"
+	"strings"
 	"time"
 
 	openai "github.com/sashabaranov/go-openai"
@@ -15,10 +18,30 @@ const defaultModel = "gpt-3.5-turbo"
 
 // NewOpenAIClient はOpenAI APIキーとタイムアウトを使用して新しいクライアントを初期化します
 func NewOpenAIClient(timeout int) (*openai.Client, error) {
-	apiKey := os.Getenv("OPENAI_API_KEY")
-	if apiKey == "" {
+	return NewOpenAIClientWithConfig(Config{}, "", timeout)
+}
+
+// NewOpenAIClientWithConfig は設定ファイルの接続先の設定を使用して新しいクライアントを初期化します。
+// provider を指定した場合は providers の設定を、指定しない場合は api の設定を使用します。
+// apiKey、baseURL、orgID が指定されていない場合は、
+// 環境変数 OPENAI_API_KEY、OPENAI_BASE_URL、OPENAI_ORG_ID を使用します。
+func NewOpenAIClientWithConfig(config Config, provider string, timeout int) (*openai.Client, error) {
+	apiConfig := config.API
+	if provider != "" {
+		var ok bool
+		apiConfig, ok = config.Providers[provider]
+		if !ok {
+			return nil, fmt.Errorf("プロバイダー %s は設定ファイルに定義されていません", provider)
+		}
+	}
+	api, err := resolveAPIConfig(config, apiConfig)
+	if err != nil {
+		return nil, err
+	}
+	if api.APIKey == "" {
 		return nil, fmt.Errorf("OpenAI APIキーが設定されていません")
 	}
+	logger.Debug("API設定: %+v", api.Masked())
 
 	// HTTPクライアントの設定（タイムアウト付き）
 	httpClient := &http.Client{
@@ -26,45 +49,210 @@ func NewOpenAIClient(timeout int) (*openai.Client, error) {
 	}
 
 	// OpenAIクライアントの初期化
-	openaiConfig := openai.DefaultConfig(apiKey)
+	openaiConfig := openai.DefaultConfig(api.APIKey)
 	openaiConfig.HTTPClient = httpClient
+	if api.BaseURL != "" {
+		openaiConfig.BaseURL = api.BaseURL
+	}
+	openaiConfig.OrgID = api.OrgID
 	client := openai.NewClientWithConfig(openaiConfig)
 
 	return client, nil
 }
 
-// ExecuteChatCompletion はOpenAI APIにリクエストを送り、アシスタントの応答を取得します
-func ExecuteChatCompletion(client *openai.Client, model string, maxTokens *int, conversationHistory []openai.ChatCompletionMessage) (openai.ChatCompletionMessage, error) {
-	ctx := context.Background()
+// resolveAPIConfig は接続先の各値のシークレットの参照を解決し、未指定の値を環境変数で補います
+func resolveAPIConfig(config Config, api APIConfig) (APIConfig, error) {
+	values := []struct {
+		field *string
+		env   string
+	}{
+		{&api.APIKey, "OPENAI_API_KEY"},
+		{&api.BaseURL, "OPENAI_BASE_URL"},
+		{&api.OrgID, "OPENAI_ORG_ID"},
+	}
+	for _, v := range values {
+		resolved, err := ResolveSecretReferences(config, *v.field)
+		if err != nil {
+			return api, err
+		}
+		if resolved == "" {
+			resolved = os.Getenv(v.env)
+		}
+		*v.field = resolved
+	}
+	return api, nil
+}
 
-	// // MaxTokensをポインタ型に変更
-	// var maxTokensPtr *int
-	// if max_tokens > 0 {
-	// 	maxTokensPtr = &max_tokens
-	// }
+// usesCustomEndpoint は、provider または api の接続先が OpenAI の API 以外（baseURL や OPENAI_BASE_URL を指定）かどうかを返します
+func usesCustomEndpoint(config Config, provider string) bool {
+	if provider != "" {
+		return true
+	}
+	api, err := resolveAPIConfig(config, APIConfig{BaseURL: config.API.BaseURL})
+	if err != nil {
+		return true
+	}
+	return api.BaseURL != "" && strings.TrimSuffix(api.BaseURL, "/") != "https://api.openai.com/v1"
+}
+
+// ChatCompletionClient は ChatCompletion のリクエストを送信するクライアントです（*openai.Client が実装します）
+type ChatCompletionClient interface {
+	CreateChatCompletion(ctx context.Context, request openai.ChatCompletionRequest) (openai.ChatCompletionResponse, error)
+}
+
+// reasoningModelPrefixes は max_tokens やサンプリングのパラメータを受け付けない推論モデルの接頭辞です
+var reasoningModelPrefixes = []string{"o1", "o3", "o4", "gpt-5"}
+
+// isReasoningModel はモデルが推論モデルかどうかを返します
+func isReasoningModel(model string) bool {
+	for _, prefix := range reasoningModelPrefixes {
+		if strings.HasPrefix(model, prefix) {
+			return true
+		}
+	}
+	return false
+}
+
+// explicitFloat は、明示的に指定された値を送信する値に変換します。
+// go-openai の float32 のパラメータは omitempty のため 0 を送信できないので、
+// 0 は go-openai の説明にあるとおり math.SmallestNonzeroFloat32 にして送信します。
+func explicitFloat(v float32) float32 {
+	if v == 0 {
+		return math.SmallestNonzeroFloat32
+	}
+	return v
+}
 
-	// ChatCompletionRequest の作成
+// BuildChatCompletionRequest はプロンプトの設定から ChatCompletionRequest を作成します。
+// 推論モデルの場合は max_tokens の代わりに max_completion_tokens を使用し、
+// 推論モデルが受け付けないサンプリングのパラメータは警告を出して送信しません。
+func BuildChatCompletionRequest(promptConfig Prompt, conversationHistory []openai.ChatCompletionMessage) openai.ChatCompletionRequest {
 	chatRequest := openai.ChatCompletionRequest{
-		Model:    model,
-		Messages: conversationHistory,
+		Model:     promptConfig.Model,
+		Messages:  conversationHistory,
+		Stop:      promptConfig.Stop,
+		Seed:      promptConfig.Seed,
+		LogitBias: promptConfig.LogitBias,
+		N:         promptConfig.N,
 	}
 
-	// MaxTokensが存在する場合に設定
-	// if maxTokensPtr != nil {
-	// 	chatRequest.MaxTokens = *maxTokensPtr
-	// }
-	if maxTokens != nil {
-		chatRequest.MaxTokens = *maxTokens
+	// 指定されているパラメータのみ設定
+	if promptConfig.MaxTokens != nil {
+		chatRequest.MaxTokens = *promptConfig.MaxTokens
+	}
+	if promptConfig.Temperature != nil {
+		chatRequest.Temperature = explicitFloat(*promptConfig.Temperature)
+	}
+	if promptConfig.TopP != nil {
+		chatRequest.TopP = explicitFloat(*promptConfig.TopP)
 	}
+	if promptConfig.PresencePenalty != nil {
+		chatRequest.PresencePenalty = explicitFloat(*promptConfig.PresencePenalty)
+	}
+	if promptConfig.FrequencyPenalty != nil {
+		chatRequest.FrequencyPenalty = explicitFloat(*promptConfig.FrequencyPenalty)
+	}
+
+	// 構造化出力
+	switch {
+	case promptConfig.responseSchema != nil:
+		chatRequest.ResponseFormat = &openai.ChatCompletionResponseFormat{
+			Type: openai.ChatCompletionResponseFormatTypeJSONSchema,
+			JSONSchema: &openai.ChatCompletionResponseFormatJSONSchema{
+				Name:   promptConfig.responseSchema.Name,
+				Schema: promptConfig.responseSchema,
+				Strict: true,
+			},
+		}
+	case promptConfig.JSON:
+		chatRequest.ResponseFormat = &openai.ChatCompletionResponseFormat{
+			Type: openai.ChatCompletionResponseFormatTypeJSONObject,
+		}
+	}
+
+	if !isReasoningModel(promptConfig.Model) {
+		if promptConfig.ReasoningEffort != "" {
+			logger.Info("%s は推論モデルではないため、reasoningEffort は送信しません", promptConfig.Model)
+		}
+		return chatRequest
+	}
+
+	// 推論モデル向けの調整
+	chatRequest.ReasoningEffort = promptConfig.ReasoningEffort
+	chatRequest.MaxCompletionTokens = chatRequest.MaxTokens
+	chatRequest.MaxTokens = 0
+	var ignored []string
+	if chatRequest.Temperature != 0 && chatRequest.Temperature != 1 {
+		ignored = append(ignored, "temperature")
+		chatRequest.Temperature = 0
+	}
+	if chatRequest.TopP != 0 && chatRequest.TopP != 1 {
+		ignored = append(ignored, "topP")
+		chatRequest.TopP = 0
+	}
+	if chatRequest.N > 1 {
+		ignored = append(ignored, "n")
+		chatRequest.N = 0
+	}
+	if chatRequest.PresencePenalty != 0 {
+		ignored = append(ignored, "presencePenalty")
+		chatRequest.PresencePenalty = 0
+	}
+	if chatRequest.FrequencyPenalty != 0 {
+		ignored = append(ignored, "frequencyPenalty")
+		chatRequest.FrequencyPenalty = 0
+	}
+	if len(ignored) > 0 {
+		logger.Info("推論モデル %s では %s を指定できないため、送信しません", promptConfig.Model, strings.Join(ignored, ", "))
+	}
+	return chatRequest
+}
+
+// RequestChatCompletion はOpenAI APIにリクエストを送り、すべての候補を含む応答を返します。
+// max_tokens を受け付けないモデルでエラーになった場合は、max_completion_tokens に置き換えて再送します。
+func RequestChatCompletion(client ChatCompletionClient, promptConfig Prompt, conversationHistory []openai.ChatCompletionMessage) (openai.ChatCompletionResponse, error) {
+	ctx := context.Background()
+	chatRequest := BuildChatCompletionRequest(promptConfig, conversationHistory)
 
 	resp, err := client.CreateChatCompletion(ctx, chatRequest)
+	if err != nil && chatRequest.MaxTokens > 0 && strings.Contains(err.Error(), "max_completion_tokens") {
+		logger.Debug("max_tokens が使用できないため、max_completion_tokens で再送します: %v", err)
+		chatRequest.MaxCompletionTokens = chatRequest.MaxTokens
+		chatRequest.MaxTokens = 0
+		resp, err = client.CreateChatCompletion(ctx, chatRequest)
+	}
 	if err != nil {
-		return openai.ChatCompletionMessage{}, fmt.Errorf("ChatCompletionエラー: %w", err)
+		return resp, fmt.Errorf("ChatCompletionエラー: %w", err)
 	}
 
 	if len(resp.Choices) == 0 {
-		return openai.ChatCompletionMessage{}, fmt.Errorf("ChatCompletionエラー: 返されたChoicesが空です")
+		return resp, fmt.Errorf("ChatCompletionエラー: 返されたChoicesが空です")
+	}
+	return resp, nil
+}
+
+// ExecuteChatCompletion はOpenAI APIにリクエストを送り、アシスタントの応答を取得します。
+// モデルとパラメータはプロンプトの設定（プロファイルやコマンドライン引数を反映したもの）を使用します。
+// n で複数の候補を要求した場合は最初の候補を返します。
+func ExecuteChatCompletion(client ChatCompletionClient, promptConfig Prompt, conversationHistory []openai.ChatCompletionMessage) (openai.ChatCompletionMessage, error) {
+	resp, err := RequestChatCompletion(client, promptConfig, conversationHistory)
+	if err != nil {
+		return openai.ChatCompletionMessage{}, err
+	}
+	return resp.Choices[0].Message, nil
+}
+
+// ValidateStructuredResponse は、JSONモードまたはスキーマを指定した場合に応答がJSONとして正しいかを検証します
+func ValidateStructuredResponse(promptConfig Prompt, content string) error {
+	switch {
+	case promptConfig.responseSchema != nil:
+		if err := promptConfig.responseSchema.Validate(content); err != nil {
+			return fmt.Errorf("応答がスキーマ %s に一致しません: %w", promptConfig.responseSchema.Name, err)
+		}
+	case promptConfig.JSON:
+		if !json.Valid([]byte(content)) {
+			return fmt.Errorf("応答が正しいJSONではありません")
+		}
 	}
-	assistantMessage := resp.Choices[0].Message
-	return assistantMessage, nil
+	return nil
 }
@@ -2,6 +2,7 @@ package main
 
 import (
 	"context"
+	"encoding/json"
 	"os"
 	"testing"
 
@@ -41,6 +42,7 @@ func (m *TestMockOpenAIClient) DeleteFile(ctx context.Context, fileID string) er
 }
 
 func TestNewOpenAIClient(t *testing.T) {
+	logger = NewConsoleLogger(false)
 	os.Setenv("OPENAI_API_KEY", "dummy_key")
 
 	client, err := NewOpenAIClient(30)
@@ -75,3 +77,67 @@ func TestUploadFile(t *testing.T) {
 		t.Errorf("期待されるFile IDは 'mock-file-id' ですが、実際は '%s' です", uploadedFile.ID)
 	}
 }
+
+func TestBuildChatCompletionRequest(t *testing.T) {
+	logger = NewConsoleLogger(false)
+	maxTokens := 500
+	temperature := float32(0.3)
+	penalty := float32(0.5)
+	seed := 42
+	promptConfig := Prompt{
+		Model:            "gpt-4o",
+		MaxTokens:        &maxTokens,
+		Temperature:      &temperature,
+		PresencePenalty:  &penalty,
+		Stop:             []string{"END"},
+		Seed:             &seed,
+		LogitBias:        map[string]int{"50256": -100},
+		N:                3,
+		ReasoningEffort:  "high",
+		FrequencyPenalty: &penalty,
+	}
+
+	req := BuildChatCompletionRequest(promptConfig, nil)
+	if req.MaxTokens != 500 || req.MaxCompletionTokens != 0 || req.Temperature != 0.3 || req.N != 3 ||
+		req.PresencePenalty != 0.5 || req.FrequencyPenalty != 0.5 || *req.Seed != 42 ||
+		req.Stop[0] != "END" || req.LogitBias["50256"] != -100 || req.ReasoningEffort != "" {
+		t.Errorf("通常のモデルのリクエストが正しくありません: %+v", req)
+	}
+
+	promptConfig.Model = "o3-mini"
+	req = BuildChatCompletionRequest(promptConfig, nil)
+	if req.MaxTokens != 0 || req.MaxCompletionTokens != 500 || req.ReasoningEffort != "high" {
+		t.Errorf("推論モデルで max_completion_tokens と reasoning_effort が設定されていません: %+v", req)
+	}
+	if req.Temperature != 0 || req.N != 0 || req.PresencePenalty != 0 || req.FrequencyPenalty != 0 {
+		t.Errorf("推論モデルで使用できないパラメータが送信されています: %+v", req)
+	}
+	if err := openai.NewReasoningValidator().Validate(req); err != nil {
+		t.Errorf("推論モデルのリクエストの検証に失敗しました: %v", err)
+	}
+}
+
+func TestBuildChatCompletionRequestZeroTemperature(t *testing.T) {
+	logger = NewConsoleLogger(false)
+	zero := float32(0)
+	req := BuildChatCompletionRequest(Prompt{Model: "gpt-4o", Temperature: &zero, TopP: &zero}, nil)
+
+	body, err := json.Marshal(req)
+	if err != nil {
+		t.Fatalf("json.Marshal() エラー: %v", err)
+	}
+	var sent map[string]interface{}
+	if err := json.Unmarshal(body, &sent); err != nil {
+		t.Fatalf("json.Unmarshal() エラー: %v", err)
+	}
+	for _, key := range []string{"temperature", "top_p"} {
+		if value, ok := sent[key]; !ok || value.(float64) > 1e-30 {
+			t.Errorf("明示的に指定した %s: 0 が送信されていません: %v", key, sent)
+		}
+	}
+
+	req = BuildChatCompletionRequest(Prompt{Model: "gpt-4o"}, nil)
+	if req.Temperature != 0 || req.TopP != 0 {
+		t.Errorf("指定していないパラメータが設定されています: %+v", req)
+	}
+}
@@ -55,6 +55,61 @@ type Options struct {
 	Attachments          []string
 	Tools                []string
 	Args                 []string
+	GitDiff              bool
+	GitStaged            bool
+	GitRange             string
+	GitFilesChanged      bool
+	Vars                 map[string]string
+	AllowShell           bool
+	StdinContent         string
+	StrictConfig         bool
+	Profile              string
+	Provider             string
+	TopP                 *float32
+	PresencePenalty      *float32
+	FrequencyPenalty     *float32
+	Stop                 []string
+	Seed                 *int
+	LogitBias            map[string]int
+	N                    int
+	ReasoningEffort      string
+	JSONMode             bool
+	Schema               string
+	CompareModels        string
+	CompareView          string
+	Pick                 bool
+	Raw                  bool
+	ExtractCode          bool
+	CodeBlock            int
+	WriteCode            string
+	CopyCode             bool
+	Force                bool
+	Edit                 bool
+	Yes                  bool
+	Regenerate           bool
+	AllowSecrets         bool
+	Tags                 []string
+	History              HistoryConfig
+	TitleModel           string
+	AutoHistory          bool
+	HistoryBase          HistorySnapshot
+	LogDir               string
+	ExplicitFlags        map[string]bool
+}
+
+// IsFlagSet はコマンドラインで明示的に指定されたフラグかどうかを返します
+func (o Options) IsFlagSet(name string) bool {
+	return o.ExplicitFlags[name]
+}
+
+// GitContext はgit関連のオプションをGitContextOptionsとして返します
+func (o Options) GitContext() GitContextOptions {
+	return GitContextOptions{
+		Diff:         o.GitDiff,
+		Staged:       o.GitStaged,
+		Range:        o.GitRange,
+		FilesChanged: o.GitFilesChanged,
+	}
 }
 
 // ParseCommandLineArgs はコマンドライン引数を解析します
@@ -95,8 +150,75 @@ func ParseCommandLineArgs() (Options, error) {
 	flag.Float64Var(&options.Temperature, "temperature", 0.7, "モデルの温度パラメータを指定")
 	flag.BoolVar(&options.CreateAssistant, "create-assistant", false, "新しいアシスタントを作成する")
 	flag.StringVar(&options.Message, "message", "", "アシスタントに送信するメッセージを指定")
+	flag.BoolVar(&options.GitDiff, "git-diff", false, "作業ツリーの未ステージの差分をユーザーメッセージに追加")
+	flag.BoolVar(&options.GitStaged, "git-staged", false, "ステージ済みの差分をユーザーメッセージに追加")
+	flag.StringVar(&options.GitRange, "git-range", "", "指定したコミット範囲（例: main..HEAD）の差分とコミット一覧をユーザーメッセージに追加")
+	flag.BoolVar(&options.GitFilesChanged, "git-files-changed", false, "変更されたファイルの全内容をユーザーメッセージに追加")
 	// flag.IntVar(&options.MaxTokens, "max-tokens", 16384, "Max tokens to generate in the completion")
 
+	flag.BoolVar(&options.StrictConfig, "strict-config", envBool("GPT_CLI_STRICT_CONFIG"), "設定ファイルの読み込みや解析に失敗した場合にエラーで終了する（環境変数 GPT_CLI_STRICT_CONFIG でも指定可）")
+	flag.StringVar(&options.Profile, "profile", os.Getenv("GPT_CLI_PROFILE"), "config.yamlにあるプロファイルを選択（環境変数 GPT_CLI_PROFILE でも指定可）")
+	flag.StringVar(&options.Provider, "provider", "", "config.yamlの providers にある接続先を選択")
+	flag.Func("top-p", "モデルの top_p パラメータを指定", float32Flag(&options.TopP))
+	flag.Func("presence-penalty", "presence_penalty パラメータを指定（-2.0〜2.0）", float32Flag(&options.PresencePenalty))
+	flag.Func("frequency-penalty", "frequency_penalty パラメータを指定（-2.0〜2.0）", float32Flag(&options.FrequencyPenalty))
+	flag.Func("stop", "生成を停止する文字列を指定（複数指定可）", func(s string) error {
+		options.Stop = append(options.Stop, s)
+		return nil
+	})
+	flag.Func("seed", "再現性のためのシード値を指定", func(s string) error {
+		value, err := strconv.Atoi(s)
+		if err != nil {
+			return err
+		}
+		options.Seed = &value
+		return nil
+	})
+	flag.Func("logit-bias", "トークンIDとバイアスを token=bias の形式で指定（複数指定可）", func(s string) error {
+		token, bias, err := ParseLogitBias(s)
+		if err != nil {
+			return err
+		}
+		if options.LogitBias == nil {
+			options.LogitBias = make(map[string]int)
+		}
+		options.LogitBias[token] = bias
+		return nil
+	})
+	flag.IntVar(&options.N, "n", 0, "生成する候補の数を指定")
+	flag.BoolVar(&options.JSONMode, "json", false, "JSONモードで応答を要求")
+	flag.StringVar(&options.Schema, "schema", "", "構造化出力に使用するJSONスキーマのファイルを指定（応答はスキーマで検証されます）")
+	flag.StringVar(&options.CompareModels, "compare", "", "回答を比較するモデルをカンマ区切りで指定（1つの場合は -n のサンプル数を比較）")
+	flag.StringVar(&options.CompareView, "compare-view", CompareViewSections, "比較結果の表示形式を指定（sections, side-by-side, diff）")
+	flag.BoolVar(&options.Pick, "pick", false, "比較した回答から1つを選んで会話履歴に追加")
+	flag.BoolVar(&options.Raw, "raw", false, "応答をMarkdownとして整形せずにそのまま表示")
+	flag.BoolVar(&options.ExtractCode, "extract-code", false, "応答のコードブロックの中身だけを表示")
+	flag.IntVar(&options.CodeBlock, "code-block", 0, "N番目のコードブロックだけを対象にする（1から数える）")
+	flag.StringVar(&options.WriteCode, "write-code", "", "応答のコードブロックを指定したディレクトリのファイルに書き込む")
+	flag.BoolVar(&options.CopyCode, "copy-code", false, "応答のコードブロックをクリップボードにコピー")
+	flag.BoolVar(&options.Force, "force", false, "-write-code で既存のファイルを上書きする")
+	flag.BoolVar(&options.Edit, "edit", false, "-f で指定したファイルの変更を応答から取り出し、差分を確認してファイルに適用")
+	flag.BoolVar(&options.Yes, "y", false, "-edit で確認せずに変更を適用")
+	flag.BoolVar(&options.Regenerate, "regenerate", false, "-history の最後の応答を削除し、最後の質問をもう一度送って応答を生成し直す")
+	flag.BoolVar(&options.AllowSecrets, "allow-secrets", false, "機密情報と思われる文字列を伏せ字にせずにそのまま送信")
+	flag.Func("tags", "会話履歴に付けるタグをカンマ区切りで指定", func(s string) error {
+		options.Tags = append(options.Tags, SplitPatternList(s)...)
+		return nil
+	})
+	flag.StringVar(&options.ReasoningEffort, "reasoning-effort", "", "推論モデルの推論の度合いを指定（low, medium, high）")
+	flag.BoolVar(&options.AllowShell, "allow-shell", false, "プロンプトのテンプレートで shell 関数の使用を許可")
+	flag.Func("var", "プロンプトのテンプレート変数を key=value の形式で指定（複数指定可）", func(s string) error {
+		key, value, err := ParseTemplateVar(s)
+		if err != nil {
+			return err
+		}
+		if options.Vars == nil {
+			options.Vars = make(map[string]string)
+		}
+		options.Vars[key] = value
+		return nil
+	})
+
 	// MaxTokensのフラグを設定
 	options.MaxTokens = nil
 	flag.Func("max-tokens", "Max tokens to generate in the completion", func(s string) error {
@@ -112,35 +234,19 @@ func ParseCommandLineArgs() (Options, error) {
 
 	options.Args = flag.Args()
 
-	// ファイルパスのセットを保持
-	fileSet := make(map[string]struct{})
+	// 明示的に指定されたフラグを記録（プロファイルやプロンプトの値より優先するため）
+	options.ExplicitFlags = make(map[string]bool)
+	flag.Visit(func(f *flag.Flag) {
+		options.ExplicitFlags[f.Name] = true
+	})
 
 	// アップロードするファイルのリストをパース
 	if options.UploadAndAddFilesStr != "" {
-		patterns := strings.Split(options.UploadAndAddFilesStr, ",")
-		for _, pattern := range patterns {
-			pattern = strings.TrimSpace(pattern)
-			var matches []string
-			var err error
-
-			if strings.Contains(pattern, "**") {
-				matches, err = RecursiveGlob(pattern)
-			} else {
-				matches, err = filepath.Glob(pattern)
-			}
-
-			if err != nil {
-				return options, fmt.Errorf("パターンの展開に失敗しました (%s): %w", pattern, err)
-			}
-
-			for _, match := range matches {
-				if _, exists := fileSet[match]; !exists {
-					fileSet[match] = struct{}{}
-					options.UploadAndAddFiles = append(options.UploadAndAddFiles, match)
-				}
-			}
-
+		files, err := ExpandFileList(options.UploadAndAddFilesStr)
+		if err != nil {
+			return options, err
 		}
+		options.UploadAndAddFiles = files
 	}
 
 	// if options.UploadAndAddFilesStr != "" {
@@ -166,6 +272,56 @@ func ParseCommandLineArgs() (Options, error) {
 	return options, nil
 }
 
+// CodeOutputRequested は、応答全体ではなくコードブロックを出力するオプションが指定されているかを返します
+func (o Options) CodeOutputRequested() bool {
+	return o.ExtractCode || o.CodeBlock > 0 || o.WriteCode != "" || o.CopyCode
+}
+
+// RenderMarkdownOutput は、応答をMarkdownとして整形して表示するかを返します。
+// -raw を指定した場合、標準出力が端末でない場合（パイプやリダイレクト）、構造化出力の場合は整形しません。
+func (o Options) RenderMarkdownOutput(promptConfig Prompt) bool {
+	return !o.Raw && !promptConfig.JSON && promptConfig.Schema == "" && useColor(os.Stdout)
+}
+
+// float32Flag は float32 のポインタに値を設定する flag.Func 用の関数を返します
+func float32Flag(dst **float32) func(string) error {
+	return func(s string) error {
+		value, err := strconv.ParseFloat(s, 32)
+		if err != nil {
+			return err
+		}
+		v := float32(value)
+		*dst = &v
+		return nil
+	}
+}
+
+// ParseLogitBias は token=bias 形式の文字列をトークンIDとバイアスに分割します
+func ParseLogitBias(s string) (string, int, error) {
+	token, biasStr, ok := strings.Cut(s, "=")
+	token = strings.TrimSpace(token)
+	if !ok || token == "" {
+		return "", 0, fmt.Errorf("logit-bias は token=bias の形式で指定してください: %s", s)
+	}
+	if _, err := strconv.Atoi(token); err != nil {
+		return "", 0, fmt.Errorf("logit-bias のトークンはトークンIDで指定してください: %s", token)
+	}
+	bias, err := strconv.Atoi(strings.TrimSpace(biasStr))
+	if err != nil || bias < -100 || bias > 100 {
+		return "", 0, fmt.Errorf("logit-bias のバイアスは -100〜100 の整数で指定してください: %s", biasStr)
+	}
+	return token, bias, nil
+}
+
+// envBool は環境変数が真を表す値（1, true, yes）に設定されているかを返します
+func envBool(name string) bool {
+	switch strings.ToLower(os.Getenv(name)) {
+	case "1", "true", "yes":
+		return true
+	}
+	return false
+}
+
 // SetupLogging はロギングの設定を行います
 func SetupLogging(debug bool) {
 	if debug {
@@ -191,6 +347,7 @@ func BuildUserMessage(options *Options) error {
 			return fmt.Errorf("標準入力の読み込みに失敗しました: %w", err)
 		}
 		trimmedInput := strings.TrimSpace(string(inputData))
+		options.StdinContent = trimmedInput
 		if trimmedInput != "" {
 			options.UserMessage += " " + trimmedInput
 		}
@@ -214,7 +371,10 @@ func ConfigureLogDirectory(options *Options, config Config) error {
 	// ログファイル名を自動生成
 	if options.HistoryFile == "" && config.AutoSaveLogs {
 		options.HistoryFile = filepath.Join(logDir, fmt.Sprintf("log_%s.json", time.Now().Format("20060102_150405.000")))
+		options.AutoHistory = true
 	}
+	options.History = config.History
+	options.LogDir = logDir
 
 	// showHistoryのフルパスをLogDirに基づいて設定
 	if options.ShowHistory != "" {
@@ -265,6 +425,50 @@ func (o Options) String() string {
 	sb.WriteString(fmt.Sprintf("	Attachments: %s\n", o.Attachments))
 	sb.WriteString(fmt.Sprintf("	Tools: %s\n", strings.Join(o.Tools, ", ")))
 	sb.WriteString(fmt.Sprintf("	Args: %s\n", strings.Join(o.Args, ", ")))
+	sb.WriteString(fmt.Sprintf("	GitDiff: %t\n", o.GitDiff))
+	sb.WriteString(fmt.Sprintf("	GitStaged: %t\n", o.GitStaged))
+	sb.WriteString(fmt.Sprintf("	GitRange: %s\n", o.GitRange))
+	sb.WriteString(fmt.Sprintf("	GitFilesChanged: %t\n", o.GitFilesChanged))
+	sb.WriteString(fmt.Sprintf("	Vars: %v\n", o.Vars))
+	sb.WriteString(fmt.Sprintf("	AllowShell: %t\n", o.AllowShell))
+	sb.WriteString(fmt.Sprintf("	StrictConfig: %t\n", o.StrictConfig))
+	sb.WriteString(fmt.Sprintf("	Profile: %s\n", o.Profile))
+	sb.WriteString(fmt.Sprintf("	Provider: %s\n", o.Provider))
+	if o.TopP != nil {
+		sb.WriteString(fmt.Sprintf("	TopP: %f\n", *o.TopP))
+	}
+	if o.PresencePenalty != nil {
+		sb.WriteString(fmt.Sprintf("	PresencePenalty: %f\n", *o.PresencePenalty))
+	}
+	if o.FrequencyPenalty != nil {
+		sb.WriteString(fmt.Sprintf("	FrequencyPenalty: %f\n", *o.FrequencyPenalty))
+	}
+	sb.WriteString(fmt.Sprintf("	Stop: %q\n", o.Stop))
+	if o.Seed != nil {
+		sb.WriteString(fmt.Sprintf("	Seed: %d\n", *o.Seed))
+	}
+	sb.WriteString(fmt.Sprintf("	LogitBias: %v\n", o.LogitBias))
+	sb.WriteString(fmt.Sprintf("	N: %d\n", o.N))
+	sb.WriteString(fmt.Sprintf("	ReasoningEffort: %s\n", o.ReasoningEffort))
+	sb.WriteString(fmt.Sprintf("	JSONMode: %t\n", o.JSONMode))
+	sb.WriteString(fmt.Sprintf("	Schema: %s\n", o.Schema))
+	sb.WriteString(fmt.Sprintf("	CompareModels: %s\n", o.CompareModels))
+	sb.WriteString(fmt.Sprintf("	CompareView: %s\n", o.CompareView))
+	sb.WriteString(fmt.Sprintf("	Pick: %t\n", o.Pick))
+	sb.WriteString(fmt.Sprintf("	Raw: %t\n", o.Raw))
+	sb.WriteString(fmt.Sprintf("	ExtractCode: %t\n", o.ExtractCode))
+	sb.WriteString(fmt.Sprintf("	CodeBlock: %d\n", o.CodeBlock))
+	sb.WriteString(fmt.Sprintf("	WriteCode: %s\n", o.WriteCode))
+	sb.WriteString(fmt.Sprintf("	CopyCode: %t\n", o.CopyCode))
+	sb.WriteString(fmt.Sprintf("	Force: %t\n", o.Force))
+	sb.WriteString(fmt.Sprintf("	Edit: %t\n", o.Edit))
+	sb.WriteString(fmt.Sprintf("	Yes: %t\n", o.Yes))
+	sb.WriteString(fmt.Sprintf("	Regenerate: %t\n", o.Regenerate))
+	sb.WriteString(fmt.Sprintf("	AllowSecrets: %t\n", o.AllowSecrets))
+	sb.WriteString(fmt.Sprintf("	Tags: %v\n", o.Tags))
+	sb.WriteString(fmt.Sprintf("	TitleModel: %s\n", o.TitleModel))
+	sb.WriteString(fmt.Sprintf("	AutoHistory: %t\n", o.AutoHistory))
+	sb.WriteString(fmt.Sprintf("	LogDir: %s\n", o.LogDir))
 	if o.MaxTokens != nil {
 		sb.WriteString(fmt.Sprintf("  MaxTokens: %d\n", *o.MaxTokens))
 	} else {
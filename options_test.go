@@ -58,3 +58,15 @@ func TestBuildUserMessageWithStdin(t *testing.T) {
 		t.Errorf("UserMessageが正しく構築されていません。Expected: '%s', got: '%s'", inputData, options.UserMessage)
 	}
 }
+
+func TestParseLogitBias(t *testing.T) {
+	token, bias, err := ParseLogitBias("50256=-100")
+	if err != nil || token != "50256" || bias != -100 {
+		t.Errorf("ParseLogitBias() = %s, %d, %v", token, bias, err)
+	}
+	for _, invalid := range []string{"50256", "word=10", "50256=101", "=1"} {
+		if _, _, err := ParseLogitBias(invalid); err == nil {
+			t.Errorf("ParseLogitBias(%q) がエラーになりませんでした", invalid)
+		}
+	}
+}
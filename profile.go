@@ -0,0 +1,59 @@
+package main
+
+import (
+	"fmt"
+)
+
+// Profile は、モデルやパラメータの組み合わせに名前を付けた設定です。
+// -profile または環境変数 GPT_CLI_PROFILE、プロンプトの profile で選択します。
+// - Provider: providers に定義した接続先の名前（省略時は api の設定）
+// - Model: 使用するAIモデル名
+// - Temperature, TopP: サンプリングのパラメータ
+// - MaxTokens: 最大トークン数
+// - Timeout: タイムアウト時間（秒）
+// - System: プロンプトに System がない場合に使用するシステムメッセージ
+type Profile struct {
+	Provider    string   `yaml:"provider,omitempty"`
+	Model       string   `yaml:"model,omitempty"`
+	Temperature *float32 `yaml:"temperature,omitempty"`
+	TopP        *float32 `yaml:"topP,omitempty"`
+	MaxTokens   *int     `yaml:"maxTokens,omitempty"`
+	Timeout     int      `yaml:"timeout,omitempty"`
+	System      string   `yaml:"system,omitempty"`
+
+	// untrusted は、信頼していないプロジェクトの設定ファイルで定義されたかどうかです
+	untrusted bool
+}
+
+// asPrompt はプロファイルをプロンプトの基本設定として返します
+func (p Profile) asPrompt() Prompt {
+	return Prompt{
+		Provider:    p.Provider,
+		Model:       p.Model,
+		Temperature: p.Temperature,
+		TopP:        p.TopP,
+		MaxTokens:   p.MaxTokens,
+		Timeout:     p.Timeout,
+		System:      p.System,
+		untrusted:   p.untrusted,
+	}
+}
+
+// applyProfile は、プロファイルの値をプロンプトで指定されていないフィールドに適用します。
+// プロファイル名は -profile（または GPT_CLI_PROFILE）を優先し、指定がなければプロンプトの profile を使用します。
+func applyProfile(config Config, promptConfig Prompt, profileName string) (Prompt, error) {
+	if profileName == "" {
+		profileName = promptConfig.Profile
+	}
+	if profileName == "" {
+		return promptConfig, nil
+	}
+
+	profile, ok := config.Profiles[profileName]
+	if !ok {
+		return promptConfig, fmt.Errorf("プロファイル %s は設定ファイルに定義されていません", profileName)
+	}
+	merged := mergePrompt(profile.asPrompt(), promptConfig)
+	merged.Profile = profileName
+	return merged, nil
+}
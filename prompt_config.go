@@ -2,6 +2,7 @@ package main
 
 import (
 	"fmt"
+	"strings"
 )
 
 const (
@@ -9,18 +10,229 @@ const (
 	DefaultVectorStoreID   = "default-vector-store-id"
 )
 
-// GetPromptConfig はプロンプトの設定を取得します
+// builtinPrompts は config.yaml に定義がなくても -p で選択できる組み込みのプロンプトです。
+// config.yaml に同名のプロンプトがある場合はそちらが優先されます。
+var builtinPrompts = map[string]Prompt{
+	"review": {
+		System: `あなたは経験豊富なソフトウェアエンジニアで、コードレビューを担当しています。
+与えられた git の差分と変更後のファイルの内容を読み、次の形式で日本語で回答してください。
+
+## 概要
+変更内容を1〜3文で要約してください。
+
+## 指摘事項
+バグ、セキュリティ上の問題、エッジケースの考慮漏れ、可読性や保守性の問題を、重要度の高い順に
+「ファイル名:行 - 内容」の形式で箇条書きにしてください。問題がない場合は「特になし」と書いてください。
+
+## コミットメッセージ案
+変更内容を表す Conventional Commits 形式のコミットメッセージ（1行目は72文字以内）を提案してください。`,
+		User: "この変更をレビューしてください。",
+		FileContext: FileContextConfig{
+			Format: FileFormatMarkdown,
+		},
+	},
+	defaultCommitMsgPrompt: {
+		System: `あなたはgitのコミットメッセージを書く専門家です。
+与えられたステージ済みの差分から、Conventional Commits 形式のコミットメッセージを1つだけ作成してください。
+
+- 1行目は「<type>(<scope>): <要約>」の形式で72文字以内にしてください。typeは feat, fix, docs, style, refactor, perf, test, build, ci, chore, revert のいずれかです。scope は省略できます。
+- 必要な場合のみ、空行を挟んで変更の理由や影響を本文として箇条書きで書いてください。
+- コミットメッセージ以外の説明やコードブロックの囲みは出力しないでください。`,
+		User: "次の変更のコミットメッセージを作成してください。",
+		FileContext: FileContextConfig{
+			Format: FileFormatMarkdown,
+		},
+	},
+}
+
+// lookupPrompt は、config.yaml または組み込みのプロンプトから名前に一致するものを返します
+func lookupPrompt(config Config, name string) (Prompt, bool) {
+	if prompt, ok := config.Prompts[name]; ok {
+		return prompt, true
+	}
+	prompt, ok := builtinPrompts[name]
+	return prompt, ok
+}
+
+// ResolvePrompt は、extends による継承と systemParts によるスニペットの連結を解決したプロンプトを返します。
+// 継承元の設定は、継承先で指定されていないフィールドにのみ適用されます。
+// 継承先と同名のプロンプトを extends に指定した場合は、組み込みのプロンプトを継承します。
+func ResolvePrompt(config Config, name string) (Prompt, error) {
+	prompt, err := resolvePromptInheritance(config, name, nil)
+	if err != nil {
+		return prompt, err
+	}
+
+	// スニペットを連結して System を組み立てる
+	if len(prompt.SystemParts) > 0 {
+		var parts []string
+		for _, partName := range prompt.SystemParts {
+			snippet, ok := config.Snippets[partName]
+			if !ok {
+				return prompt, fmt.Errorf("プロンプト %s の systemParts で指定されたスニペット %s は定義されていません", name, partName)
+			}
+			parts = append(parts, strings.TrimRight(snippet, "\n"))
+			if config.untrustedSnippets[partName] {
+				prompt.untrusted = true
+			}
+		}
+		if prompt.System != "" {
+			parts = append(parts, prompt.System)
+		}
+		prompt.System = strings.Join(parts, "\n\n")
+		prompt.SystemParts = nil
+	}
+
+	return prompt, nil
+}
+
+// resolvePromptInheritance は extends をたどって継承元の設定をマージします
+func resolvePromptInheritance(config Config, name string, visiting []string) (Prompt, error) {
+	for _, visited := range visiting {
+		if visited == name {
+			return Prompt{}, fmt.Errorf("プロンプトの継承が循環しています: %s -> %s", strings.Join(visiting, " -> "), name)
+		}
+	}
+
+	prompt, ok := lookupPrompt(config, name)
+	if !ok {
+		return prompt, fmt.Errorf("プロンプトオプション %s は設定ファイルに定義されていません", name)
+	}
+	if prompt.Extends == "" {
+		return prompt, nil
+	}
+
+	var base Prompt
+	if prompt.Extends == name {
+		base, ok = builtinPrompts[name]
+		if !ok {
+			return prompt, fmt.Errorf("プロンプト %s が自身を継承しています", name)
+		}
+	} else {
+		var err error
+		base, err = resolvePromptInheritance(config, prompt.Extends, append(visiting, name))
+		if err != nil {
+			return prompt, err
+		}
+	}
+
+	return mergePrompt(base, prompt), nil
+}
+
+// mergePrompt は、override で指定されたフィールドで base を上書きしたプロンプトを返します。
+// リストは override 側で指定されている場合（空のリストを含む）に置き換えます。
+func mergePrompt(base, override Prompt) Prompt {
+	merged := base
+	merged.Extends = ""
+
+	if override.Model != "" {
+		merged.Model = override.Model
+	}
+	if override.System != "" {
+		merged.System = override.System
+	}
+	if override.User != "" {
+		merged.User = override.User
+	}
+	if override.MaxTokens != nil {
+		merged.MaxTokens = override.MaxTokens
+	}
+	if override.Attachments != nil {
+		merged.Attachments = override.Attachments
+	}
+	if override.Tools != nil {
+		merged.Tools = override.Tools
+	}
+	if override.FileContext != (FileContextConfig{}) {
+		merged.FileContext = override.FileContext
+	}
+	if override.AllowShell != nil {
+		merged.AllowShell = override.AllowShell
+	}
+	if override.SystemParts != nil {
+		merged.SystemParts = override.SystemParts
+	}
+	if override.Profile != "" {
+		merged.Profile = override.Profile
+	}
+	if override.Provider != "" {
+		merged.Provider = override.Provider
+	}
+	if override.Temperature != nil {
+		merged.Temperature = override.Temperature
+	}
+	if override.TopP != nil {
+		merged.TopP = override.TopP
+	}
+	if override.Timeout != 0 {
+		merged.Timeout = override.Timeout
+	}
+	if override.PresencePenalty != nil {
+		merged.PresencePenalty = override.PresencePenalty
+	}
+	if override.FrequencyPenalty != nil {
+		merged.FrequencyPenalty = override.FrequencyPenalty
+	}
+	if override.Stop != nil {
+		merged.Stop = override.Stop
+	}
+	if override.Seed != nil {
+		merged.Seed = override.Seed
+	}
+	if override.LogitBias != nil {
+		merged.LogitBias = override.LogitBias
+	}
+	if override.N != 0 {
+		merged.N = override.N
+	}
+	if override.ReasoningEffort != "" {
+		merged.ReasoningEffort = override.ReasoningEffort
+	}
+	if override.JSON {
+		merged.JSON = true
+	}
+	if override.Schema != "" {
+		merged.Schema = override.Schema
+	}
+	merged.untrusted = base.untrusted || override.untrusted
+
+	return merged
+}
+
+// GetPromptConfig はプロンプトの設定を取得します。
+// モデルやパラメータは、プロファイル、プロンプト、明示的に指定したコマンドライン引数の順に優先度が高くなります。
 func GetPromptConfig(config Config, options Options) (Prompt, error) {
 	var promptConfig Prompt
+	var err error
 
 	if options.PromptOption != "" {
-		var ok bool
-		promptConfig, ok = config.Prompts[options.PromptOption]
-		if !ok {
-			return promptConfig, fmt.Errorf("プロンプトオプション %s は設定ファイルに定義されていません", options.PromptOption)
+		promptConfig, err = ResolvePrompt(config, options.PromptOption)
+		if err != nil {
+			return promptConfig, err
 		}
 	}
 
+	// プロファイルを適用（プロンプトで指定されていない値のみ）
+	promptConfig, err = applyProfile(config, promptConfig, options.Profile)
+	if err != nil {
+		return promptConfig, err
+	}
+
+	// プロンプトのテンプレートを展開
+	templateContext := &promptTemplateContext{
+		vars:       options.Vars,
+		stdin:      options.StdinContent,
+		allowShell: options.AllowShell || promptConfig.shellAllowed(),
+	}
+	promptConfig.System, err = RenderPromptTemplate(options.PromptOption+".system", promptConfig.System, templateContext)
+	if err != nil {
+		return promptConfig, err
+	}
+	promptConfig.User, err = RenderPromptTemplate(options.PromptOption+".user", promptConfig.User, templateContext)
+	if err != nil {
+		return promptConfig, err
+	}
+
 	// ベクトルストア設定を取得
 	if options.VectorStoreAction != "" {
 		if vectorStoreConfig, exist := config.VectorStores[options.VectorStoreAction]; exist {
@@ -41,29 +253,109 @@ func GetPromptConfig(config Config, options Options) (Prompt, error) {
 	if options.SystemMessage != "" {
 		promptConfig.System = options.SystemMessage
 	}
-	if options.UserMessage != "" {
-		promptConfig.User = options.UserMessage
+	userMessage := options.UserMessage
+	if templateContext.usedStdin {
+		// テンプレートで {{stdin}} を使った場合、標準入力の内容はユーザーメッセージに重ねて追加しない
+		userMessage = strings.TrimSpace(strings.TrimSuffix(userMessage, options.StdinContent))
+	}
+	if userMessage != "" {
+		promptConfig.User = userMessage
 	}
-	if options.Model != "" {
+	if options.IsFlagSet("model") {
 		promptConfig.Model = options.Model
 	}
+	if options.IsFlagSet("temperature") {
+		temperature := float32(options.Temperature)
+		promptConfig.Temperature = &temperature
+	}
+	if options.TopP != nil {
+		promptConfig.TopP = options.TopP
+	}
+	if options.PresencePenalty != nil {
+		promptConfig.PresencePenalty = options.PresencePenalty
+	}
+	if options.FrequencyPenalty != nil {
+		promptConfig.FrequencyPenalty = options.FrequencyPenalty
+	}
+	if options.Stop != nil {
+		promptConfig.Stop = options.Stop
+	}
+	if options.Seed != nil {
+		promptConfig.Seed = options.Seed
+	}
+	if options.LogitBias != nil {
+		promptConfig.LogitBias = options.LogitBias
+	}
+	if options.N != 0 {
+		promptConfig.N = options.N
+	}
+	if options.ReasoningEffort != "" {
+		promptConfig.ReasoningEffort = options.ReasoningEffort
+	}
+	if options.JSONMode {
+		promptConfig.JSON = true
+	}
+	if options.Schema != "" {
+		promptConfig.Schema = options.Schema
+	}
+	if options.IsFlagSet("t") {
+		promptConfig.Timeout = options.Timeout
+	}
+	if options.Provider != "" {
+		promptConfig.Provider = options.Provider
+	}
 	if len(options.Attachments) > 0 {
 		promptConfig.Attachments = options.Attachments
 	}
 
-	// デフォルトのモデル設定
+	// デフォルトのモデルとタイムアウトの設定
+	if promptConfig.Model == "" {
+		promptConfig.Model = options.Model
+	}
 	if promptConfig.Model == "" {
 		promptConfig.Model = defaultModel
 	}
+	if promptConfig.Timeout == 0 {
+		promptConfig.Timeout = options.Timeout
+	}
+
+	// 構造化出力のスキーマを読み込む
+	if promptConfig.Schema != "" {
+		schema, err := LoadJSONSchema(promptConfig.Schema)
+		if err != nil {
+			return promptConfig, err
+		}
+		promptConfig.responseSchema = &schema
+	}
+
+	// -edit の場合は変更の回答形式を指示し、応答に行番号が混ざらないようにする
+	if options.Edit {
+		if options.FileList == "" && !options.CollectFiles && !options.GitFilesChanged {
+			return promptConfig, fmt.Errorf("-edit には -f で変更するファイルを指定してください")
+		}
+		if options.CompareModels != "" || options.CodeOutputRequested() {
+			return promptConfig, fmt.Errorf("-edit は -compare や -extract-code などと同時に指定できません")
+		}
+		promptConfig.System = strings.TrimSpace(promptConfig.System + "\n\n" + editInstructions)
+		promptConfig.FileContext.LineNumbers = false
+	}
 
 	// 画像リストの処理
 	if options.ImageList != "" {
-		promptConfig.Attachments = SplitImageList(options.ImageList)
+		images, err := ExpandFileList(options.ImageList)
+		if err != nil {
+			return promptConfig, fmt.Errorf("画像ファイルの展開に失敗しました: %w", err)
+		}
+		promptConfig.Attachments = images
 	}
 
 	// -collect オプションが指定された場合、ファイルを収集
 	if options.CollectFiles {
-		filesContent, err := CollectFiles(".")
+		paths, err := CollectFilePaths(".")
+		if err != nil {
+			return promptConfig, fmt.Errorf("ファイルの収集に失敗しました: %w", err)
+		}
+		filesContent, err := RenderFileContext(paths, promptConfig.FileContext)
 		if err != nil {
 			return promptConfig, fmt.Errorf("ファイルの収集に失敗しました: %w", err)
 		}
@@ -72,13 +364,26 @@ func GetPromptConfig(config Config, options Options) (Prompt, error) {
 
 	// -f オプションが指定された場合、ファイルを読み込む
 	if options.FileList != "" {
-		filesContent, err := ReadFiles(options.FileList)
+		paths, err := ExpandFileList(options.FileList)
+		if err != nil {
+			return promptConfig, fmt.Errorf("ファイルの読み込みに失敗しました: %w", err)
+		}
+		filesContent, err := RenderFileContext(paths, promptConfig.FileContext)
 		if err != nil {
 			return promptConfig, fmt.Errorf("ファイルの読み込みに失敗しました: %w", err)
 		}
 		promptConfig.User += "\n\n" + filesContent
 	}
 
+	// -git-* オプションが指定された場合、git の差分や変更されたファイルを追加
+	if gitContext := options.GitContext(); gitContext.Enabled() {
+		gitContent, err := BuildGitContext(gitContext, promptConfig.FileContext)
+		if err != nil {
+			return promptConfig, fmt.Errorf("git の情報の取得に失敗しました: %w", err)
+		}
+		promptConfig.User += "\n\n" + gitContent
+	}
+
 	// ツール設定のマージ
 	if len(options.Tools) > 0 {
 		promptConfig.Tools = append(promptConfig.Tools, options.Tools...)
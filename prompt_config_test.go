@@ -0,0 +1,129 @@
+package main
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestResolvePrompt(t *testing.T) {
+	maxTokens := 100
+	config := Config{
+		Snippets: map[string]string{
+			"japanese": "日本語で回答してください。\n",
+			"concise":  "簡潔に答えてください。",
+		},
+		Prompts: map[string]Prompt{
+			"base": {
+				Model:       "gpt-4o",
+				SystemParts: []string{"japanese"},
+				MaxTokens:   &maxTokens,
+				Tools:       []string{"search"},
+			},
+			"child": {
+				Extends:     "base",
+				SystemParts: []string{"japanese", "concise"},
+				System:      "あなたはレビュアーです。",
+				Tools:       []string{},
+			},
+			"review": {
+				Extends: "review",
+				Model:   "gpt-4.1",
+			},
+			"loopA": {Extends: "loopB"},
+			"loopB": {Extends: "loopA"},
+			"broken": {
+				SystemParts: []string{"unknown"},
+			},
+		},
+	}
+
+	child, err := ResolvePrompt(config, "child")
+	if err != nil {
+		t.Fatalf("ResolvePrompt() エラー: %v", err)
+	}
+	if child.Model != "gpt-4o" || child.MaxTokens == nil || *child.MaxTokens != 100 {
+		t.Errorf("継承元の設定が反映されていません: %+v", child)
+	}
+	if want := "日本語で回答してください。\n\n簡潔に答えてください。\n\nあなたはレビュアーです。"; child.System != want {
+		t.Errorf("System = %q, 期待値 %q", child.System, want)
+	}
+	if !reflect.DeepEqual(child.Tools, []string{}) {
+		t.Errorf("空のリストで継承元の tools が上書きされていません: %v", child.Tools)
+	}
+
+	review, err := ResolvePrompt(config, "review")
+	if err != nil {
+		t.Fatalf("ResolvePrompt() エラー: %v", err)
+	}
+	if review.Model != "gpt-4.1" || review.System != builtinPrompts["review"].System {
+		t.Errorf("組み込みプロンプトの継承が正しくありません: %+v", review)
+	}
+
+	if _, err := ResolvePrompt(config, "loopA"); err == nil || !strings.Contains(err.Error(), "循環") {
+		t.Errorf("循環した継承がエラーになりませんでした: %v", err)
+	}
+	if _, err := ResolvePrompt(config, "broken"); err == nil {
+		t.Errorf("未定義のスニペットがエラーになりませんでした")
+	}
+	if _, err := ResolvePrompt(config, "missing"); err == nil {
+		t.Errorf("未定義のプロンプトがエラーになりませんでした")
+	}
+}
+
+func TestGetPromptConfigProfile(t *testing.T) {
+	logger = NewConsoleLogger(false)
+	quickTemperature := float32(0.2)
+	careful := float32(0.9)
+	maxTokens := 4000
+	config := Config{
+		Profiles: map[string]Profile{
+			"quick":   {Model: "gpt-4o-mini", Temperature: &quickTemperature, Timeout: 10, System: "簡潔に答えてください。"},
+			"careful": {Model: "gpt-4o", Temperature: &careful, MaxTokens: &maxTokens, Timeout: 300},
+		},
+		Prompts: map[string]Prompt{
+			"review": {Extends: "review", Profile: "careful", Model: "gpt-4.1"},
+			"plain":  {User: "こんにちは"},
+		},
+	}
+
+	// プロンプトで指定したプロファイルより、プロンプト自身の値が優先される
+	options := Options{PromptOption: "review", Model: "gpt-4o-mini", Timeout: 60}
+	promptConfig, err := GetPromptConfig(config, options)
+	if err != nil {
+		t.Fatalf("GetPromptConfig() エラー: %v", err)
+	}
+	if promptConfig.Model != "gpt-4.1" || promptConfig.Timeout != 300 || *promptConfig.MaxTokens != 4000 || *promptConfig.Temperature != careful {
+		t.Errorf("プロファイルとプロンプトの優先順位が正しくありません: %+v", promptConfig)
+	}
+
+	// -profile はプロンプトの profile より優先され、明示的なコマンドライン引数はプロファイルより優先される
+	options = Options{
+		PromptOption:  "plain",
+		Profile:       "quick",
+		Model:         "gpt-4.1-nano",
+		Timeout:       30,
+		ExplicitFlags: map[string]bool{"t": true},
+	}
+	promptConfig, err = GetPromptConfig(config, options)
+	if err != nil {
+		t.Fatalf("GetPromptConfig() エラー: %v", err)
+	}
+	if promptConfig.Model != "gpt-4o-mini" || promptConfig.Timeout != 30 || promptConfig.System != "簡潔に答えてください。" {
+		t.Errorf("-profile とコマンドライン引数の優先順位が正しくありません: %+v", promptConfig)
+	}
+
+	options.ExplicitFlags["model"] = true
+	promptConfig, err = GetPromptConfig(config, options)
+	if err != nil {
+		t.Fatalf("GetPromptConfig() エラー: %v", err)
+	}
+	if promptConfig.Model != "gpt-4.1-nano" {
+		t.Errorf("明示的に指定した -model が優先されていません: %s", promptConfig.Model)
+	}
+
+	options.Profile = "missing"
+	if _, err := GetPromptConfig(config, options); err == nil {
+		t.Errorf("未定義のプロファイルがエラーになりませんでした")
+	}
+}
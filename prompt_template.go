@@ -0,0 +1,106 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"os/exec"
+	"regexp"
+	"strings"
+	"text/template"
+	"time"
+)
+
+// promptTemplateContext は、プロンプトのテンプレートを展開する際に参照する値を保持します
+type promptTemplateContext struct {
+	vars       map[string]string
+	stdin      string
+	allowShell bool
+	usedStdin  bool
+}
+
+// missingKeyPattern は text/template の未定義変数のエラーからキー名を取り出す正規表現です
+var missingKeyPattern = regexp.MustCompile(`map has no entry for key "([^"]+)"`)
+
+// RenderPromptTemplate は、プロンプトの文字列を Go の text/template として展開します。
+// テンプレート中では次の値と関数を使用できます:
+//   - {{.name}}: -var name=value で指定した変数（未指定の場合はエラー）
+//   - {{env "NAME"}}, {{env "NAME" "default"}}: 環境変数
+//   - {{file "path"}}: ファイルの内容
+//   - {{stdin}}: 標準入力の内容
+//   - {{date}}, {{date "2006/01/02 15:04"}}: 現在の日時
+//   - {{shell "command"}}: シェルコマンドの出力（-allow-shell を指定するか、ユーザーの設定ファイルのプロンプトに allowShell: true を書いた場合のみ）
+func RenderPromptTemplate(name, text string, ctx *promptTemplateContext) (string, error) {
+	if !strings.Contains(text, "{{") {
+		return text, nil
+	}
+
+	tmpl, err := template.New(name).Option("missingkey=error").Funcs(ctx.funcs()).Parse(text)
+	if err != nil {
+		return "", fmt.Errorf("プロンプト %s のテンプレートの解析に失敗しました: %w", name, err)
+	}
+
+	data := make(map[string]interface{}, len(ctx.vars))
+	for key, value := range ctx.vars {
+		data[key] = value
+	}
+
+	var builder strings.Builder
+	if err := tmpl.Execute(&builder, data); err != nil {
+		if m := missingKeyPattern.FindStringSubmatch(err.Error()); m != nil {
+			return "", fmt.Errorf("プロンプト %s のテンプレート変数 %s が指定されていません (-var %s=値 で指定してください)", name, m[1], m[1])
+		}
+		return "", fmt.Errorf("プロンプト %s のテンプレートの展開に失敗しました: %w", name, err)
+	}
+	return builder.String(), nil
+}
+
+// funcs はテンプレートで使用できる関数の一覧を返します
+func (ctx *promptTemplateContext) funcs() template.FuncMap {
+	return template.FuncMap{
+		"env": func(name string, defaultValue ...string) (string, error) {
+			if value, ok := os.LookupEnv(name); ok {
+				return value, nil
+			}
+			if len(defaultValue) > 0 {
+				return defaultValue[0], nil
+			}
+			return "", fmt.Errorf("環境変数 %s が設定されていません", name)
+		},
+		"file": func(path string) (string, error) {
+			content, err := os.ReadFile(path)
+			if err != nil {
+				return "", fmt.Errorf("ファイルの読み込みに失敗しました (%s): %w", path, err)
+			}
+			return string(content), nil
+		},
+		"stdin": func() string {
+			ctx.usedStdin = true
+			return ctx.stdin
+		},
+		"date": func(layout ...string) string {
+			if len(layout) > 0 {
+				return time.Now().Format(layout[0])
+			}
+			return time.Now().Format("2006-01-02")
+		},
+		"shell": func(command string) (string, error) {
+			if !ctx.allowShell {
+				return "", fmt.Errorf("shell 関数は無効です。-allow-shell を指定するか、ユーザーの設定ファイルのプロンプトに allowShell: true を書いてください")
+			}
+			out, err := exec.Command("sh", "-c", command).Output()
+			if err != nil {
+				return "", fmt.Errorf("コマンドの実行に失敗しました (%s): %w", command, err)
+			}
+			return strings.TrimRight(string(out), "\n"), nil
+		},
+	}
+}
+
+// ParseTemplateVar は、-var で指定された key=value 形式の文字列を分割します
+func ParseTemplateVar(s string) (string, string, error) {
+	key, value, ok := strings.Cut(s, "=")
+	if !ok || strings.TrimSpace(key) == "" {
+		return "", "", fmt.Errorf("変数は key=value の形式で指定してください: %s", s)
+	}
+	return strings.TrimSpace(key), value, nil
+}
@@ -0,0 +1,113 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestRenderPromptTemplate(t *testing.T) {
+	dir := t.TempDir()
+	includePath := filepath.Join(dir, "style.txt")
+	if err := os.WriteFile(includePath, []byte("丁寧に"), 0644); err != nil {
+		t.Fatalf("ファイル作成エラー: %v", err)
+	}
+	t.Setenv("GPT_CLI_TEST_LANG", "日本語")
+
+	ctx := &promptTemplateContext{
+		vars:  map[string]string{"topic": "Go"},
+		stdin: "標準入力",
+	}
+	text := `{{.topic}}について{{env "GPT_CLI_TEST_LANG"}}で{{file "` + includePath + `"}}。{{env "GPT_CLI_TEST_UNSET" "既定"}} {{stdin}} {{date "2006"}}`
+	got, err := RenderPromptTemplate("test", text, ctx)
+	if err != nil {
+		t.Fatalf("RenderPromptTemplate() エラー: %v", err)
+	}
+	want := "Goについて日本語で丁寧に。既定 標準入力 " + time.Now().Format("2006")
+	if got != want {
+		t.Errorf("RenderPromptTemplate() = %q, 期待値 %q", got, want)
+	}
+	if !ctx.usedStdin {
+		t.Errorf("stdin の使用が記録されていません")
+	}
+}
+
+func TestRenderPromptTemplateErrors(t *testing.T) {
+	ctx := &promptTemplateContext{}
+
+	_, err := RenderPromptTemplate("test", "{{.missing}}", ctx)
+	if err == nil || !strings.Contains(err.Error(), "-var missing=") {
+		t.Errorf("未定義の変数のエラーが分かりにくいです: %v", err)
+	}
+
+	if _, err := RenderPromptTemplate("test", `{{shell "echo hi"}}`, ctx); err == nil {
+		t.Errorf("shell 関数が許可なしで実行されました")
+	}
+
+	ctx.allowShell = true
+	got, err := RenderPromptTemplate("test", `{{shell "echo hi"}}`, ctx)
+	if err != nil || got != "hi" {
+		t.Errorf("shell 関数の結果が想定と異なります: %q, %v", got, err)
+	}
+}
+
+func TestGetPromptConfigTemplate(t *testing.T) {
+	logger = NewConsoleLogger(false)
+	config := Config{
+		Prompts: map[string]Prompt{
+			"translate": {
+				System: "{{.lang}}に翻訳してください。",
+				User:   "次の文章: {{stdin}}",
+			},
+		},
+	}
+	options := Options{
+		PromptOption: "translate",
+		Vars:         map[string]string{"lang": "英語"},
+		StdinContent: "こんにちは",
+		UserMessage:  " こんにちは",
+	}
+
+	promptConfig, err := GetPromptConfig(config, options)
+	if err != nil {
+		t.Fatalf("GetPromptConfig() エラー: %v", err)
+	}
+	if promptConfig.System != "英語に翻訳してください。" {
+		t.Errorf("System が想定と異なります: %q", promptConfig.System)
+	}
+	if promptConfig.User != "次の文章: こんにちは" {
+		t.Errorf("User が想定と異なります: %q", promptConfig.User)
+	}
+}
+
+func TestGetPromptConfigAllowShell(t *testing.T) {
+	logger = NewConsoleLogger(false)
+	allow, deny := true, false
+	config := Config{
+		Snippets: map[string]string{
+			"project": "{{shell \"echo snippet\"}}",
+		},
+		Prompts: map[string]Prompt{
+			"base":     {AllowShell: &allow, User: "{{shell \"echo hi\"}}"},
+			"disabled": {Extends: "base", AllowShell: &deny},
+			"project":  {Extends: "base", untrusted: true},
+			"parts":    {Extends: "base", SystemParts: []string{"project"}},
+		},
+		untrustedSnippets: map[string]bool{"project": true},
+	}
+
+	promptConfig, err := GetPromptConfig(config, Options{PromptOption: "base"})
+	if err != nil || promptConfig.User != "hi" {
+		t.Errorf("allowShell: true のプロンプトで shell 関数が実行されませんでした: %q, %v", promptConfig.User, err)
+	}
+	for _, name := range []string{"disabled", "project", "parts"} {
+		if _, err := GetPromptConfig(config, Options{PromptOption: name}); err == nil {
+			t.Errorf("プロンプト %s で shell 関数が実行されました", name)
+		}
+	}
+	if _, err := GetPromptConfig(config, Options{PromptOption: "project", AllowShell: true}); err != nil {
+		t.Errorf("-allow-shell を指定した場合は shell 関数を実行するはずです: %v", err)
+	}
+}
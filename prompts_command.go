@@ -0,0 +1,73 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"sort"
+
+	"gopkg.in/yaml.v3"
+)
+
+// runPromptsCommand は prompts サブコマンドを実行します。
+//   - prompts list: 使用できるプロンプトの一覧を表示
+//   - prompts show <name>: 継承とコマンドライン引数による上書きを反映したプロンプトを表示
+func runPromptsCommand(options Options, config Config, args []string) error {
+	fs := newSubcommandFlagSet("prompts")
+	positional, err := parseSubcommandFlags(fs, args)
+	if err != nil {
+		return err
+	}
+	if len(positional) == 0 {
+		return fmt.Errorf("prompts のアクションを指定してください (list, show)")
+	}
+
+	switch positional[0] {
+	case "list":
+		return listPrompts(config)
+	case "show":
+		if len(positional) < 2 {
+			return fmt.Errorf("表示するプロンプト名を指定してください (prompts show <name>)")
+		}
+		options.PromptOption = positional[1]
+		promptConfig, err := GetPromptConfig(config, options)
+		if err != nil {
+			return err
+		}
+		encoder := yaml.NewEncoder(os.Stdout)
+		encoder.SetIndent(2)
+		defer encoder.Close()
+		return encoder.Encode(promptConfig)
+	default:
+		return fmt.Errorf("不正な prompts のアクションが指定されました: %s", positional[0])
+	}
+}
+
+// listPrompts は config.yaml と組み込みのプロンプトの一覧を表示します
+func listPrompts(config Config) error {
+	names := make(map[string]struct{})
+	for name := range config.Prompts {
+		names[name] = struct{}{}
+	}
+	for name := range builtinPrompts {
+		names[name] = struct{}{}
+	}
+
+	sorted := make([]string, 0, len(names))
+	for name := range names {
+		sorted = append(sorted, name)
+	}
+	sort.Strings(sorted)
+
+	for _, name := range sorted {
+		prompt, inConfig := config.Prompts[name]
+		switch {
+		case !inConfig:
+			fmt.Printf("%s (組み込み)\n", name)
+		case prompt.Extends != "":
+			fmt.Printf("%s (extends: %s)\n", name, prompt.Extends)
+		default:
+			fmt.Println(name)
+		}
+	}
+	return nil
+}
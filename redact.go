@@ -0,0 +1,247 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"regexp"
+	"sort"
+	"strings"
+
+	openai "github.com/sashabaranov/go-openai"
+)
+
+// 機密情報が見つかった場合の動作
+const (
+	RedactionModeMask  = "mask"
+	RedactionModeBlock = "block"
+	RedactionModeOff   = "off"
+)
+
+// RedactionConfig は、送信する前にメッセージから機密情報を取り除く設定で、以下のフィールドを含みます:
+// - Mode: 機密情報が見つかった場合の動作（mask: 伏せ字にして送信、block: 送信を中止、off: 検出しない。未指定の場合は mask）
+// - Patterns: 組み込みの検出に加えて使う正規表現（グループがある場合は最初のグループだけを伏せ字にします）
+// - Allow: 一致した文字列を機密情報として扱わない正規表現（テスト用のダミーの鍵など）
+type RedactionConfig struct {
+	Mode     string             `yaml:"mode,omitempty"`
+	Patterns []RedactionPattern `yaml:"patterns,omitempty"`
+	Allow    []string           `yaml:"allow,omitempty"`
+}
+
+// RedactionPattern は機密情報を検出する正規表現に名前を付けたものです
+type RedactionPattern struct {
+	Name    string `yaml:"name"`
+	Pattern string `yaml:"pattern"`
+}
+
+// ModeName は機密情報が見つかった場合の動作を返します
+func (r RedactionConfig) ModeName() string {
+	if r.Mode == "" {
+		return RedactionModeMask
+	}
+	return r.Mode
+}
+
+// builtinRedactionPatterns は組み込みの機密情報の検出パターンです。
+// 複数のパターンに一致した部分は、先に書いたパターンの名前で表示します（sk-ant- を OpenAI の鍵と表示しないなど）。
+var builtinRedactionPatterns = []RedactionPattern{
+	{"private-key", `-----BEGIN [A-Z0-9 ]*PRIVATE KEY(?: BLOCK)?-----[\s\S]*?-----END [A-Z0-9 ]*PRIVATE KEY(?: BLOCK)?-----`},
+	{"anthropic-api-key", `\bsk-ant-[A-Za-z0-9_-]{20,}`},
+	{"openai-api-key", `\bsk-(?:proj-|svcacct-|admin-)?[A-Za-z0-9_-]{20,}`},
+	{"github-token", `\b(?:gh[pousr]_[A-Za-z0-9]{36,}|github_pat_[A-Za-z0-9_]{22,})`},
+	{"aws-access-key-id", `\b(?:AKIA|ASIA)[0-9A-Z]{16}\b`},
+	{"aws-secret-access-key", `(?i)aws_?secret_?access_?key["']?\s*[:=]\s*["']?([A-Za-z0-9/+=]{40})\b`},
+	{"google-api-key", `\bAIza[0-9A-Za-z_-]{35}`},
+	{"slack-token", `\bxox[abprs]-[A-Za-z0-9-]{10,}`},
+	{"stripe-key", `\b(?:sk|rk)_live_[0-9A-Za-z]{20,}`},
+	{"jwt", `\beyJ[A-Za-z0-9_-]{10,}\.eyJ[A-Za-z0-9_-]{10,}\.[A-Za-z0-9_-]{10,}`},
+	// .env やシェルの設定ファイルの KEY=value の形式（変数名が大文字で、SECRET, PASSWORD, TOKEN, API_KEY を含むもの）
+	{"env-secret", `(?m)^\s*(?:export\s+)?[A-Z0-9_]*(?:SECRET|PASSWORD|PASSWD|TOKEN|API_?KEY|PRIVATE_KEY)[A-Z0-9_]*\s*=\s*["']?([^\s"'#]{8,})`},
+}
+
+// compiledRedactionPattern はコンパイルした検出パターンです
+type compiledRedactionPattern struct {
+	name string
+	re   *regexp.Regexp
+}
+
+// SecretFinding はメッセージで見つかった機密情報です
+// - Message: 見つかったメッセージの位置（0から数える）
+// - Name: 検出したパターンの名前
+// - Preview: 見つかった文字列の先頭だけを残した表示用の文字列
+type SecretFinding struct {
+	Message int
+	Name    string
+	Preview string
+	start   int
+	end     int
+	// priority は検出したパターンの順番です（小さいほど優先）
+	priority int
+}
+
+// SecretRedactor は機密情報の検出と伏せ字を行います
+type SecretRedactor struct {
+	patterns []compiledRedactionPattern
+	allow    []*regexp.Regexp
+}
+
+// NewSecretRedactor は、組み込みのパターンと設定ファイルのパターンから SecretRedactor を作成します
+func NewSecretRedactor(config RedactionConfig) (*SecretRedactor, error) {
+	redactor := &SecretRedactor{}
+	for _, pattern := range append(append([]RedactionPattern{}, builtinRedactionPatterns...), config.Patterns...) {
+		re, err := regexp.Compile(pattern.Pattern)
+		if err != nil {
+			return nil, fmt.Errorf("redaction.patterns の %s の正規表現が不正です: %w", pattern.Name, err)
+		}
+		redactor.patterns = append(redactor.patterns, compiledRedactionPattern{name: pattern.Name, re: re})
+	}
+	for _, allow := range config.Allow {
+		re, err := regexp.Compile(allow)
+		if err != nil {
+			return nil, fmt.Errorf("redaction.allow の正規表現が不正です (%s): %w", allow, err)
+		}
+		redactor.allow = append(redactor.allow, re)
+	}
+	return redactor, nil
+}
+
+// Find はテキストに含まれる機密情報を、位置の順に返します。複数のパターンに一致して重なる部分は1つにまとめます。
+func (r *SecretRedactor) Find(text string) []SecretFinding {
+	var findings []SecretFinding
+	for i, pattern := range r.patterns {
+		for _, loc := range pattern.re.FindAllStringSubmatchIndex(text, -1) {
+			start, end := loc[0], loc[1]
+			if len(loc) >= 4 && loc[2] >= 0 {
+				start, end = loc[2], loc[3]
+			}
+			if start == end || r.allowed(text[start:end]) {
+				continue
+			}
+			findings = append(findings, SecretFinding{Name: pattern.name, start: start, end: end, priority: i})
+		}
+	}
+
+	// 重なる部分は1つにまとめて全体を伏せ字にする。パターン名は先に書いたパターンのものにする
+	sort.SliceStable(findings, func(i, j int) bool { return findings[i].start < findings[j].start })
+	var result []SecretFinding
+	for _, finding := range findings {
+		if n := len(result); n > 0 && finding.start < result[n-1].end {
+			last := &result[n-1]
+			last.end = max(last.end, finding.end)
+			if finding.priority < last.priority {
+				last.Name, last.priority = finding.Name, finding.priority
+			}
+			continue
+		}
+		result = append(result, finding)
+	}
+	for i := range result {
+		result[i].Preview = secretPreview(text[result[i].start:result[i].end])
+	}
+	return result
+}
+
+// allowed は、文字列が redaction.allow のいずれかに一致するかを返します
+func (r *SecretRedactor) allowed(s string) bool {
+	for _, re := range r.allow {
+		if re.MatchString(s) {
+			return true
+		}
+	}
+	return false
+}
+
+// Redact はテキストの機密情報を [REDACTED:パターン名] に置き換え、見つかった機密情報とともに返します
+func (r *SecretRedactor) Redact(text string) (string, []SecretFinding) {
+	findings := r.Find(text)
+	if len(findings) == 0 {
+		return text, nil
+	}
+	var sb strings.Builder
+	last := 0
+	for _, finding := range findings {
+		sb.WriteString(text[last:finding.start])
+		sb.WriteString("[REDACTED:" + finding.Name + "]")
+		last = finding.end
+	}
+	sb.WriteString(text[last:])
+	return sb.String(), findings
+}
+
+// secretPreview は、機密情報の先頭4文字と長さだけを表示用に残します
+func secretPreview(s string) string {
+	runes := []rune(s)
+	if len(runes) <= 8 {
+		return fmt.Sprintf("…（%d文字）", len(runes))
+	}
+	return fmt.Sprintf("%s…（%d文字）", string(runes[:4]), len(runes))
+}
+
+// RedactMessages は、メッセージの本文とテキストのパートに含まれる機密情報を伏せ字にしたコピーと、見つかった機密情報を返します。
+// CreateMessages が埋め込んだ画像のデータは検出の対象にしません。
+func RedactMessages(messages []openai.ChatCompletionMessage, redactor *SecretRedactor) ([]openai.ChatCompletionMessage, []SecretFinding) {
+	redacted := make([]openai.ChatCompletionMessage, len(messages))
+	var findings []SecretFinding
+	for i, message := range messages {
+		if message.Content != "" && !embeddedImagePattern.MatchString(message.Content) {
+			var found []SecretFinding
+			message.Content, found = redactor.Redact(message.Content)
+			for _, finding := range found {
+				finding.Message = i
+				findings = append(findings, finding)
+			}
+		}
+		if len(message.MultiContent) > 0 {
+			parts := append([]openai.ChatMessagePart{}, message.MultiContent...)
+			for j, part := range parts {
+				if part.Type != openai.ChatMessagePartTypeText {
+					continue
+				}
+				var found []SecretFinding
+				parts[j].Text, found = redactor.Redact(part.Text)
+				for _, finding := range found {
+					finding.Message = i
+					findings = append(findings, finding)
+				}
+			}
+			message.MultiContent = parts
+		}
+		redacted[i] = message
+	}
+	return redacted, findings
+}
+
+// ApplySecretRedaction は、送信するメッセージの機密情報を設定に従って伏せ字にするか、送信を中止します。
+// 見つかった機密情報は w に表示します。allowSecrets が true の場合は何もしません。
+func ApplySecretRedaction(messages []openai.ChatCompletionMessage, config RedactionConfig, allowSecrets bool, w io.Writer) ([]openai.ChatCompletionMessage, error) {
+	mode := config.ModeName()
+	if allowSecrets || mode == RedactionModeOff {
+		return messages, nil
+	}
+	if mode != RedactionModeMask && mode != RedactionModeBlock {
+		return nil, fmt.Errorf("不正な redaction.mode が指定されました: %s (mask, block, off)", mode)
+	}
+	redactor, err := NewSecretRedactor(config)
+	if err != nil {
+		return nil, err
+	}
+
+	redacted, findings := RedactMessages(messages, redactor)
+	if len(findings) == 0 {
+		return messages, nil
+	}
+	if mode == RedactionModeBlock {
+		fmt.Fprintln(w, "送信するメッセージに機密情報と思われる文字列が含まれています:")
+		PrintSecretFindings(w, findings)
+		return nil, fmt.Errorf("機密情報と思われる文字列が含まれているため送信を中止しました（そのまま送信する場合は -allow-secrets を指定してください）")
+	}
+	fmt.Fprintln(w, "機密情報と思われる文字列を伏せ字にして送信します（そのまま送信する場合は -allow-secrets を指定してください）:")
+	PrintSecretFindings(w, findings)
+	return redacted, nil
+}
+
+// PrintSecretFindings は見つかった機密情報を「パターン名: 先頭の文字（長さ）」の形式で表示します
+func PrintSecretFindings(w io.Writer, findings []SecretFinding) {
+	for _, finding := range findings {
+		fmt.Fprintf(w, "  - %s: %s\n", finding.Name, finding.Preview)
+	}
+}
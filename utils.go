@@ -2,7 +2,6 @@ package main
 
 import (
 	"encoding/base64"
-	"encoding/json"
 	"fmt"
 	"io/fs"
 	"os"
@@ -15,18 +14,22 @@ import (
 	"golang.org/x/text/language"
 )
 
-// SplitImageListは、カンマで区切られた画像ファイル名のリストを分割し、スライス（配列）として返します。
-// 引数imageListはカンマ区切りの文字列です。
-func SplitImageList(imageList string) []string {
-	return strings.Split(imageList, ",")
-}
-
 // CollectFilesは、指定されたディレクトリ内のすべてのファイル名とその内容を収集します。
 // 収集した内容は、ファイル名と内容のペアとして文字列として返されます。
 // 引数dirは検索開始のディレクトリです。
 // .gitディレクトリはスキップされます。
 func CollectFiles(dir string) (string, error) {
-	var builder strings.Builder
+	paths, err := CollectFilePaths(dir)
+	if err != nil {
+		return "", err
+	}
+	return RenderFileContext(paths, FileContextConfig{})
+}
+
+// CollectFilePathsは、指定されたディレクトリ内のすべてのファイルのパスを収集します。
+// .gitディレクトリはスキップされます。
+func CollectFilePaths(dir string) ([]string, error) {
+	var paths []string
 
 	err := filepath.Walk(dir, func(path string, info fs.FileInfo, err error) error {
 		if err != nil {
@@ -38,59 +41,28 @@ func CollectFiles(dir string) (string, error) {
 			return filepath.SkipDir
 		}
 
-		// ファイルの場合、名前と内容を取得
 		if !info.IsDir() {
-			content, err := os.ReadFile(path)
-			if err != nil {
-				return err
-			}
-			builder.WriteString(fmt.Sprintf("ファイル名: %s\n内容:\n%s\n\n", path, string(content)))
+			paths = append(paths, path)
 		}
 		return nil
 	})
 
 	if err != nil {
-		return "", err
+		return nil, err
 	}
 
-	return builder.String(), nil
+	return paths, nil
 }
 
 // ReadFilesは、コンマで区切られたファイル名リストからファイルを読み込み、その内容を結合して返します。
-// 引数fileListは読み込むファイルのパスを示します。
+// 引数fileListは読み込むファイルのパスまたはグロブパターン（`**` やブレース展開、`!` による除外に対応）です。
 // 成功した場合は内容が連結された文字列、エラーが発生した場合はそのエラーメッセージを返します。
 func ReadFiles(fileList string) (string, error) {
-	var builder strings.Builder
-	files := strings.Split(fileList, ",")
-
-	for _, filePath := range files {
-		// グロブパターンを処理
-		if matches, err := filepath.Glob(filePath); err == nil {
-			for _, match := range matches {
-				if err := readAndAppendFileContents(match, &builder); err != nil {
-					return "", fmt.Errorf("ファイルの読み込みに失敗しました (%s): %w", match, err)
-				}
-			}
-		} else {
-			// グロブ処理が失敗した場合、通常のファイルパスとみなして読み込む
-			if err := readAndAppendFileContents(filePath, &builder); err != nil {
-				return "", fmt.Errorf("ファイルの読み込みに失敗しました (%s): %w", filePath, err)
-			}
-		}
-	}
-	return builder.String(), nil
-}
-
-// readAndAppendFileContents は指定されたファイルの内容をリストに追加します。
-func readAndAppendFileContents(filePath string, builder *strings.Builder) error {
-	content, err := os.ReadFile(filePath)
+	files, err := ExpandFileList(fileList)
 	if err != nil {
-		return err
+		return "", err
 	}
-
-	// fmt.Fprintfを使って直接builderに書き込み
-	_, err = fmt.Fprintf(builder, "ファイル名: %s\n内容:\n%s\n\n", filePath, string(content))
-	return err
+	return RenderFileContext(files, FileContextConfig{})
 }
 
 // CreateMessages はプロンプト設定からメッセージを作成します
@@ -164,50 +136,26 @@ func getMimeType(ext string) string {
 	}
 }
 
-// SaveConversationHistory は会話履歴をファイルに保存します
-func SaveConversationHistory(filename string, history []openai.ChatCompletionMessage) error {
-	if filepath.Ext(filename) == "" {
-		filename += ".json"
-	}
-	data, err := json.Marshal(history)
-	if err != nil {
-		return err
-	}
-	return os.WriteFile(filename, data, 0600)
-}
-
-// LoadConversationHistory はファイルから会話履歴を読み込みます
-func LoadConversationHistory(filename string) ([]openai.ChatCompletionMessage, error) {
-	if filename == "" {
-		return []openai.ChatCompletionMessage{}, nil
-	}
-	if filepath.Ext(filename) == "" {
-		filename += ".json"
-	}
-	data, err := os.ReadFile(filename)
-	if err != nil {
-		if os.IsNotExist(err) {
-			return []openai.ChatCompletionMessage{}, nil
-		}
-		return nil, err
-	}
-	var history []openai.ChatCompletionMessage
-	err = json.Unmarshal(data, &history)
-	if err != nil {
-		return nil, err
-	}
-	return history, nil
-}
-
 // DisplayConversationHistory は会話履歴をMarkdown形式で表示します
-func DisplayConversationHistory(history []openai.ChatCompletionMessage) {
+// render が true の場合は、Markdownとして整形して表示します。
+func DisplayConversationHistory(history []openai.ChatCompletionMessage, render bool) {
 	c := cases.Title(language.Und) // 言語を指定（ここでは未指定）
 	for _, message := range history {
 		role := c.String(message.Role)
-		fmt.Printf("### %s\n\n%s\n\n", role, message.Content)
+		printAssistantContent(fmt.Sprintf("### %s\n\n%s\n", role, message.Content), render)
+		fmt.Println()
 	}
 }
 
+// printAssistantContent は応答を表示します。render が true の場合は端末の幅でMarkdownを整形します。
+func printAssistantContent(content string, render bool) {
+	if render {
+		fmt.Print(RenderMarkdown(content, terminalWidth()))
+		return
+	}
+	fmt.Println(content)
+}
+
 // GetLogDirectory は設定ファイルや環境変数に基づいてログの保存ディレクトリを取得します
 func GetLogDirectory(config Config) string {
 	if config.LogDir != "" {
@@ -244,10 +192,24 @@ func handleChatCompletion(client *openai.Client, promptConfig Prompt, conversati
 		logger.Debug("現在のオプション内容:\n%s", options.String())
 	}
 
+	// -compare が指定された場合は複数のモデルの回答を比較
+	if options.CompareModels != "" {
+		return handleCompare(client, promptConfig, conversationHistory, options)
+	}
+
 	// OpenAI API へのリクエスト
-	assistantMessage, err := ExecuteChatCompletion(client, promptConfig.Model, promptConfig.MaxTokens, conversationHistory)
+	resp, err := RequestChatCompletion(client, promptConfig, conversationHistory)
 	if err != nil {
-		return fmt.Errorf("ChatCompletionエラー: %w", err)
+		return err
+	}
+	assistantMessage := resp.Choices[0].Message
+
+	// 構造化出力の検証（一致しない場合は応答を標準エラー出力に表示してエラーで終了）
+	for _, choice := range resp.Choices {
+		if err := ValidateStructuredResponse(promptConfig, choice.Message.Content); err != nil {
+			fmt.Fprintln(os.Stderr, choice.Message.Content)
+			return err
+		}
 	}
 
 	// 会話履歴にアシスタントの応答を追加
@@ -255,61 +217,45 @@ func handleChatCompletion(client *openai.Client, promptConfig Prompt, conversati
 
 	// 会話履歴の保存
 	if options.HistoryFile != "" {
-		err = SaveConversationHistory(options.HistoryFile, conversationHistory)
+		err = RecordConversation(options.HistoryFile, conversationHistory, promptConfig.Model, options, resp.Usage)
 		if err != nil {
 			return fmt.Errorf("会話履歴の保存に失敗しました: %w", err)
 		}
+		autoPruneHistory(options)
+		// 応答を表示した後に、最初のやり取りから会話のタイトルを生成
+		defer func() {
+			path, err := AutoTitleConversation(client, options.HistoryFile, options)
+			if err != nil {
+				logger.Info("会話のタイトルの生成に失敗しました: %v", err)
+			} else if path != historyFilename(options.HistoryFile) {
+				fmt.Fprintf(os.Stderr, "会話履歴を %s に保存しました。\n", strings.TrimSuffix(filepath.Base(path), ".json"))
+			}
+		}()
 	}
 
-	// 標準出力に結果を表示
-	fmt.Println(assistantMessage.Content)
-
-	return nil
-}
-
-// RecursiveGlob は再帰的なグロブパターンを展開します
-func RecursiveGlob(pattern string) ([]string, error) {
-	var matches []string
-
-	// パターンを分割
-	parts := strings.Split(pattern, "**")
-	if len(parts) != 2 {
-		return nil, fmt.Errorf("パターンの形式が正しくありません: %s", pattern)
+	// -edit が指定された場合は応答の変更をファイルに適用
+	if options.Edit {
+		return handleEdit(assistantMessage.Content, options)
 	}
 
-	// ベースディレクトリを取得
-	baseDir := parts[0]
-	if baseDir == "" {
-		baseDir = "."
+	// 標準出力に結果を表示（複数の候補がある場合は番号を付けてすべて表示し、履歴には最初の候補を保存）
+	// -extract-code などが指定された場合はコードブロックだけを出力
+	if options.CodeOutputRequested() {
+		return handleCodeOutput(assistantMessage.Content, options)
 	}
 
-	subPattern := parts[1]
-
-	// ベースディレクトリから再帰的に探索
-	err := filepath.Walk(baseDir, func(path string, info os.FileInfo, err error) error {
-		if err != nil {
-			return err
-		}
-
-		// ディレクトリはスキップ
-		if info.IsDir() {
-			return nil
-		}
-
-		// サブパターンにマッチするか確認
-		match, err := filepath.Match(subPattern, filepath.Base(path))
-		if err != nil {
-			return err
-		}
-		if match {
-			matches = append(matches, path)
-		}
+	render := options.RenderMarkdownOutput(promptConfig)
+	if len(resp.Choices) == 1 {
+		printAssistantContent(assistantMessage.Content, render)
 		return nil
-	})
-
-	if err != nil {
-		return nil, err
+	}
+	for i, choice := range resp.Choices {
+		if i > 0 {
+			fmt.Println()
+		}
+		fmt.Printf("--- 候補 %d ---\n", i+1)
+		printAssistantContent(choice.Message.Content, render)
 	}
 
-	return matches, nil
+	return nil
 }